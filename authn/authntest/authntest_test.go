@@ -0,0 +1,97 @@
+package authntest_test
+
+import (
+   "context"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/clintrovert/gobackend/authn/authntest"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// greet is a handler gated by Authenticate.
+func greet(
+   v *authn.GcpIdentifyPlatformAuthenticator,
+   ctx context.Context,
+) (string, error) {
+   ctx, err := v.Authenticate(ctx)
+   if err != nil {
+      return "", err
+   }
+
+   email, _ := authn.ClaimString(ctx, "email")
+
+   return "hello " + email, nil
+}
+
+func TestSignedContext_GatedHandler_ShouldAuthenticate(t *testing.T) {
+   v, err := authntest.NewAuthenticator(nil)
+   require.NoError(t, err)
+
+   ctx := authntest.SignedContext(map[string]any{"email": "a@acme.com"})
+
+   got, err := greet(v, ctx)
+   assert.NoError(t, err)
+   assert.Equal(t, "hello a@acme.com", got)
+}
+
+func TestSignedContext_Subject_ShouldBeStoredInClaims(t *testing.T) {
+   v, err := authntest.NewAuthenticator(nil)
+   require.NoError(t, err)
+
+   ctx, err := v.Authenticate(
+      authntest.SignedContext(nil, authntest.WithSubject("user-1")),
+   )
+   require.NoError(t, err)
+
+   sub, ok := authn.ClaimString(ctx, "sub")
+   assert.True(t, ok)
+   assert.Equal(t, "user-1", sub)
+}
+
+func TestSignedContext_Expired_ShouldBeRejected(t *testing.T) {
+   v, err := authntest.NewAuthenticator(nil)
+   require.NoError(t, err)
+
+   ctx := authntest.SignedContext(nil,
+      authntest.WithExpiry(time.Now().Add(-time.Minute)),
+   )
+
+   _, err = greet(v, ctx)
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestSignedContext_WrongAudience_ShouldBeRejected(t *testing.T) {
+   v, err := authntest.NewAuthenticator(nil)
+   require.NoError(t, err)
+
+   ctx := authntest.SignedContext(nil, authntest.WithAudience("other"))
+
+   _, err = greet(v, ctx)
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestValidator_TamperedToken_ShouldReturnInvalidSignature(t *testing.T) {
+   token := authntest.Token(nil) + "x"
+
+   _, err := authntest.Validator().Validate(
+      context.Background(), token, authntest.Audience,
+   )
+   assert.ErrorIs(t, err, authntest.ErrInvalidSignature)
+}
+
+func TestSignedContext_PublicMethod_ShouldResolveMethod(t *testing.T) {
+   const method = "/acme.v1.Service/Ping"
+   v, err := authntest.NewAuthenticator(map[string]bool{method: true})
+   require.NoError(t, err)
+
+   ctx := authntest.SignedContext(nil, authntest.WithMethod(method))
+
+   got, err := v.Authenticate(ctx)
+   assert.NoError(t, err)
+   assert.Equal(t, ctx, got)
+}
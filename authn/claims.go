@@ -0,0 +1,219 @@
+package authn
+
+import (
+   "context"
+   "encoding/json"
+   "errors"
+   "fmt"
+   "math"
+   "time"
+)
+
+// ErrClaimsMissing indicates the context carries no validated token claims,
+// e.g. for a public method.
+var ErrClaimsMissing = errors.New("authn, claims missing from context")
+
+// Claims returns a copy of the claims of the validated token stored in ctx by
+// Authenticate, so callers may modify the result without affecting other
+// handlers.
+func Claims(ctx context.Context) (map[string]any, bool) {
+   claims, ok := ctx.Value(ClaimsContextKey).(map[string]any)
+   if !ok {
+      return nil, false
+   }
+
+   return copyClaims(claims), true
+}
+
+// DecodeClaims decodes the claims stored in ctx by Authenticate into dest, a
+// pointer to a struct with `json` tags, as encoding/json would decode the
+// token payload. Claims without a matching field are ignored and fields
+// without a claim keep their zero value; a claim whose type does not match
+// its field is an error. A context without claims returns ErrClaimsMissing.
+func DecodeClaims(ctx context.Context, dest any) error {
+   claims, ok := ctx.Value(ClaimsContextKey).(map[string]any)
+   if !ok {
+      return ErrClaimsMissing
+   }
+
+   raw, err := json.Marshal(claims)
+   if err != nil {
+      return fmt.Errorf("encode claims: %w", err)
+   }
+
+   if err := json.Unmarshal(raw, dest); err != nil {
+      return fmt.Errorf("decode claims: %w", err)
+   }
+
+   return nil
+}
+
+// SanitizeContext returns a context whose claims retain only the named
+// claims, e.g. before forwarding the context to a downstream service so PII
+// claims do not cross service boundaries. A context without claims is
+// returned unchanged.
+func SanitizeContext(ctx context.Context, keep ...string) context.Context {
+   claims, ok := ctx.Value(ClaimsContextKey).(map[string]any)
+   if !ok {
+      return ctx
+   }
+
+   kept := make(map[string]any, len(keep))
+   for _, name := range keep {
+      if val, ok := claims[name]; ok {
+         kept[name] = copyClaimValue(val)
+      }
+   }
+
+   return context.WithValue(ctx, ClaimsContextKey, kept)
+}
+
+// copyClaims deep copies the maps and arrays of decoded JSON claims.
+func copyClaims(claims map[string]any) map[string]any {
+   if claims == nil {
+      return nil
+   }
+
+   out := make(map[string]any, len(claims))
+   for name, val := range claims {
+      out[name] = copyClaimValue(val)
+   }
+
+   return out
+}
+
+// copyClaimValue deep copies a decoded JSON value.
+func copyClaimValue(val any) any {
+   switch v := val.(type) {
+   case map[string]any:
+      return copyClaims(v)
+   case []any:
+      out := make([]any, len(v))
+      for i, item := range v {
+         out[i] = copyClaimValue(item)
+      }
+
+      return out
+   case []string:
+      return append([]string(nil), v...)
+   default:
+      return v
+   }
+}
+
+// claim returns the raw value of the named claim without copying the claims.
+func claim(ctx context.Context, name string) (any, bool) {
+   claims, ok := ctx.Value(ClaimsContextKey).(map[string]any)
+   if !ok {
+      return nil, false
+   }
+
+   val, ok := claims[name]
+   return val, ok
+}
+
+// ClaimString returns the named claim when it is a string.
+func ClaimString(ctx context.Context, name string) (string, bool) {
+   val, _ := claim(ctx, name)
+   s, ok := val.(string)
+
+   return s, ok
+}
+
+// ClaimInt64 returns the named claim when it is an integral number. JSON
+// numbers are decoded as float64, so fractional values are rejected.
+func ClaimInt64(ctx context.Context, name string) (int64, bool) {
+   val, _ := claim(ctx, name)
+
+   switch n := val.(type) {
+   case float64:
+      if n != math.Trunc(n) || n > math.MaxInt64 || n < math.MinInt64 {
+         return 0, false
+      }
+
+      return int64(n), true
+   case int64:
+      return n, true
+   case int:
+      return int64(n), true
+   default:
+      return 0, false
+   }
+}
+
+// ClaimTime returns the named claim, a NumericDate expressed in seconds since
+// the Unix epoch such as `exp` or `iat`, as a time.Time.
+func ClaimTime(ctx context.Context, name string) (time.Time, bool) {
+   val, _ := claim(ctx, name)
+
+   switch n := val.(type) {
+   case float64:
+      sec, frac := math.Modf(n)
+      return time.Unix(int64(sec), int64(frac*float64(time.Second))), true
+   case int64:
+      return time.Unix(n, 0), true
+   case int:
+      return time.Unix(int64(n), 0), true
+   default:
+      return time.Time{}, false
+   }
+}
+
+// ClaimStringSlice returns the named claim when it is an array whose elements
+// are all strings.
+func ClaimStringSlice(ctx context.Context, name string) ([]string, bool) {
+   val, _ := claim(ctx, name)
+
+   switch items := val.(type) {
+   case []string:
+      return append([]string(nil), items...), true
+   case []any:
+      out := make([]string, 0, len(items))
+      for _, item := range items {
+         s, ok := item.(string)
+         if !ok {
+            return nil, false
+         }
+         out = append(out, s)
+      }
+
+      return out, true
+   default:
+      return nil, false
+   }
+}
+
+// anonymousProvider is the firebase.sign_in_provider of anonymous
+// identities.
+const anonymousProvider = "anonymous"
+
+// PhoneNumber returns the phone_number claim of identities signed in with a
+// phone number, in E.164 format.
+func PhoneNumber(ctx context.Context) (string, bool) {
+   phone, ok := ClaimString(ctx, "phone_number")
+   if !ok || phone == "" {
+      return "", false
+   }
+
+   return phone, true
+}
+
+// SignInProvider returns the firebase.sign_in_provider claim, e.g.
+// "password", "phone" or "anonymous".
+func SignInProvider(ctx context.Context) (string, bool) {
+   val, _ := claim(ctx, "firebase")
+   firebase, ok := val.(map[string]any)
+   if !ok {
+      return "", false
+   }
+
+   provider, ok := firebase["sign_in_provider"].(string)
+
+   return provider, ok
+}
+
+// IsAnonymous reports whether the identity signed in anonymously.
+func IsAnonymous(ctx context.Context) bool {
+   provider, _ := SignInProvider(ctx)
+   return provider == anonymousProvider
+}
@@ -0,0 +1,167 @@
+package authn_test
+
+import (
+   "context"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/stretchr/testify/assert"
+)
+
+func claimsContext(claims map[string]any) context.Context {
+   return context.WithValue(
+      context.Background(), authn.ClaimsContextKey, claims,
+   )
+}
+
+func TestClaimHelpers_CorrectlyTyped_ShouldCoerce(t *testing.T) {
+   ctx := claimsContext(map[string]any{
+      "email":  "a@acme.com",
+      "tier":   float64(3),
+      "exp":    float64(1700000000),
+      "groups": []any{"admins", "billing"},
+   })
+
+   email, ok := authn.ClaimString(ctx, "email")
+   assert.True(t, ok)
+   assert.Equal(t, "a@acme.com", email)
+
+   tier, ok := authn.ClaimInt64(ctx, "tier")
+   assert.True(t, ok)
+   assert.Equal(t, int64(3), tier)
+
+   exp, ok := authn.ClaimTime(ctx, "exp")
+   assert.True(t, ok)
+   assert.True(t, time.Unix(1700000000, 0).Equal(exp))
+
+   groups, ok := authn.ClaimStringSlice(ctx, "groups")
+   assert.True(t, ok)
+   assert.Equal(t, []string{"admins", "billing"}, groups)
+}
+
+func TestClaimHelpers_IncorrectlyTyped_ShouldNotCoerce(t *testing.T) {
+   ctx := claimsContext(map[string]any{
+      "email":  float64(1),
+      "tier":   float64(3.5),
+      "exp":    "tomorrow",
+      "groups": []any{"admins", float64(1)},
+   })
+
+   _, ok := authn.ClaimString(ctx, "email")
+   assert.False(t, ok)
+
+   _, ok = authn.ClaimInt64(ctx, "tier")
+   assert.False(t, ok)
+
+   _, ok = authn.ClaimTime(ctx, "exp")
+   assert.False(t, ok)
+
+   _, ok = authn.ClaimStringSlice(ctx, "groups")
+   assert.False(t, ok)
+}
+
+func TestClaimHelpers_MissingClaims_ShouldNotCoerce(t *testing.T) {
+   ctx := context.Background()
+
+   _, ok := authn.ClaimString(ctx, "email")
+   assert.False(t, ok)
+
+   _, ok = authn.ClaimInt64(claimsContext(map[string]any{}), "tier")
+   assert.False(t, ok)
+}
+
+func TestSanitizeContext_KeepList_ShouldDropOtherClaims(t *testing.T) {
+   ctx := claimsContext(map[string]any{
+      "sub":   "user-1",
+      "email": "a@acme.com",
+      "phone": "+15555550100",
+   })
+
+   sanitized := authn.SanitizeContext(ctx, "sub", "missing")
+
+   claims, ok := authn.Claims(sanitized)
+   assert.True(t, ok)
+   assert.Equal(t, map[string]any{"sub": "user-1"}, claims)
+
+   original, _ := authn.Claims(ctx)
+   assert.Len(t, original, 3)
+}
+
+func TestSanitizeContext_NoClaims_ShouldReturnContext(t *testing.T) {
+   ctx := context.Background()
+
+   assert.Equal(t, ctx, authn.SanitizeContext(ctx, "sub"))
+}
+
+// tokenClaims is a typed view of the claims used by DecodeClaims tests.
+type tokenClaims struct {
+   Email         string   `json:"email"`
+   EmailVerified bool     `json:"email_verified"`
+   Tier          int      `json:"tier"`
+   Expiry        int64    `json:"exp"`
+   Groups        []string `json:"groups"`
+   Nickname      string   `json:"nickname"`
+}
+
+func TestDecodeClaims_TypedStruct_ShouldPopulateFields(t *testing.T) {
+   ctx := claimsContext(map[string]any{
+      "email":          "a@acme.com",
+      "email_verified": true,
+      "tier":           float64(3),
+      "exp":            float64(1700000000),
+      "groups":         []any{"admins", "billing"},
+      "unmapped":       "ignored",
+   })
+
+   var claims tokenClaims
+   err := authn.DecodeClaims(ctx, &claims)
+   assert.NoError(t, err)
+   assert.Equal(t, tokenClaims{
+      Email:         "a@acme.com",
+      EmailVerified: true,
+      Tier:          3,
+      Expiry:        1700000000,
+      Groups:        []string{"admins", "billing"},
+   }, claims)
+}
+
+func TestDecodeClaims_TypeMismatch_ShouldError(t *testing.T) {
+   ctx := claimsContext(map[string]any{"tier": "gold"})
+
+   var claims tokenClaims
+   err := authn.DecodeClaims(ctx, &claims)
+   assert.Error(t, err)
+   assert.NotErrorIs(t, err, authn.ErrClaimsMissing)
+}
+
+func TestDecodeClaims_NoClaims_ShouldReturnErrClaimsMissing(t *testing.T) {
+   var claims tokenClaims
+   err := authn.DecodeClaims(context.Background(), &claims)
+   assert.ErrorIs(t, err, authn.ErrClaimsMissing)
+}
+
+func TestIdentityHelpers_PhoneAndAnonymousTokens_ShouldReport(t *testing.T) {
+   phone := claimsContext(map[string]any{
+      "phone_number": "+15555550100",
+      "firebase":     map[string]any{"sign_in_provider": "phone"},
+   })
+   number, ok := authn.PhoneNumber(phone)
+   assert.True(t, ok)
+   assert.Equal(t, "+15555550100", number)
+   provider, ok := authn.SignInProvider(phone)
+   assert.True(t, ok)
+   assert.Equal(t, "phone", provider)
+   assert.False(t, authn.IsAnonymous(phone))
+
+   anonymous := claimsContext(map[string]any{
+      "firebase": map[string]any{"sign_in_provider": "anonymous"},
+   })
+   _, ok = authn.PhoneNumber(anonymous)
+   assert.False(t, ok)
+   assert.True(t, authn.IsAnonymous(anonymous))
+
+   _, ok = authn.SignInProvider(context.Background())
+   assert.False(t, ok)
+   assert.False(t, authn.IsAnonymous(context.Background()))
+}
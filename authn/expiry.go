@@ -0,0 +1,39 @@
+package authn
+
+import (
+   "context"
+   "time"
+)
+
+type tokenExpiryContextKey struct{}
+
+// withTokenExpiry stores the expiry of a validated token in ctx. Payloads
+// without an `exp` claim leave ctx unchanged.
+func withTokenExpiry(ctx context.Context, expires int64) context.Context {
+   if expires <= 0 {
+      return ctx
+   }
+
+   return context.WithValue(ctx, tokenExpiryContextKey{}, time.Unix(expires, 0))
+}
+
+// TokenExpiry returns when the token validated by Authenticate expires, as
+// given by its `exp` claim, e.g. to bound how long per-request data may be
+// cached. It reports false for contexts without a validated token, such as
+// public methods.
+func TokenExpiry(ctx context.Context) (time.Time, bool) {
+   expires, ok := ctx.Value(tokenExpiryContextKey{}).(time.Time)
+   return expires, ok
+}
+
+// TokenTimeLeft returns the remaining lifetime of the token validated by
+// Authenticate, which is zero once it has expired. It reports false for
+// contexts without a validated token.
+func TokenTimeLeft(ctx context.Context) (time.Duration, bool) {
+   expires, ok := TokenExpiry(ctx)
+   if !ok {
+      return 0, false
+   }
+
+   return max(time.Until(expires), 0), true
+}
@@ -0,0 +1,44 @@
+package authn_test
+
+import (
+   "context"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/clintrovert/gobackend/authn/authntest"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+)
+
+func TestTokenExpiry_KnownExpiry_ShouldReturnLifetime(t *testing.T) {
+   expires := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+
+   v, err := authntest.NewAuthenticator(nil)
+   require.NoError(t, err)
+
+   ctx, err := v.Authenticate(authntest.SignedContext(
+      nil,
+      authntest.WithExpiry(expires),
+      authntest.WithMethod("/acme.v1.Service/Get"),
+   ))
+   require.NoError(t, err)
+
+   got, ok := authn.TokenExpiry(ctx)
+   assert.True(t, ok)
+   assert.True(t, expires.Equal(got))
+
+   left, ok := authn.TokenTimeLeft(ctx)
+   assert.True(t, ok)
+   assert.InDelta(t, 30*time.Minute, left, float64(5*time.Second))
+}
+
+func TestTokenExpiry_NoPayload_ShouldReturnFalse(t *testing.T) {
+   expires, ok := authn.TokenExpiry(context.Background())
+   assert.False(t, ok)
+   assert.True(t, expires.IsZero())
+
+   left, ok := authn.TokenTimeLeft(context.Background())
+   assert.False(t, ok)
+   assert.Zero(t, left)
+}
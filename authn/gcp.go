@@ -2,10 +2,17 @@ package authn
 
 import (
    "context"
+   "encoding/base64"
    "errors"
+   "fmt"
    "log/slog"
+   "os"
+   "slices"
+   "strconv"
    "strings"
+   "time"
 
+   "cloud.google.com/go/compute/metadata"
    "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
    "google.golang.org/api/idtoken"
    "google.golang.org/grpc"
@@ -29,44 +36,527 @@ var (
    ErrExpectedAudMissing = errors.New(
       "authn.GcpIdentifyPlatformAuthenticator, expected token Audience missing",
    )
+
+   // ErrAudienceFile indicates that the file named by ExpectedAudienceFile
+   // could not be read or is empty.
+   ErrAudienceFile = errors.New(
+      "authn.GcpIdentifyPlatformAuthenticator, expected audience file invalid",
+   )
+
+   // ErrInvalidConfig indicates that the fields of a
+   // GcpIdentifyPlatformAuthenticatorConfig contradict each other or are out
+   // of range.
+   ErrInvalidConfig = errors.New(
+      "authn.GcpIdentifyPlatformAuthenticator, invalid config",
+   )
+
+   // ErrValidatorInit indicates that the token validator could not be
+   // created at startup.
+   ErrValidatorInit = errors.New(
+      "authn.GcpIdentifyPlatformAuthenticator, token validator init failed",
+   )
 )
 
+// wellKnownPublicMethods are the gRPC health and reflection methods that are
+// treated as public when AllowHealthAndReflection is enabled.
+var wellKnownPublicMethods = []string{
+   "/grpc.health.v1.Health/Check",
+   "/grpc.health.v1.Health/Watch",
+   "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+   "/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
 // GcpIdentifyPlatformAuthenticatorConfig handles environment variable mapping
-//  of configuration values for GcpIdentifyPlatformAuthenticator.
+// of configuration values for GcpIdentifyPlatformAuthenticator, e.g. with
+// environ.Unmarshal. Every variable is optional on its own, and
+// NewGcpIdentityPlatformValidator checks the combination. The fields are
+// read from:
+//
+//   - ExpectedAudience: GCP_TOKEN_EXPECTED_AUDIENCE
+//   - ExpectedAudiences: GCP_TOKEN_EXPECTED_AUDIENCES, a comma separated list
+//   - ExpectedAudienceFile: GCP_TOKEN_EXPECTED_AUDIENCE_FILE
+//   - AudienceFromProject: GCP_AUTH_AUDIENCE_FROM_PROJECT
+//   - GcpProjectId: GCP_PROJECT_ID
+//   - AllowHealthAndReflection: GCP_AUTH_ALLOW_HEALTH_AND_REFLECTION
+//   - ExpiryRefreshHint: GCP_AUTH_EXPIRY_REFRESH_HINT
+//   - TenantID: GCP_AUTH_TENANT_ID
+//   - RequireEmailVerified: GCP_AUTH_REQUIRE_EMAIL_VERIFIED
+//   - DenyAnonymous: GCP_AUTH_DENY_ANONYMOUS
+//   - AllowedSignInProviders: GCP_AUTH_ALLOWED_SIGN_IN_PROVIDERS, a comma
+//     separated list
+//   - MaxTokenSize: GCP_AUTH_MAX_TOKEN_SIZE
+//   - TrustedUnixSocket: GCP_AUTH_TRUSTED_UNIX_SOCKET
+//   - TrustedSubject: GCP_AUTH_TRUSTED_SUBJECT
+//   - ClockSkew: GCP_AUTH_CLOCK_SKEW, a duration such as 30s
 type GcpIdentifyPlatformAuthenticatorConfig struct {
-   ExpectedAudience string `env:"GCP_TOKEN_EXPECTED_AUDIENCE"`
-   GcpProjectId     string `env:"GCP_PROJECT_ID"`
+   // ExpectedAudience is required unless ExpectedAudiences,
+   // ExpectedAudienceFile or AudienceFromProject is set or an
+   // AudienceValidator is supplied; a missing value is reported as
+   // ErrExpectedAudMissing by NewGcpIdentityPlatformValidator.
+   ExpectedAudience string `env:"GCP_TOKEN_EXPECTED_AUDIENCE,optional"`
+   // ExpectedAudiences lists further accepted audiences, e.g. one per
+   // client of a deployment, read from a comma separated list such as
+   // GCP_TOKEN_EXPECTED_AUDIENCES=web-app,mobile-app. Tokens for any
+   // listed audience, or ExpectedAudience, are accepted.
+   ExpectedAudiences []string `env:"GCP_TOKEN_EXPECTED_AUDIENCES,optional"`
+   // ExpectedAudienceFile names a file, e.g. a mounted secret, holding the
+   // expected audience. It is read by NewGcpIdentityPlatformValidator when
+   // ExpectedAudience is empty; surrounding whitespace is trimmed.
+   ExpectedAudienceFile string `env:"GCP_TOKEN_EXPECTED_AUDIENCE_FILE,optional"` //nolint:lll
+   // AudienceFromProject uses the project ID as the expected audience when
+   // ExpectedAudience is empty, as is usual for Identity Platform tokens.
+   AudienceFromProject bool `env:"GCP_AUTH_AUDIENCE_FROM_PROJECT,optional"`
+   // GcpProjectId falls back to the metadata server when empty.
+   GcpProjectId string `env:"GCP_PROJECT_ID,optional"`
+   // AllowHealthAndReflection makes the gRPC health and reflection services
+   // public without listing them in publicMethods, e.g. for load-balancer
+   // health probes.
+   AllowHealthAndReflection bool `env:"GCP_AUTH_ALLOW_HEALTH_AND_REFLECTION,optional"` //nolint:lll
+   // ExpiryRefreshHint attaches a TOKEN_EXPIRED reason to the Unauthenticated
+   // status of expired tokens, so clients can refresh rather than re-login.
+   ExpiryRefreshHint bool `env:"GCP_AUTH_EXPIRY_REFRESH_HINT,optional"`
+   // TenantID restricts tokens to a single Identity Platform tenant, as
+   // named by their firebase.tenant claim. Any tenant, or none, is accepted
+   // when empty.
+   TenantID string `env:"GCP_AUTH_TENANT_ID,optional"`
+   // RequireEmailVerified rejects tokens whose email_verified claim is not
+   // true, including tokens without the claim, with PermissionDenied. Phone
+   // and anonymous identities carry no email, so they are rejected too.
+   RequireEmailVerified bool `env:"GCP_AUTH_REQUIRE_EMAIL_VERIFIED,optional"`
+   // DenyAnonymous rejects tokens of anonymous identities, whose
+   // firebase.sign_in_provider claim is "anonymous", with PermissionDenied.
+   // Anonymous identities are accepted when false.
+   DenyAnonymous bool `env:"GCP_AUTH_DENY_ANONYMOUS,optional"`
+   // AllowedSignInProviders restricts tokens to the listed
+   // firebase.sign_in_provider values, e.g. google.com and password.
+   // Tokens of other providers, or without the claim, are rejected with
+   // PermissionDenied. Every provider is accepted when empty.
+   AllowedSignInProviders []string `env:"GCP_AUTH_ALLOWED_SIGN_IN_PROVIDERS,optional"` //nolint:lll
+   // MaxTokenSize is the limit, in bytes, on bearer tokens, as set by
+   // WithMaxTokenSize. Zero keeps the 16 KiB default.
+   MaxTokenSize int `env:"GCP_AUTH_MAX_TOKEN_SIZE,optional,min=0"`
+   // TrustedUnixSocket and TrustedSubject trust calls over the unix socket
+   // at the path, as by WithTrustedUnixSocket. Either both or neither must
+   // be set.
+   TrustedUnixSocket string `env:"GCP_AUTH_TRUSTED_UNIX_SOCKET,optional"`
+   TrustedSubject    string `env:"GCP_AUTH_TRUSTED_SUBJECT,optional"`
+   // ClockSkew tolerates clock differences with the token issuer of up to
+   // the duration: tokens whose iat claim is at most ClockSkew in the
+   // future are accepted, as are tokens at most ClockSkew past their exp
+   // claim when verified locally, as with WithKeySource. Google's
+   // validator, the default, checks exp itself without tolerance. It must
+   // be between zero and 5 minutes.
+   ClockSkew time.Duration `env:"GCP_AUTH_CLOCK_SKEW,optional"`
+}
+
+// maxClockSkew is the largest ClockSkew accepted, so a misconfigured value
+// cannot extend the lifetime of tokens significantly.
+const maxClockSkew = 5 * time.Minute
+
+// validate checks the fields of conf that can be checked without the
+// environment, returning every problem found joined, each wrapping
+// ErrInvalidConfig.
+func (conf GcpIdentifyPlatformAuthenticatorConfig) validate() error {
+   var errs []error
+   if conf.MaxTokenSize < 0 {
+      errs = append(errs, fmt.Errorf(
+         "%w: MaxTokenSize %d is negative", ErrInvalidConfig, conf.MaxTokenSize,
+      ))
+   }
+
+   socket := strings.TrimSpace(conf.TrustedUnixSocket)
+   subject := strings.TrimSpace(conf.TrustedSubject)
+   if (socket == "") != (subject == "") {
+      errs = append(errs, fmt.Errorf(
+         "%w: TrustedUnixSocket and TrustedSubject must be set together",
+         ErrInvalidConfig,
+      ))
+   }
+
+   if conf.ClockSkew < 0 || conf.ClockSkew > maxClockSkew {
+      errs = append(errs, fmt.Errorf(
+         "%w: ClockSkew %s is not between 0 and %s",
+         ErrInvalidConfig, conf.ClockSkew, maxClockSkew,
+      ))
+   }
+
+   if conf.DenyAnonymous &&
+      slices.Contains(conf.AllowedSignInProviders, anonymousProvider) {
+      errs = append(errs, fmt.Errorf(
+         "%w: AllowedSignInProviders lists '%s' while DenyAnonymous is set",
+         ErrInvalidConfig, anonymousProvider,
+      ))
+   }
+
+   return errors.Join(errs...)
+}
+
+// TokenValidator validates an ID token for the expected audience.
+// *idtoken.Validator satisfies this interface.
+type TokenValidator interface {
+   Validate(
+      ctx context.Context,
+      token string,
+      audience string,
+   ) (*idtoken.Payload, error)
+}
+
+// ProjectIDResolver looks up the GCP project ID when it is not configured.
+type ProjectIDResolver func(ctx context.Context) (string, error)
+
+// metadataLookupTimeout bounds the project ID lookup on the metadata server.
+const metadataLookupTimeout = 3 * time.Second
+
+// errNotOnGCE indicates the metadata server is unavailable.
+var errNotOnGCE = errors.New("authn, not running on GCE")
+
+// metadataProjectID resolves the project ID from the GCE metadata server.
+func metadataProjectID(ctx context.Context) (string, error) {
+   if !metadata.OnGCEWithContext(ctx) {
+      return "", errNotOnGCE
+   }
+
+   return metadata.ProjectIDWithContext(ctx)
+}
+
+// Option configures optional behavior of GcpIdentifyPlatformAuthenticator.
+type Option func(*GcpIdentifyPlatformAuthenticator)
+
+// WithProjectIDResolver replaces the metadata server lookup used when
+// GcpProjectId is not configured. A nil resolver disables the fallback.
+func WithProjectIDResolver(resolver ProjectIDResolver) Option {
+   return func(v *GcpIdentifyPlatformAuthenticator) {
+      v.projectIDResolver = resolver
+   }
+}
+
+// AudienceValidator reports whether a token audience is acceptable, e.g. for
+// dynamic per-tenant audiences.
+type AudienceValidator func(aud string) bool
+
+// WithAudienceValidator validates token audiences with fn instead of
+// comparing against ExpectedAudience, which then becomes optional. Tokens
+// whose audience is rejected fail with the AUDIENCE_MISMATCH reason.
+func WithAudienceValidator(fn AudienceValidator) Option {
+   return func(v *GcpIdentifyPlatformAuthenticator) {
+      v.audienceValidator = fn
+   }
+}
+
+// WithTokenValidator replaces the default idtoken validator, e.g. with a fake
+// in tests.
+func WithTokenValidator(validator TokenValidator) Option {
+   return func(v *GcpIdentifyPlatformAuthenticator) {
+      v.validator = validator
+   }
+}
+
+// defaultMaxTokenSize is the default limit, in bytes, on bearer tokens. ID
+// tokens are typically 1-2 KiB, so this leaves room for large custom claims.
+const defaultMaxTokenSize = 16 * 1024
+
+// WithMaxTokenSize rejects bearer tokens longer than n bytes before they are
+// parsed, failing with the TOKEN_TOO_LARGE reason. The default is 16 KiB; a
+// limit below 1 keeps the default.
+func WithMaxTokenSize(n int) Option {
+   return func(v *GcpIdentifyPlatformAuthenticator) {
+      if n > 0 {
+         v.maxTokenSize = n
+      }
+   }
+}
+
+// ValidatorFactory creates the TokenValidator used by the authenticator.
+type ValidatorFactory func(ctx context.Context) (TokenValidator, error)
+
+// KeyFetcher is implemented by token validators that fetch their signing
+// keys over the network. NewGcpIdentityPlatformValidator calls FetchKeys
+// once at startup, so unreachable keys fail construction rather than every
+// request.
+type KeyFetcher interface {
+   FetchKeys(ctx context.Context) error
+}
+
+// clockSkewValidator is implemented by token validators checking the exp
+// claim themselves that can tolerate ClockSkew.
+type clockSkewValidator interface {
+   withClockSkew(skew time.Duration) TokenValidator
+}
+
+// keyFetchTimeout bounds the key fetch made at startup.
+const keyFetchTimeout = 10 * time.Second
+
+// probeKeyID is the `kid` of the probe token used to fetch the keys of an
+// idtoken validator. No published key has this ID.
+const probeKeyID = "authn-key-probe"
+
+// errNoMatchingKey is the message of idtoken for a token whose `kid` names no
+// fetched key, i.e. the keys were fetched successfully.
+const errNoMatchingKey = "could not find matching cert keyId"
+
+// idTokenValidator is the default TokenValidator, an idtoken validator
+// whose keys can be fetched ahead of the first request.
+type idTokenValidator struct {
+   *idtoken.Validator
+}
+
+// newIDTokenValidator is the default ValidatorFactory.
+func newIDTokenValidator(ctx context.Context) (TokenValidator, error) {
+   validator, err := idtoken.NewValidator(ctx)
+   if err != nil {
+      return nil, err
+   }
+
+   return idTokenValidator{Validator: validator}, nil
+}
+
+// FetchKeys validates a probe token naming an unknown key, which makes the
+// idtoken validator fetch, and cache, Google's certificates. Only the
+// failure to find the probe key means the fetch succeeded.
+func (v idTokenValidator) FetchKeys(ctx context.Context) error {
+   _, err := v.Validate(ctx, probeToken(), "")
+   if err == nil || !strings.Contains(err.Error(), errNoMatchingKey) {
+      return fmt.Errorf("fetch signing keys: %w", err)
+   }
+
+   return nil
+}
+
+// probeToken returns an unexpired RS256 token signed by probeKeyID.
+func probeToken() string {
+   encode := func(v string) string {
+      return base64.RawURLEncoding.EncodeToString([]byte(v))
+   }
+
+   header := encode(`{"alg":"RS256","typ":"JWT","kid":"` + probeKeyID + `"}`)
+   exp := time.Now().Add(time.Hour).Unix()
+   payload := encode(fmt.Sprintf(`{"exp":%d}`, exp))
+
+   return header + "." + payload + "." + encode("probe")
+}
+
+// WithValidatorFactory replaces the factory creating the validator at
+// startup. It is ignored when WithTokenValidator is also supplied.
+func WithValidatorFactory(factory ValidatorFactory) Option {
+   return func(v *GcpIdentifyPlatformAuthenticator) {
+      v.validatorFactory = factory
+   }
 }
 
 // GcpIdentifyPlatformAuthenticator handles authentication of JWT bearer tokens
 // provided by GCP's Identify Platform.
 type GcpIdentifyPlatformAuthenticator struct {
-   expectedAudience string
-   expectedIssuer   string
+   expectedAudiences []string
+   expectedIssuer    string
+   expiryRefreshHint bool
+   maxTokenSize      int
+   tenantID          string
+   requireVerified   bool
+   denyAnonymous     bool
+   allowedProviders  map[string]bool
+   clockSkew         time.Duration
 
    // Some routes may not require authentication.
    publicMethods map[string]bool
+
+   // validator is created at startup by validatorFactory unless supplied
+   // with WithTokenValidator.
+   validator        TokenValidator
+   validatorFactory ValidatorFactory
+
+   projectIDResolver ProjectIDResolver
+   audienceValidator AudienceValidator
+
+   // Calls over the trusted unix socket bypass token validation.
+   trustedSocket  string
+   trustedSubject string
 }
 
 // NewGcpIdentityPlatformValidator creates a new instance of
-// GcpIdentifyPlatformAuthenticator with all required fields populated.
+// GcpIdentifyPlatformAuthenticator with all required fields populated. When
+// the project ID is not configured it is looked up on the metadata server, as
+// available on GCE, GKE and Cloud Run, before ErrProjectIdMissing is
+// returned. The token validator is created up front, so a failure to create
+// it, e.g. from misconfigured credentials, returns ErrValidatorInit at
+// startup rather than failing each request. Validators implementing
+// KeyFetcher, such as the default one, also fetch their signing keys, and a
+// failure returns ErrValidatorInit too. Contradictory or out of range
+// config fields return ErrInvalidConfig before anything is looked up.
+// Options take precedence over the config fields they correspond to, e.g.
+// WithMaxTokenSize over MaxTokenSize.
+//
+// The keys of publicMethods are full gRPC method names in the canonical
+// form "/pkg.Service/Method" returned by grpc.Method. The leading slash may
+// be omitted and the method may be separated by a dot, as in
+// "pkg.Service.Method"; both are normalized to the canonical form.
 func NewGcpIdentityPlatformValidator(
    conf GcpIdentifyPlatformAuthenticatorConfig,
    publicMethods map[string]bool,
+   opts ...Option,
 ) (*GcpIdentifyPlatformAuthenticator, error) {
-   if strings.TrimSpace(conf.GcpProjectId) == "" {
+   if err := conf.validate(); err != nil {
+      return nil, err
+   }
+
+   v := &GcpIdentifyPlatformAuthenticator{
+      projectIDResolver: metadataProjectID,
+      validatorFactory:  newIDTokenValidator,
+      maxTokenSize:      defaultMaxTokenSize,
+   }
+
+   // The config seeds the fields options may override.
+   WithMaxTokenSize(conf.MaxTokenSize)(v)
+   if socket := strings.TrimSpace(conf.TrustedUnixSocket); socket != "" {
+      subject := strings.TrimSpace(conf.TrustedSubject)
+      WithTrustedUnixSocket(socket, subject)(v)
+   }
+
+   for _, opt := range opts {
+      opt(v)
+   }
+
+   projectID := strings.TrimSpace(conf.GcpProjectId)
+   if projectID == "" && v.projectIDResolver != nil {
+      ctx, cancel := context.WithTimeout(
+         context.Background(), metadataLookupTimeout,
+      )
+      defer cancel()
+
+      resolved, err := v.projectIDResolver(ctx)
+      if err != nil {
+         slog.Warn(
+            "authn.GcpIdentifyPlatformAuthenticator, project ID lookup failed",
+            "error", err.Error(),
+         )
+      }
+      projectID = strings.TrimSpace(resolved)
+   }
+
+   if projectID == "" {
       return nil, ErrProjectIdMissing
    }
 
-   if strings.TrimSpace(conf.ExpectedAudience) == "" {
+   // Explicit audiences win over the one read from a file, which wins over
+   // the one derived from the project.
+   audiences := expectedAudiences(conf)
+   if len(audiences) == 0 && conf.ExpectedAudienceFile != "" {
+      fromFile, err := readAudienceFile(conf.ExpectedAudienceFile)
+      if err != nil {
+         return nil, err
+      }
+      audiences = []string{fromFile}
+   }
+
+   if len(audiences) == 0 && conf.AudienceFromProject {
+      audiences = []string{projectID}
+   }
+
+   if len(audiences) == 0 && v.audienceValidator == nil {
       return nil, ErrExpectedAudMissing
    }
 
-   return &GcpIdentifyPlatformAuthenticator{
-      expectedIssuer:   "https://securetoken.google.com/" + conf.GcpProjectId,
-      expectedAudience: conf.ExpectedAudience,
-      publicMethods:    publicMethods,
-   }, nil
+   // Create the validator once so requests never pay for, or fail on, its
+   // initialization.
+   if v.validator == nil {
+      validator, err := v.validatorFactory(context.Background())
+      if err != nil {
+         return nil, fmt.Errorf("%w: %w", ErrValidatorInit, err)
+      }
+      v.validator = validator
+   }
+
+   if fetcher, ok := v.validator.(KeyFetcher); ok {
+      ctx, cancel := context.WithTimeout(
+         context.Background(), keyFetchTimeout,
+      )
+      defer cancel()
+
+      if err := fetcher.FetchKeys(ctx); err != nil {
+         return nil, fmt.Errorf("%w: %w", ErrValidatorInit, err)
+      }
+   }
+
+   if skewed, ok := v.validator.(clockSkewValidator); ok {
+      v.validator = skewed.withClockSkew(conf.ClockSkew)
+   }
+
+   // Copy so the caller's map is never mutated.
+   methods := make(map[string]bool, len(publicMethods))
+   for method, public := range publicMethods {
+      methods[canonicalMethod(method)] = public
+   }
+
+   if conf.AllowHealthAndReflection {
+      for _, method := range wellKnownPublicMethods {
+         methods[method] = true
+      }
+   }
+
+   v.expectedIssuer = "https://securetoken.google.com/" + projectID
+   v.expectedAudiences = audiences
+   v.expiryRefreshHint = conf.ExpiryRefreshHint
+   v.tenantID = strings.TrimSpace(conf.TenantID)
+   v.requireVerified = conf.RequireEmailVerified
+   v.denyAnonymous = conf.DenyAnonymous
+   v.clockSkew = conf.ClockSkew
+   for _, provider := range conf.AllowedSignInProviders {
+      if provider = strings.TrimSpace(provider); provider != "" {
+         if v.allowedProviders == nil {
+            v.allowedProviders = map[string]bool{}
+         }
+         v.allowedProviders[provider] = true
+      }
+   }
+   v.publicMethods = methods
+
+   return v, nil
+}
+
+// canonicalMethod normalizes a full gRPC method name to the
+// "/pkg.Service/Method" form, adding the leading slash and, for the
+// "pkg.Service.Method" dot notation, splitting the method at the last dot.
+func canonicalMethod(method string) string {
+   method = strings.TrimPrefix(strings.TrimSpace(method), "/")
+   if !strings.Contains(method, "/") {
+      if idx := strings.LastIndex(method, "."); idx >= 0 {
+         method = method[:idx] + "/" + method[idx+1:]
+      }
+   }
+
+   return "/" + method
+}
+
+// expectedAudiences returns the trimmed, de-duplicated ExpectedAudience and
+// ExpectedAudiences of conf, skipping empty entries.
+func expectedAudiences(conf GcpIdentifyPlatformAuthenticatorConfig) []string {
+   var audiences []string
+   candidates := append([]string{conf.ExpectedAudience},
+      conf.ExpectedAudiences...,
+   )
+   for _, audience := range candidates {
+      audience = strings.TrimSpace(audience)
+      if audience != "" && !slices.Contains(audiences, audience) {
+         audiences = append(audiences, audience)
+      }
+   }
+
+   return audiences
+}
+
+// readAudienceFile returns the trimmed contents of the audience file at
+// path, returning ErrAudienceFile when it cannot be read or is blank.
+func readAudienceFile(path string) (string, error) {
+   data, err := os.ReadFile(path)
+   if err != nil {
+      return "", fmt.Errorf("%w: %w", ErrAudienceFile, err)
+   }
+
+   audience := strings.TrimSpace(string(data))
+   if audience == "" {
+      return "", fmt.Errorf("%w: '%s' is empty", ErrAudienceFile, path)
+   }
+
+   return audience, nil
 }
 
 // Authenticate authenticates an incoming bearer token to GCP's Identify
@@ -78,12 +568,17 @@ func (v *GcpIdentifyPlatformAuthenticator) Authenticate(
 ) (context.Context, error) {
    method, ok := grpc.Method(ctx)
    if ok {
-      if _, isPublic := v.publicMethods[method]; isPublic {
+      _, isPublic := v.publicMethods[canonicalMethod(method)]
+      if isPublic {
          slog.Debug("Skipping authentication for public method: " + method)
          return ctx, nil
       }
    }
 
+   if v.isTrustedPeer(ctx) {
+      return v.trustedPeerContext(ctx), nil
+   }
+
    token, err := auth.AuthFromMD(ctx, "bearer")
    if err != nil {
       slog.Error(
@@ -96,28 +591,121 @@ func (v *GcpIdentifyPlatformAuthenticator) Authenticate(
       )
    }
 
-   validator, err := idtoken.NewValidator(ctx)
-   if err != nil {
+   if len(token) > v.maxTokenSize {
       slog.Error(
-         "authn.GcpIdentifyPlatformAuthenticator, failed to token validator",
-         "error", err.Error(),
+         "authn.GcpIdentifyPlatformAuthenticator, token too large",
+         "size", len(token),
+      )
+
+      return nil, unauthenticatedWithReason(
+         ctx,
+         "Authentication token too large",
+         ReasonTokenTooLarge,
+         map[string]string{"max_token_size": strconv.Itoa(v.maxTokenSize)},
       )
+   }
+
+   payload, err := v.Validate(ctx, token)
+   if err != nil {
+      return nil, err
+   }
+
+   // Service account, phone and anonymous tokens lack an email claim, so
+   // the identifying claims are only logged when present.
+   attrs := []any{"subject", payload.Subject}
+   for _, name := range []string{"email", "phone_number"} {
+      if val, ok := payload.Claims[name].(string); ok && val != "" {
+         attrs = append(attrs, name, val)
+      }
+   }
+   if provider := firebaseClaim(payload, "sign_in_provider"); provider != "" {
+      attrs = append(attrs, "sign_in_provider", provider)
+   }
+   slog.Debug("successfully authenticated", attrs...)
+
+   // Store a copy so handlers cannot modify a payload shared with the
+   // validator.
+   claims := copyClaims(payload.Claims)
+   ctx = withTokenExpiry(ctx, payload.Expires)
 
-      return nil, status.Error(codes.Internal, "Authentication service error")
+   return context.WithValue(ctx, ClaimsContextKey, claims), nil
+}
+
+// Validate performs the full validation of token, including the audience,
+// issuer, tenant, sign-in provider and email verification checks, and returns
+// its payload, e.g. for an HTTP gateway building its own request context.
+// Errors are gRPC statuses, as from Authenticate.
+func (v *GcpIdentifyPlatformAuthenticator) Validate(
+   ctx context.Context,
+   token string,
+) (*idtoken.Payload, error) {
+   // A single expected audience is checked by the token validator. A custom
+   // audience validator, or a list of audiences, replaces that strict check.
+   audience := ""
+   if v.audienceValidator == nil && len(v.expectedAudiences) == 1 {
+      audience = v.expectedAudiences[0]
    }
 
-   payload, err := validator.Validate(ctx, token, v.expectedAudience)
+   payload, err := v.validator.Validate(ctx, token, audience)
    if err != nil {
       slog.Error(
          "authn.GcpIdentifyPlatformAuthenticator, token validation failed",
          "error", err.Error(),
       )
 
+      if isAudienceMismatch(err) {
+         return nil, unauthenticatedWithReason(
+            ctx,
+            "Invalid authentication token audience",
+            ReasonAudienceMismatch,
+            map[string]string{
+               "expected_audience": strings.Join(v.expectedAudiences, ","),
+            },
+         )
+      }
+
+      if v.expiryRefreshHint && isTokenExpired(err) {
+         return nil, unauthenticatedWithReason(
+            ctx, "Authentication token expired", ReasonTokenExpired, nil,
+         )
+      }
+
       return nil, status.Error(
          codes.Unauthenticated, "Invalid authentication token",
       )
    }
 
+   if v.audienceValidator != nil && !v.audienceValidator(payload.Audience) {
+      slog.Error(
+         "authn.GcpIdentifyPlatformAuthenticator, token audience rejected",
+      )
+
+      return nil, unauthenticatedWithReason(
+         ctx,
+         "Invalid authentication token audience",
+         ReasonAudienceMismatch,
+         nil,
+      )
+   }
+
+   if v.audienceValidator == nil && len(v.expectedAudiences) > 1 &&
+      !slices.Contains(v.expectedAudiences, payload.Audience) {
+      slog.Error(
+         "authn.GcpIdentifyPlatformAuthenticator, invalid token audience",
+         "expected", v.expectedAudiences,
+         "actual", payload.Audience,
+      )
+
+      return nil, unauthenticatedWithReason(
+         ctx,
+         "Invalid authentication token audience",
+         ReasonAudienceMismatch,
+         map[string]string{
+            "expected_audience": strings.Join(v.expectedAudiences, ","),
+         },
+      )
+   }
+
    if payload.Issuer != v.expectedIssuer {
       slog.Error(
          "authn.GcpIdentifyPlatformAuthenticator, invalid token issuer",
@@ -128,10 +716,94 @@ func (v *GcpIdentifyPlatformAuthenticator) Authenticate(
       return nil, status.Error(codes.Unauthenticated, "Invalid token issuer")
    }
 
-   slog.Debug("successfully authenticated",
-      "subject", payload.Subject,
-      "email", payload.Claims["email"],
-   )
+   if latest := time.Now().Add(v.clockSkew); payload.IssuedAt > latest.Unix() {
+      slog.Error(
+         "authn.GcpIdentifyPlatformAuthenticator, token issued in the future",
+         "issued_at", payload.IssuedAt,
+         "clock_skew", v.clockSkew.String(),
+      )
+
+      return nil, status.Error(
+         codes.Unauthenticated, "Authentication token not yet valid",
+      )
+   }
+
+   if v.tenantID != "" {
+      if tenant := tokenTenant(payload); tenant != v.tenantID {
+         slog.Error(
+            "authn.GcpIdentifyPlatformAuthenticator, invalid token tenant",
+            "expected", v.tenantID,
+            "actual", tenant,
+         )
+
+         return nil, status.Error(
+            codes.Unauthenticated, "Invalid token tenant",
+         )
+      }
+   }
+
+   if v.denyAnonymous &&
+      firebaseClaim(payload, "sign_in_provider") == anonymousProvider {
+      slog.Error(
+         "authn.GcpIdentifyPlatformAuthenticator, anonymous identity denied",
+         "subject", payload.Subject,
+      )
+
+      return nil, status.Error(
+         codes.PermissionDenied, "Anonymous identities not allowed",
+      )
+   }
+
+   if v.allowedProviders != nil {
+      provider := firebaseClaim(payload, "sign_in_provider")
+      if !v.allowedProviders[provider] {
+         slog.Error(
+            "authn.GcpIdentifyPlatformAuthenticator, sign-in provider denied",
+            "subject", payload.Subject,
+            "sign_in_provider", provider,
+         )
+
+         return nil, statusWithReason(
+            ctx,
+            codes.PermissionDenied,
+            "Sign-in provider not allowed",
+            ReasonSignInProviderNotAllowed,
+            map[string]string{"sign_in_provider": provider},
+         )
+      }
+   }
+
+   if v.requireVerified {
+      if verified, _ := payload.Claims["email_verified"].(bool); !verified {
+         slog.Error(
+            "authn.GcpIdentifyPlatformAuthenticator, email not verified",
+            "subject", payload.Subject,
+         )
+
+         return nil, status.Error(
+            codes.PermissionDenied, "Email address not verified",
+         )
+      }
+   }
+
+   return payload, nil
+}
+
+// tokenTenant returns the Identity Platform tenant of the token, held in the
+// tenant field of the firebase claim, or "" when the token has none.
+func tokenTenant(payload *idtoken.Payload) string {
+   return firebaseClaim(payload, "tenant")
+}
+
+// firebaseClaim returns the named string field of the firebase claim of the
+// token, or "" when it has none.
+func firebaseClaim(payload *idtoken.Payload, name string) string {
+   firebase, ok := payload.Claims["firebase"].(map[string]any)
+   if !ok {
+      return ""
+   }
+
+   val, _ := firebase[name].(string)
 
-   return context.WithValue(ctx, ClaimsContextKey, payload.Claims), nil
+   return val
 }
@@ -0,0 +1,1406 @@
+package authn_test
+
+import (
+   "bytes"
+   "context"
+   "errors"
+   "log/slog"
+   "os"
+   "path/filepath"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/api/idtoken"
+   "google.golang.org/genproto/googleapis/rpc/errdetails"
+   "google.golang.org/grpc"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/metadata"
+   "google.golang.org/grpc/status"
+)
+
+const (
+   healthCheckMethod = "/grpc.health.v1.Health/Check"
+   reflectionMethod  = "/grpc.reflection.v1.ServerReflection/" +
+      "ServerReflectionInfo"
+)
+
+// fakeTransportStream allows grpc.Method to resolve the method of a test
+// context.
+type fakeTransportStream struct {
+   method  string
+   trailer metadata.MD
+}
+
+func (s *fakeTransportStream) Method() string { return s.method }
+
+func (s *fakeTransportStream) SetHeader(metadata.MD) error { return nil }
+
+func (s *fakeTransportStream) SendHeader(metadata.MD) error { return nil }
+
+func (s *fakeTransportStream) SetTrailer(md metadata.MD) error {
+   s.trailer = metadata.Join(s.trailer, md)
+   return nil
+}
+
+// methodContext returns a context for an incoming call to method carrying
+// the supplied metadata key/value pairs.
+func methodContext(method string, kv ...string) context.Context {
+   ctx := metadata.NewIncomingContext(
+      context.Background(), metadata.Pairs(kv...),
+   )
+
+   return grpc.NewContextWithServerTransportStream(
+      ctx, &fakeTransportStream{method: method},
+   )
+}
+
+func newTestConfig() authn.GcpIdentifyPlatformAuthenticatorConfig {
+   return authn.GcpIdentifyPlatformAuthenticatorConfig{
+      ExpectedAudience: "my-project",
+      GcpProjectId:     "my-project",
+   }
+}
+
+func TestAuthenticate_HealthAndReflectionAllowed_ShouldBypassAuth(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.AllowHealthAndReflection = true
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(&fakeValidator{}),
+   )
+   require.NoError(t, err)
+
+   for _, method := range []string{healthCheckMethod, reflectionMethod} {
+      ctx := methodContext(method)
+
+      got, err := v.Authenticate(ctx)
+      assert.NoError(t, err)
+      assert.Equal(t, ctx, got)
+   }
+}
+
+func TestAuthenticate_HealthAndReflectionDisabled_ShouldRequireAuth(
+   t *testing.T,
+) {
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(&fakeValidator{}),
+   )
+   require.NoError(t, err)
+
+   for _, method := range []string{healthCheckMethod, reflectionMethod} {
+      _, err := v.Authenticate(methodContext(method))
+      assert.Equal(t, codes.Unauthenticated, status.Code(err))
+   }
+}
+
+func TestAuthenticate_PublicMethodForms_ShouldBypassAuth(t *testing.T) {
+   tests := []struct {
+      name       string
+      registered string
+   }{
+      {name: "canonical", registered: "/acme.v1.Service/Get"},
+      {name: "no leading slash", registered: "acme.v1.Service/Get"},
+      {name: "dot notation", registered: "acme.v1.Service.Get"},
+      {name: "slash and dots", registered: "/acme.v1.Service.Get"},
+      {name: "surrounding space", registered: " /acme.v1.Service/Get "},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            newTestConfig(),
+            map[string]bool{tt.registered: true},
+            authn.WithTokenValidator(&fakeValidator{}),
+         )
+         require.NoError(t, err)
+
+         ctx := methodContext("/acme.v1.Service/Get")
+         got, err := v.Authenticate(ctx)
+         assert.NoError(t, err)
+         assert.Equal(t, ctx, got)
+
+         _, err = v.Authenticate(methodContext("/acme.v1.Service/Put"))
+         assert.Equal(t, codes.Unauthenticated, status.Code(err))
+      })
+   }
+}
+
+func TestAuthenticate_HealthAllowed_ShouldKeepCallerPublicMethods(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.AllowHealthAndReflection = true
+   public := map[string]bool{"/acme.v1.Service/Ping": true}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, public, authn.WithTokenValidator(&fakeValidator{}),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext("/acme.v1.Service/Ping"))
+   assert.NoError(t, err)
+   assert.Len(t, public, 1)
+}
+
+// fakeValidator is an authn.TokenValidator returning a fixed result.
+type fakeValidator struct {
+   payload *idtoken.Payload
+   err     error
+}
+
+func (f *fakeValidator) Validate(
+   context.Context,
+   string,
+   string,
+) (*idtoken.Payload, error) {
+   return f.payload, f.err
+}
+
+// errorInfo returns the ErrorInfo in the status details of err, if any.
+func errorInfo(err error) *errdetails.ErrorInfo {
+   for _, detail := range status.Convert(err).Details() {
+      if info, ok := detail.(*errdetails.ErrorInfo); ok {
+         return info
+      }
+   }
+
+   return nil
+}
+
+// errorReason returns the ErrorInfo reason in the status details of err.
+func errorReason(err error) string {
+   return errorInfo(err).GetReason()
+}
+
+func TestAuthenticate_ExpiredTokenWithHint_ShouldReturnExpiredReason(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.ExpiryRefreshHint = true
+   validator := &fakeValidator{
+      err: errors.New("idtoken: token expired: now=2, expires=1"),
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   stream := &fakeTransportStream{method: "/acme.v1.Service/Get"}
+   ctx := grpc.NewContextWithServerTransportStream(
+      metadata.NewIncomingContext(
+         context.Background(),
+         metadata.Pairs("authorization", "Bearer token"),
+      ),
+      stream,
+   )
+
+   _, err = v.Authenticate(ctx)
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+   assert.Equal(t, authn.ReasonTokenExpired, errorReason(err))
+   assert.Equal(t, []string{authn.ReasonTokenExpired},
+      stream.trailer.Get(authn.ReasonTrailerKey),
+   )
+}
+
+func TestAuthenticate_InvalidTokenWithHint_ShouldReturnNoReason(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.ExpiryRefreshHint = true
+   validator := &fakeValidator{err: errors.New("idtoken: invalid token")}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(
+      methodContext("/acme.v1.Service/Get", "authorization", "Bearer token"),
+   )
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+   assert.Empty(t, errorReason(err))
+}
+
+func TestAuthenticate_ExpiredTokenWithoutHint_ShouldReturnNoReason(
+   t *testing.T,
+) {
+   validator := &fakeValidator{
+      err: errors.New("idtoken: token expired: now=2, expires=1"),
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(
+      methodContext("/acme.v1.Service/Get", "authorization", "Bearer token"),
+   )
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+   assert.Empty(t, errorReason(err))
+}
+
+func TestAuthenticate_AudienceMismatch_ShouldReturnExpectedAudience(
+   t *testing.T,
+) {
+   validator := &fakeValidator{
+      err: errors.New(
+         "idtoken: audience provided does not match aud claim in the JWT",
+      ),
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(
+      methodContext("/acme.v1.Service/Get", "authorization", "Bearer token"),
+   )
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+   assert.Equal(t, authn.ReasonAudienceMismatch, errorReason(err))
+
+   info := errorInfo(err)
+   require.NotNil(t, info)
+   assert.Equal(t, map[string]string{"expected_audience": "my-project"},
+      info.Metadata,
+   )
+}
+
+func TestNewGcpIdentityPlatformValidator_ExplicitProject_ShouldNotLookup(
+   t *testing.T,
+) {
+   looked := false
+   resolver := func(context.Context) (string, error) {
+      looked = true
+      return "other-project", nil
+   }
+   validator := &fakeValidator{
+      payload: &idtoken.Payload{
+         Issuer: "https://securetoken.google.com/my-project",
+      },
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithProjectIDResolver(resolver),
+      authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+   assert.False(t, looked)
+
+   _, err = v.Authenticate(
+      methodContext("/acme.v1.Service/Get", "authorization", "Bearer token"),
+   )
+   assert.NoError(t, err)
+}
+
+func TestNewGcpIdentityPlatformValidator_MetadataFallback_ShouldUseProject(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.GcpProjectId = ""
+   resolver := func(ctx context.Context) (string, error) {
+      _, hasDeadline := ctx.Deadline()
+      assert.True(t, hasDeadline)
+
+      return "metadata-project", nil
+   }
+   validator := &fakeValidator{
+      payload: &idtoken.Payload{
+         Issuer: "https://securetoken.google.com/metadata-project",
+      },
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf,
+      nil,
+      authn.WithProjectIDResolver(resolver),
+      authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(
+      methodContext("/acme.v1.Service/Get", "authorization", "Bearer token"),
+   )
+   assert.NoError(t, err)
+}
+
+func TestNewGcpIdentityPlatformValidator_LookupFails_ShouldReturnMissing(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.GcpProjectId = ""
+   resolver := func(context.Context) (string, error) {
+      return "", errors.New("metadata unavailable")
+   }
+
+   _, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithProjectIDResolver(resolver),
+   )
+   assert.ErrorIs(t, err, authn.ErrProjectIdMissing)
+
+   _, err = authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithProjectIDResolver(nil),
+   )
+   assert.ErrorIs(t, err, authn.ErrProjectIdMissing)
+}
+
+// recordingValidator is an authn.TokenValidator that records the audience it
+// was asked to enforce and the number of calls.
+type recordingValidator struct {
+   fakeValidator
+   audience string
+   calls    int
+}
+
+func (r *recordingValidator) Validate(
+   ctx context.Context,
+   token string,
+   audience string,
+) (*idtoken.Payload, error) {
+   r.audience = audience
+   r.calls++
+
+   return r.fakeValidator.Validate(ctx, token, audience)
+}
+
+func TestAuthenticate_AudienceValidator_ShouldAcceptAndReject(t *testing.T) {
+   conf := newTestConfig()
+   conf.ExpectedAudience = ""
+   allowed := map[string]bool{"tenant-a": true}
+
+   tests := []struct {
+      audience string
+      wantCode codes.Code
+   }{
+      {audience: "tenant-a", wantCode: codes.OK},
+      {audience: "tenant-b", wantCode: codes.Unauthenticated},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.audience, func(t *testing.T) {
+         validator := &recordingValidator{
+            fakeValidator: fakeValidator{
+               payload: &idtoken.Payload{
+                  Issuer:   "https://securetoken.google.com/my-project",
+                  Audience: tt.audience,
+               },
+            },
+         }
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf,
+            nil,
+            authn.WithTokenValidator(validator),
+            authn.WithAudienceValidator(func(aud string) bool {
+               return allowed[aud]
+            }),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.Equal(t, tt.wantCode, status.Code(err))
+         assert.Empty(t, validator.audience)
+
+         if tt.wantCode != codes.OK {
+            assert.Equal(t, authn.ReasonAudienceMismatch, errorReason(err))
+         }
+      })
+   }
+}
+
+func TestAuthenticate_MutatedClaims_ShouldNotAffectStoredClaims(
+   t *testing.T,
+) {
+   payload := &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Claims: map[string]any{
+         "email":  "a@acme.com",
+         "groups": []any{"admins"},
+      },
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithTokenValidator(&fakeValidator{payload: payload}),
+   )
+   require.NoError(t, err)
+
+   ctx, err := v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   require.NoError(t, err)
+
+   claims, ok := authn.Claims(ctx)
+   require.True(t, ok)
+   claims["email"] = "mallory@acme.com"
+   claims["groups"].([]any)[0] = "root"
+
+   again, ok := authn.Claims(ctx)
+   require.True(t, ok)
+   assert.Equal(t, "a@acme.com", again["email"])
+   assert.Equal(t, []any{"admins"}, again["groups"])
+   assert.Equal(t, "a@acme.com", payload.Claims["email"])
+   assert.Equal(t, []any{"admins"}, payload.Claims["groups"])
+}
+
+func TestValidate_ValidToken_ShouldReturnPayload(t *testing.T) {
+   payload := &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Subject:  "user-1",
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithTokenValidator(&fakeValidator{payload: payload}),
+   )
+   require.NoError(t, err)
+
+   got, err := v.Validate(context.Background(), "token")
+   assert.NoError(t, err)
+   assert.Equal(t, payload, got)
+}
+
+func TestValidate_Failures_ShouldReturnUnauthenticated(t *testing.T) {
+   tests := []struct {
+      name      string
+      validator *fakeValidator
+   }{
+      {
+         name:      "validation error",
+         validator: &fakeValidator{err: errors.New("idtoken: bad signature")},
+      },
+      {
+         name: "wrong issuer",
+         validator: &fakeValidator{payload: &idtoken.Payload{
+            Issuer:   "https://accounts.google.com",
+            Audience: "my-project",
+         }},
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            newTestConfig(), nil, authn.WithTokenValidator(tt.validator),
+         )
+         require.NoError(t, err)
+
+         got, err := v.Validate(context.Background(), "token")
+         assert.Equal(t, codes.Unauthenticated, status.Code(err))
+         assert.Nil(t, got)
+      })
+   }
+}
+
+// fetchingValidator is a fakeValidator whose keys are fetched at startup.
+type fetchingValidator struct {
+   fakeValidator
+   fetchErr error
+   fetches  int
+}
+
+func (f *fetchingValidator) FetchKeys(context.Context) error {
+   f.fetches++
+   return f.fetchErr
+}
+
+func TestNewGcpIdentityPlatformValidator_KeyFetch_ShouldRunAtStartup(
+   t *testing.T,
+) {
+   fetchErr := errors.New("fetch signing keys: connection refused")
+
+   tests := []struct {
+      name     string
+      fetchErr error
+   }{
+      {name: "keys fetched"},
+      {name: "keys unreachable", fetchErr: fetchErr},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         validator := &fetchingValidator{fetchErr: tt.fetchErr}
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            newTestConfig(),
+            nil,
+            authn.WithValidatorFactory(
+               func(context.Context) (authn.TokenValidator, error) {
+                  return validator, nil
+               },
+            ),
+         )
+         assert.Equal(t, 1, validator.fetches)
+         if tt.fetchErr == nil {
+            assert.NoError(t, err)
+            assert.NotNil(t, v)
+            return
+         }
+
+         assert.ErrorIs(t, err, authn.ErrValidatorInit)
+         assert.ErrorIs(t, err, tt.fetchErr)
+         assert.Nil(t, v)
+      })
+   }
+}
+
+func TestNewGcpIdentityPlatformValidator_ValidatorInitFails_ShouldError(
+   t *testing.T,
+) {
+   initErr := errors.New("fetch certs: connection refused")
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithValidatorFactory(
+         func(context.Context) (authn.TokenValidator, error) {
+            return nil, initErr
+         },
+      ),
+   )
+   assert.ErrorIs(t, err, authn.ErrValidatorInit)
+   assert.ErrorIs(t, err, initErr)
+   assert.Nil(t, v)
+}
+
+func TestNewGcpIdentityPlatformValidator_ValidatorFactory_ShouldCreateOnce(
+   t *testing.T,
+) {
+   calls := 0
+   validator := &fakeValidator{payload: &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+   }}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithValidatorFactory(
+         func(context.Context) (authn.TokenValidator, error) {
+            calls++
+            return validator, nil
+         },
+      ),
+   )
+   require.NoError(t, err)
+
+   for i := 0; i < 2; i++ {
+      _, err = v.Authenticate(methodContext(
+         "/acme.v1.Service/Get", "authorization", "Bearer token",
+      ))
+      assert.NoError(t, err)
+   }
+   assert.Equal(t, 1, calls)
+}
+
+func TestAuthenticate_MaxTokenSize_ShouldRejectOversizedTokens(t *testing.T) {
+   payload := &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+   }
+   validator := &recordingValidator{
+      fakeValidator: fakeValidator{payload: payload},
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithTokenValidator(validator),
+      authn.WithMaxTokenSize(10),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer 0123456789",
+   ))
+   assert.NoError(t, err)
+
+   validator.calls = 0
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer 0123456789a",
+   ))
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+   assert.Equal(t, authn.ReasonTokenTooLarge, errorReason(err))
+   assert.Equal(t, "10", errorInfo(err).Metadata["max_token_size"])
+   assert.Zero(t, validator.calls)
+}
+
+func TestAuthenticate_TenantConfigured_ShouldEnforceTenant(t *testing.T) {
+   tests := []struct {
+      name     string
+      claims   map[string]any
+      wantCode codes.Code
+   }{
+      {
+         name: "matching tenant",
+         claims: map[string]any{
+            "firebase": map[string]any{"tenant": "tenant-a"},
+         },
+         wantCode: codes.OK,
+      },
+      {
+         name: "mismatching tenant",
+         claims: map[string]any{
+            "firebase": map[string]any{"tenant": "tenant-b"},
+         },
+         wantCode: codes.Unauthenticated,
+      },
+      {
+         name: "missing tenant",
+         claims: map[string]any{
+            "firebase": map[string]any{"sign_in_provider": "password"},
+         },
+         wantCode: codes.Unauthenticated,
+      },
+      {
+         name:     "missing firebase claim",
+         claims:   map[string]any{},
+         wantCode: codes.Unauthenticated,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.TenantID = "tenant-a"
+         validator := &fakeValidator{payload: &idtoken.Payload{
+            Issuer:   "https://securetoken.google.com/my-project",
+            Audience: "my-project",
+            Claims:   tt.claims,
+         }}
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(validator),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.Equal(t, tt.wantCode, status.Code(err))
+      })
+   }
+}
+
+func TestAuthenticate_NoTenantConfigured_ShouldAcceptAnyTenant(
+   t *testing.T,
+) {
+   validator := &fakeValidator{payload: &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Claims: map[string]any{
+         "firebase": map[string]any{"tenant": "tenant-b"},
+      },
+   }}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   assert.NoError(t, err)
+}
+
+func TestAuthenticate_TenantConfiguredPublicMethod_ShouldSkipTenant(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.TenantID = "tenant-a"
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf,
+      map[string]bool{"/acme.v1.Service/Ping": true},
+      authn.WithTokenValidator(&fakeValidator{}),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext("/acme.v1.Service/Ping"))
+   assert.NoError(t, err)
+}
+
+// captureDefaultLogs routes slog.Default() to the returned buffer at debug
+// level for the duration of the test.
+func captureDefaultLogs(t *testing.T) *bytes.Buffer {
+   t.Helper()
+
+   var buf bytes.Buffer
+   previous := slog.Default()
+   slog.SetDefault(slog.New(slog.NewTextHandler(
+      &buf, &slog.HandlerOptions{Level: slog.LevelDebug},
+   )))
+   t.Cleanup(func() { slog.SetDefault(previous) })
+
+   return &buf
+}
+
+func TestAuthenticate_NoEmailClaim_ShouldLogSubjectOnly(t *testing.T) {
+   logs := captureDefaultLogs(t)
+   validator := &fakeValidator{payload: &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Subject:  "112233445566",
+      Claims:   map[string]any{"azp": "robot@acme.iam.gserviceaccount.com"},
+   }}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   require.NoError(t, err)
+   assert.Contains(t, logs.String(), "subject=112233445566")
+   assert.NotContains(t, logs.String(), "email=")
+}
+
+func TestAuthenticate_EmailClaim_ShouldLogEmail(t *testing.T) {
+   logs := captureDefaultLogs(t)
+   validator := &fakeValidator{payload: &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Subject:  "user-1",
+      Claims:   map[string]any{"email": "a@acme.com"},
+   }}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   require.NoError(t, err)
+   assert.Contains(t, logs.String(), "email=a@acme.com")
+}
+
+func TestAuthenticate_RequireEmailVerified_ShouldCheckClaim(t *testing.T) {
+   tests := []struct {
+      name     string
+      claims   map[string]any
+      wantCode codes.Code
+   }{
+      {
+         name:     "verified",
+         claims:   map[string]any{"email_verified": true},
+         wantCode: codes.OK,
+      },
+      {
+         name:     "unverified",
+         claims:   map[string]any{"email_verified": false},
+         wantCode: codes.PermissionDenied,
+      },
+      {
+         name:     "missing claim",
+         claims:   map[string]any{},
+         wantCode: codes.PermissionDenied,
+      },
+      {
+         name:     "string claim",
+         claims:   map[string]any{"email_verified": "true"},
+         wantCode: codes.PermissionDenied,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.RequireEmailVerified = true
+         validator := &fakeValidator{payload: &idtoken.Payload{
+            Issuer:   "https://securetoken.google.com/my-project",
+            Audience: "my-project",
+            Claims:   tt.claims,
+         }}
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(validator),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.Equal(t, tt.wantCode, status.Code(err))
+      })
+   }
+}
+
+func TestAuthenticate_EmailVerifiedNotRequired_ShouldAcceptUnverified(
+   t *testing.T,
+) {
+   validator := &fakeValidator{payload: &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Claims:   map[string]any{"email_verified": false},
+   }}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   assert.NoError(t, err)
+}
+
+func TestNewGcpIdentityPlatformValidator_AudienceFromProject_ShouldDerive(
+   t *testing.T,
+) {
+   tests := []struct {
+      name     string
+      audience string
+      want     string
+   }{
+      {name: "derived audience", audience: "", want: "my-project"},
+      {name: "explicit audience", audience: "custom-aud", want: "custom-aud"},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.ExpectedAudience = tt.audience
+         conf.AudienceFromProject = true
+         validator := &recordingValidator{
+            fakeValidator: fakeValidator{payload: &idtoken.Payload{
+               Issuer:   "https://securetoken.google.com/my-project",
+               Audience: tt.want,
+            }},
+         }
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(validator),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.NoError(t, err)
+         assert.Equal(t, tt.want, validator.audience)
+      })
+   }
+}
+
+func TestNewGcpIdentityPlatformValidator_NoAudience_ShouldReturnMissing(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.ExpectedAudience = ""
+
+   _, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(&fakeValidator{}),
+   )
+   assert.ErrorIs(t, err, authn.ErrExpectedAudMissing)
+}
+
+func TestNewGcpIdentityPlatformValidator_AudienceFile_ShouldLoadAudience(
+   t *testing.T,
+) {
+   path := filepath.Join(t.TempDir(), "audience")
+   require.NoError(t, os.WriteFile(path, []byte("file-aud\n"), 0o600))
+
+   conf := newTestConfig()
+   conf.ExpectedAudience = ""
+   conf.ExpectedAudienceFile = path
+   validator := &recordingValidator{
+      fakeValidator: fakeValidator{payload: &idtoken.Payload{
+         Issuer:   "https://securetoken.google.com/my-project",
+         Audience: "file-aud",
+      }},
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   assert.NoError(t, err)
+   assert.Equal(t, "file-aud", validator.audience)
+}
+
+func TestNewGcpIdentityPlatformValidator_BadAudienceFile_ShouldReturnErr(
+   t *testing.T,
+) {
+   empty := filepath.Join(t.TempDir(), "empty")
+   require.NoError(t, os.WriteFile(empty, []byte(" \n"), 0o600))
+
+   tests := []struct {
+      name string
+      path string
+   }{
+      {name: "missing file", path: filepath.Join(t.TempDir(), "missing")},
+      {name: "empty file", path: empty},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.ExpectedAudience = ""
+         conf.ExpectedAudienceFile = tt.path
+         conf.AudienceFromProject = true
+
+         _, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(&fakeValidator{}),
+         )
+         assert.ErrorIs(t, err, authn.ErrAudienceFile)
+         assert.Contains(t, err.Error(), tt.path)
+      })
+   }
+}
+
+func TestAuthenticate_SignInProviders_ShouldApplyAnonymousPolicy(
+   t *testing.T,
+) {
+   phoneClaims := map[string]any{
+      "phone_number": "+15555550100",
+      "firebase":     map[string]any{"sign_in_provider": "phone"},
+   }
+   anonymousClaims := map[string]any{
+      "firebase": map[string]any{"sign_in_provider": "anonymous"},
+   }
+
+   tests := []struct {
+      name          string
+      claims        map[string]any
+      denyAnonymous bool
+      wantCode      codes.Code
+   }{
+      {name: "phone", claims: phoneClaims, wantCode: codes.OK},
+      {
+         name:          "phone with anonymous denied",
+         claims:        phoneClaims,
+         denyAnonymous: true,
+         wantCode:      codes.OK,
+      },
+      {
+         name:     "anonymous allowed",
+         claims:   anonymousClaims,
+         wantCode: codes.OK,
+      },
+      {
+         name:          "anonymous denied",
+         claims:        anonymousClaims,
+         denyAnonymous: true,
+         wantCode:      codes.PermissionDenied,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.DenyAnonymous = tt.denyAnonymous
+         validator := &fakeValidator{payload: &idtoken.Payload{
+            Issuer:   "https://securetoken.google.com/my-project",
+            Audience: "my-project",
+            Subject:  "user-1",
+            Claims:   tt.claims,
+         }}
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(validator),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.Equal(t, tt.wantCode, status.Code(err))
+      })
+   }
+}
+
+func TestAuthenticate_AllowedSignInProviders_ShouldEnforceProvider(
+   t *testing.T,
+) {
+   tests := []struct {
+      name     string
+      claims   map[string]any
+      wantCode codes.Code
+      wantMeta string
+   }{
+      {
+         name: "allowed provider",
+         claims: map[string]any{
+            "firebase": map[string]any{"sign_in_provider": "password"},
+         },
+         wantCode: codes.OK,
+      },
+      {
+         name: "disallowed provider",
+         claims: map[string]any{
+            "firebase": map[string]any{"sign_in_provider": "github.com"},
+         },
+         wantCode: codes.PermissionDenied,
+         wantMeta: "github.com",
+      },
+      {
+         name:     "missing provider claim",
+         claims:   map[string]any{},
+         wantCode: codes.PermissionDenied,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.AllowedSignInProviders = []string{"google.com", "password"}
+         validator := &fakeValidator{payload: &idtoken.Payload{
+            Issuer:   "https://securetoken.google.com/my-project",
+            Audience: "my-project",
+            Claims:   tt.claims,
+         }}
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(validator),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.Equal(t, tt.wantCode, status.Code(err))
+         if tt.wantCode == codes.OK {
+            return
+         }
+
+         info := errorInfo(err)
+         if assert.NotNil(t, info) {
+            assert.Equal(t, authn.ReasonSignInProviderNotAllowed, info.Reason)
+            assert.Equal(t, tt.wantMeta, info.Metadata["sign_in_provider"])
+         }
+      })
+   }
+}
+
+func TestAuthenticate_AllowedSignInProvidersPublicMethod_ShouldBypass(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.AllowedSignInProviders = []string{"password"}
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, map[string]bool{"/acme.v1.Service/Get": true},
+      authn.WithTokenValidator(&fakeValidator{}),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext("/acme.v1.Service/Get"))
+   assert.NoError(t, err)
+}
+
+func TestAuthenticate_ExpectedAudiencesFromEnv_ShouldAcceptListed(
+   t *testing.T,
+) {
+   t.Setenv("GCP_PROJECT_ID", "my-project")
+   t.Setenv("GCP_TOKEN_EXPECTED_AUDIENCES", "web-app, mobile-app")
+
+   var conf authn.GcpIdentifyPlatformAuthenticatorConfig
+   require.NoError(t, environ.Unmarshal(&conf))
+   assert.Equal(t, []string{"web-app", " mobile-app"}, conf.ExpectedAudiences)
+
+   tests := []struct {
+      audience string
+      wantCode codes.Code
+   }{
+      {audience: "web-app", wantCode: codes.OK},
+      {audience: "mobile-app", wantCode: codes.OK},
+      {audience: "other-app", wantCode: codes.Unauthenticated},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.audience, func(t *testing.T) {
+         validator := &recordingValidator{
+            fakeValidator: fakeValidator{payload: &idtoken.Payload{
+               Issuer:   "https://securetoken.google.com/my-project",
+               Audience: tt.audience,
+            }},
+         }
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(validator),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(methodContext(
+            "/acme.v1.Service/Get", "authorization", "Bearer token",
+         ))
+         assert.Equal(t, tt.wantCode, status.Code(err))
+         assert.Empty(t, validator.audience)
+
+         if tt.wantCode != codes.OK {
+            assert.Equal(t, authn.ReasonAudienceMismatch, errorReason(err))
+            assert.Equal(t, "web-app,mobile-app",
+               errorInfo(err).GetMetadata()["expected_audience"],
+            )
+         }
+      })
+   }
+}
+
+func TestNewGcpIdentityPlatformValidator_SingleListedAudience_ShouldBeStrict(
+   t *testing.T,
+) {
+   conf := newTestConfig()
+   conf.ExpectedAudiences = []string{"my-project", ""}
+   validator := &recordingValidator{
+      fakeValidator: fakeValidator{payload: &idtoken.Payload{
+         Issuer:   "https://securetoken.google.com/my-project",
+         Audience: "my-project",
+      }},
+   }
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer token",
+   ))
+   assert.NoError(t, err)
+   assert.Equal(t, "my-project", validator.audience)
+}
+
+func TestNewGcpIdentityPlatformValidator_FullConfigFromEnv_ShouldApply(
+   t *testing.T,
+) {
+   vars := map[string]string{
+      "GCP_TOKEN_EXPECTED_AUDIENCE":          "my-project",
+      "GCP_TOKEN_EXPECTED_AUDIENCES":         "web-app,mobile-app",
+      "GCP_TOKEN_EXPECTED_AUDIENCE_FILE":     "/etc/auth/audience",
+      "GCP_AUTH_AUDIENCE_FROM_PROJECT":       "true",
+      "GCP_PROJECT_ID":                       "my-project",
+      "GCP_AUTH_ALLOW_HEALTH_AND_REFLECTION": "true",
+      "GCP_AUTH_EXPIRY_REFRESH_HINT":         "true",
+      "GCP_AUTH_TENANT_ID":                   "tenant-a",
+      "GCP_AUTH_REQUIRE_EMAIL_VERIFIED":      "true",
+      "GCP_AUTH_DENY_ANONYMOUS":              "true",
+      "GCP_AUTH_ALLOWED_SIGN_IN_PROVIDERS":   "google.com,password",
+      "GCP_AUTH_MAX_TOKEN_SIZE":              "8",
+      "GCP_AUTH_TRUSTED_UNIX_SOCKET":         "/run/acme/sidecar.sock",
+      "GCP_AUTH_TRUSTED_SUBJECT":             "sidecar",
+      "GCP_AUTH_CLOCK_SKEW":                  "30s",
+   }
+   for name, val := range vars {
+      t.Setenv(name, val)
+   }
+
+   var conf authn.GcpIdentifyPlatformAuthenticatorConfig
+   require.NoError(t, environ.Unmarshal(&conf))
+   assert.Equal(t, authn.GcpIdentifyPlatformAuthenticatorConfig{
+      ExpectedAudience:         "my-project",
+      ExpectedAudiences:        []string{"web-app", "mobile-app"},
+      ExpectedAudienceFile:     "/etc/auth/audience",
+      AudienceFromProject:      true,
+      GcpProjectId:             "my-project",
+      AllowHealthAndReflection: true,
+      ExpiryRefreshHint:        true,
+      TenantID:                 "tenant-a",
+      RequireEmailVerified:     true,
+      DenyAnonymous:            true,
+      AllowedSignInProviders:   []string{"google.com", "password"},
+      MaxTokenSize:             8,
+      TrustedUnixSocket:        "/run/acme/sidecar.sock",
+      TrustedSubject:           "sidecar",
+      ClockSkew:                30 * time.Second,
+   }, conf)
+
+   payload := &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "web-app",
+      IssuedAt: time.Now().Add(20 * time.Second).Unix(),
+      Claims: map[string]any{
+         "email_verified": true,
+         "firebase": map[string]any{
+            "tenant":           "tenant-a",
+            "sign_in_provider": "password",
+         },
+      },
+   }
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithTokenValidator(&fakeValidator{payload: payload}),
+   )
+   require.NoError(t, err)
+
+   // MaxTokenSize from the config rejects the oversized token.
+   _, err = v.Authenticate(methodContext(
+      "/acme.v1.Service/Get", "authorization", "Bearer oversized-token",
+   ))
+   assert.Equal(t, authn.ReasonTokenTooLarge, errorReason(err))
+
+   // ClockSkew from the config accepts the token issued 20s ahead.
+   _, err = v.Validate(context.Background(), "token")
+   assert.NoError(t, err)
+}
+
+func TestNewGcpIdentityPlatformValidator_ConfigCombinations_ShouldValidate(
+   t *testing.T,
+) {
+   tests := []struct {
+      name    string
+      modify  func(*authn.GcpIdentifyPlatformAuthenticatorConfig)
+      wantErr error
+   }{
+      {
+         name:   "minimal config",
+         modify: func(*authn.GcpIdentifyPlatformAuthenticatorConfig) {},
+      },
+      {
+         name: "audiences list only",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.ExpectedAudience = ""
+            c.ExpectedAudiences = []string{"web-app", "mobile-app"}
+         },
+      },
+      {
+         name: "trusted socket with subject",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.TrustedUnixSocket = "/run/acme/sidecar.sock"
+            c.TrustedSubject = "sidecar"
+         },
+      },
+      {
+         name: "no audience",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.ExpectedAudience = ""
+         },
+         wantErr: authn.ErrExpectedAudMissing,
+      },
+      {
+         name: "negative max token size",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.MaxTokenSize = -1
+         },
+         wantErr: authn.ErrInvalidConfig,
+      },
+      {
+         name: "trusted socket without subject",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.TrustedUnixSocket = "/run/acme/sidecar.sock"
+         },
+         wantErr: authn.ErrInvalidConfig,
+      },
+      {
+         name: "trusted subject without socket",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.TrustedSubject = "sidecar"
+         },
+         wantErr: authn.ErrInvalidConfig,
+      },
+      {
+         name: "anonymous allowed and denied",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.DenyAnonymous = true
+            c.AllowedSignInProviders = []string{"password", "anonymous"}
+         },
+         wantErr: authn.ErrInvalidConfig,
+      },
+      {
+         name: "clock skew within range",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.ClockSkew = time.Minute
+         },
+      },
+      {
+         name: "negative clock skew",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.ClockSkew = -time.Second
+         },
+         wantErr: authn.ErrInvalidConfig,
+      },
+      {
+         name: "clock skew too large",
+         modify: func(c *authn.GcpIdentifyPlatformAuthenticatorConfig) {
+            c.ClockSkew = time.Hour
+         },
+         wantErr: authn.ErrInvalidConfig,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         tt.modify(&conf)
+
+         _, err := authn.NewGcpIdentityPlatformValidator(
+            conf, nil, authn.WithTokenValidator(&fakeValidator{}),
+         )
+         if tt.wantErr == nil {
+            assert.NoError(t, err)
+            return
+         }
+         assert.ErrorIs(t, err, tt.wantErr)
+      })
+   }
+}
+
+func TestValidate_IssuedInFuture_ShouldHonorClockSkew(t *testing.T) {
+   tests := []struct {
+      name     string
+      skew     time.Duration
+      issuedIn time.Duration
+      wantErr  bool
+   }{
+      {name: "issued now", issuedIn: 0},
+      {name: "ahead without skew", issuedIn: time.Minute, wantErr: true},
+      {name: "ahead within skew", skew: 2 * time.Minute, issuedIn: time.Minute},
+      {
+         name:     "ahead beyond skew",
+         skew:     30 * time.Second,
+         issuedIn: time.Minute,
+         wantErr:  true,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         conf := newTestConfig()
+         conf.ClockSkew = tt.skew
+         payload := &idtoken.Payload{
+            Issuer:   "https://securetoken.google.com/my-project",
+            Audience: "my-project",
+            IssuedAt: time.Now().Add(tt.issuedIn).Unix(),
+         }
+
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            conf,
+            nil,
+            authn.WithTokenValidator(&fakeValidator{payload: payload}),
+         )
+         require.NoError(t, err)
+
+         _, err = v.Validate(context.Background(), "token")
+         if !tt.wantErr {
+            assert.NoError(t, err)
+            return
+         }
+         assert.Equal(t, codes.Unauthenticated, status.Code(err))
+      })
+   }
+}
@@ -0,0 +1,234 @@
+package authn_test
+
+import (
+   "context"
+   "crypto"
+   "crypto/rand"
+   "crypto/rsa"
+   "crypto/sha256"
+   "encoding/base64"
+   "encoding/json"
+   "fmt"
+   "math/big"
+   "strings"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const testKeyID = "test-key"
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+   t.Helper()
+
+   key, err := rsa.GenerateKey(rand.Reader, 2048)
+   require.NoError(t, err)
+
+   return key
+}
+
+// testJWKS renders key as a single-key JSON Web Key Set named kid.
+func testJWKS(kid string, key *rsa.PublicKey) []byte {
+   return []byte(fmt.Sprintf(
+      `{"keys":[{"kty":"RSA","alg":"RS256","use":"sig","kid":%q,`+
+         `"n":%q,"e":%q}]}`,
+      kid,
+      base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+      base64.RawURLEncoding.EncodeToString(
+         big.NewInt(int64(key.E)).Bytes(),
+      ),
+   ))
+}
+
+// signRS256 mints a token for newTestConfig signed by key, carrying claims
+// over the standard ones.
+func signRS256(
+   t *testing.T,
+   key *rsa.PrivateKey,
+   kid string,
+   claims map[string]any,
+) string {
+   t.Helper()
+
+   body := map[string]any{
+      "iss": "https://securetoken.google.com/my-project",
+      "aud": "my-project",
+      "sub": "user-1",
+      "iat": time.Now().Unix(),
+      "exp": time.Now().Add(time.Hour).Unix(),
+   }
+   for name, val := range claims {
+      body[name] = val
+   }
+
+   encode := func(v any) string {
+      b, err := json.Marshal(v)
+      require.NoError(t, err)
+      return base64.RawURLEncoding.EncodeToString(b)
+   }
+
+   signed := encode(map[string]any{"alg": "RS256", "kid": kid}) + "." +
+      encode(body)
+   digest := sha256.Sum256([]byte(signed))
+   sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+   require.NoError(t, err)
+
+   return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newLocalAuthenticator(
+   t *testing.T,
+   key *rsa.PrivateKey,
+) *authn.GcpIdentifyPlatformAuthenticator {
+   t.Helper()
+
+   keys, err := authn.ParseJWKS(testJWKS(testKeyID, &key.PublicKey))
+   require.NoError(t, err)
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithKeySource(keys),
+   )
+   require.NoError(t, err)
+
+   return v
+}
+
+func TestValidate_LocalKeySource_ShouldVerifySignedToken(t *testing.T) {
+   key := newRSAKey(t)
+   v := newLocalAuthenticator(t, key)
+
+   token := signRS256(t, key, testKeyID, map[string]any{"role": "admin"})
+   payload, err := v.Validate(context.Background(), token)
+   require.NoError(t, err)
+   assert.Equal(t, "user-1", payload.Subject)
+   assert.Equal(t, "admin", payload.Claims["role"])
+}
+
+func TestAuthenticate_LocalKeySource_ShouldStoreClaims(t *testing.T) {
+   key := newRSAKey(t)
+   v := newLocalAuthenticator(t, key)
+
+   token := signRS256(t, key, testKeyID, nil)
+   ctx, err := v.Authenticate(
+      methodContext("/svc/Method", "authorization", "Bearer "+token),
+   )
+   require.NoError(t, err)
+
+   var claims struct {
+      Subject string `json:"sub"`
+   }
+   require.NoError(t, authn.DecodeClaims(ctx, &claims))
+   assert.Equal(t, "user-1", claims.Subject)
+}
+
+func TestValidate_LocalKeySource_ShouldRejectBadTokens(t *testing.T) {
+   key := newRSAKey(t)
+   other := newRSAKey(t)
+   v := newLocalAuthenticator(t, key)
+
+   tests := []struct {
+      name  string
+      token string
+   }{
+      {
+         name:  "signed by another key",
+         token: signRS256(t, other, testKeyID, nil),
+      },
+      {
+         name:  "unknown kid",
+         token: signRS256(t, key, "other-key", nil),
+      },
+      {
+         name: "expired",
+         token: signRS256(t, key, testKeyID, map[string]any{
+            "exp": time.Now().Add(-time.Minute).Unix(),
+         }),
+      },
+      {
+         name: "wrong audience",
+         token: signRS256(t, key, testKeyID, map[string]any{
+            "aud": "other-project",
+         }),
+      },
+      {
+         name:  "malformed",
+         token: "not-a-token",
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         _, err := v.Validate(context.Background(), tt.token)
+         assert.Equal(t, codes.Unauthenticated, status.Code(err))
+      })
+   }
+}
+
+func TestLocalValidator_TamperedPayload_ShouldReturnErrInvalidSignature(
+   t *testing.T,
+) {
+   key := newRSAKey(t)
+   keys := authn.StaticKeySource{testKeyID: &key.PublicKey}
+
+   token := signRS256(t, key, testKeyID, nil)
+   forged := signRS256(t, key, testKeyID, map[string]any{"sub": "admin"})
+   tokenParts := strings.Split(token, ".")
+   forgedParts := strings.Split(forged, ".")
+   tampered := tokenParts[0] + "." + forgedParts[1] + "." + tokenParts[2]
+
+   _, err := authn.NewLocalValidator(keys).Validate(
+      context.Background(), tampered, "my-project",
+   )
+   assert.ErrorIs(t, err, authn.ErrInvalidTokenSignature)
+}
+
+func TestParseJWKS_Malformed_ShouldReturnErrInvalidJWKS(t *testing.T) {
+   tests := []struct {
+      name string
+      data string
+   }{
+      {name: "not json", data: `{`},
+      {name: "no rsa keys", data: `{"keys":[{"kty":"EC","kid":"a"}]}`},
+      {
+         name: "bad modulus",
+         data: `{"keys":[{"kty":"RSA","kid":"a","n":"!","e":"AQAB"}]}`,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         _, err := authn.ParseJWKS([]byte(tt.data))
+         assert.ErrorIs(t, err, authn.ErrInvalidJWKS)
+      })
+   }
+}
+
+func TestValidate_LocalKeySourceExpired_ShouldHonorClockSkew(t *testing.T) {
+   key := newRSAKey(t)
+   keys, err := authn.ParseJWKS(testJWKS(testKeyID, &key.PublicKey))
+   require.NoError(t, err)
+
+   conf := newTestConfig()
+   conf.ClockSkew = time.Minute
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      conf, nil, authn.WithKeySource(keys),
+   )
+   require.NoError(t, err)
+
+   recent := signRS256(t, key, testKeyID, map[string]any{
+      "exp": time.Now().Add(-30 * time.Second).Unix(),
+   })
+   _, err = v.Validate(context.Background(), recent)
+   assert.NoError(t, err)
+
+   stale := signRS256(t, key, testKeyID, map[string]any{
+      "exp": time.Now().Add(-2 * time.Minute).Unix(),
+   })
+   _, err = v.Validate(context.Background(), stale)
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
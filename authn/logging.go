@@ -0,0 +1,77 @@
+package authn
+
+import (
+   "context"
+   "log/slog"
+
+   middleware "github.com/grpc-ecosystem/go-grpc-middleware/v2"
+   "google.golang.org/grpc"
+)
+
+type loggerContextKey struct{}
+
+// LoggerFromContext returns the request logger stored by the logging
+// interceptors, falling back to slog.Default() when none is present.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+   if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+      return logger
+   }
+
+   return slog.Default()
+}
+
+// UnaryLoggingInterceptor attaches the authenticated subject and email to a
+// request logger retrievable with LoggerFromContext. It must be chained after
+// the authentication interceptor; calls without claims, such as public
+// methods, receive the logger unchanged. A nil logger uses slog.Default().
+func UnaryLoggingInterceptor(
+   logger *slog.Logger,
+) grpc.UnaryServerInterceptor {
+   return func(
+      ctx context.Context,
+      req any,
+      _ *grpc.UnaryServerInfo,
+      handler grpc.UnaryHandler,
+   ) (any, error) {
+      return handler(withClaimsLogger(ctx, logger), req)
+   }
+}
+
+// StreamLoggingInterceptor is the streaming counterpart of
+// UnaryLoggingInterceptor.
+func StreamLoggingInterceptor(
+   logger *slog.Logger,
+) grpc.StreamServerInterceptor {
+   return func(
+      srv any,
+      stream grpc.ServerStream,
+      _ *grpc.StreamServerInfo,
+      handler grpc.StreamHandler,
+   ) error {
+      wrapped := middleware.WrapServerStream(stream)
+      wrapped.WrappedContext = withClaimsLogger(stream.Context(), logger)
+
+      return handler(srv, wrapped)
+   }
+}
+
+// withClaimsLogger stores logger in ctx, carrying the claim attributes when
+// the call was authenticated.
+func withClaimsLogger(
+   ctx context.Context,
+   logger *slog.Logger,
+) context.Context {
+   if logger == nil {
+      logger = slog.Default()
+   }
+
+   if sub, ok := ClaimString(ctx, "sub"); ok {
+      logger = logger.With("subject", sub)
+   }
+
+   if email, ok := ClaimString(ctx, "email"); ok {
+      logger = logger.With("email", email)
+   }
+
+   return context.WithValue(ctx, loggerContextKey{}, logger)
+}
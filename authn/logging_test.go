@@ -0,0 +1,58 @@
+package authn_test
+
+import (
+   "bytes"
+   "context"
+   "log/slog"
+   "testing"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc"
+)
+
+// logRequest runs the unary logging interceptor over ctx with a handler that
+// writes a single record, returning the captured output.
+func logRequest(t *testing.T, ctx context.Context) string {
+   t.Helper()
+
+   var buf bytes.Buffer
+   logger := slog.New(slog.NewTextHandler(&buf, nil))
+   interceptor := authn.UnaryLoggingInterceptor(logger)
+
+   _, err := interceptor(
+      ctx,
+      nil,
+      &grpc.UnaryServerInfo{FullMethod: "/acme.v1.Service/Get"},
+      func(ctx context.Context, _ any) (any, error) {
+         authn.LoggerFromContext(ctx).Info("handled")
+         return nil, nil
+      },
+   )
+   require.NoError(t, err)
+
+   return buf.String()
+}
+
+func TestUnaryLoggingInterceptor_Authenticated_ShouldLogSubject(
+   t *testing.T,
+) {
+   ctx := context.WithValue(
+      context.Background(),
+      authn.ClaimsContextKey,
+      map[string]any{"sub": "user-123", "email": "a@acme.com"},
+   )
+
+   out := logRequest(t, ctx)
+   assert.Contains(t, out, "subject=user-123")
+   assert.Contains(t, out, "email=a@acme.com")
+}
+
+func TestUnaryLoggingInterceptor_PublicMethod_ShouldNotLogSubject(
+   t *testing.T,
+) {
+   out := logRequest(t, context.Background())
+   assert.Contains(t, out, "msg=handled")
+   assert.NotContains(t, out, "subject=")
+}
@@ -0,0 +1,91 @@
+package authn
+
+import (
+   "context"
+   "strings"
+
+   "google.golang.org/genproto/googleapis/rpc/errdetails"
+   "google.golang.org/grpc"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/metadata"
+   "google.golang.org/grpc/status"
+)
+
+const (
+   // ReasonTokenExpired is the ErrorInfo reason attached when the bearer
+   // token has expired and should be refreshed.
+   ReasonTokenExpired = "TOKEN_EXPIRED"
+
+   // ReasonAudienceMismatch is the ErrorInfo reason attached when the token
+   // audience differs from the expected audience. The ErrorInfo metadata
+   // carries the expected audience under "expected_audience".
+   ReasonAudienceMismatch = "AUDIENCE_MISMATCH"
+
+   // ReasonTokenTooLarge is the ErrorInfo reason attached when the bearer
+   // token exceeds the configured maximum size. The ErrorInfo metadata
+   // carries the limit under "max_token_size".
+   ReasonTokenTooLarge = "TOKEN_TOO_LARGE"
+
+   // ReasonSignInProviderNotAllowed is the ErrorInfo reason attached when
+   // the token was issued for a sign-in provider outside of
+   // AllowedSignInProviders. The ErrorInfo metadata carries the provider
+   // under "sign_in_provider".
+   ReasonSignInProviderNotAllowed = "SIGN_IN_PROVIDER_NOT_ALLOWED"
+
+   // ReasonTrailerKey is the response trailer carrying the failure reason
+   // for clients that do not decode status details.
+   ReasonTrailerKey = "authn-reason"
+
+   // errorInfoDomain is the ErrorInfo domain of errors raised by authn.
+   errorInfoDomain = "authn.gobackend"
+)
+
+// unauthenticatedWithReason builds an Unauthenticated status carrying an
+// ErrorInfo detail with the supplied reason and metadata, and sets the reason
+// as a response trailer when the context belongs to a gRPC call.
+func unauthenticatedWithReason(
+   ctx context.Context,
+   msg string,
+   reason string,
+   md map[string]string,
+) error {
+   return statusWithReason(ctx, codes.Unauthenticated, msg, reason, md)
+}
+
+// statusWithReason builds a status of code carrying an ErrorInfo detail with
+// the supplied reason and metadata, and sets the reason as a response
+// trailer when the context belongs to a gRPC call.
+func statusWithReason(
+   ctx context.Context,
+   code codes.Code,
+   msg string,
+   reason string,
+   md map[string]string,
+) error {
+   // Setting the trailer fails outside of a gRPC call, which is harmless.
+   _ = grpc.SetTrailer(ctx, metadata.Pairs(ReasonTrailerKey, reason))
+
+   st, err := status.New(code, msg).WithDetails(
+      &errdetails.ErrorInfo{
+         Reason:   reason,
+         Domain:   errorInfoDomain,
+         Metadata: md,
+      },
+   )
+   if err != nil {
+      return status.Error(code, msg)
+   }
+
+   return st.Err()
+}
+
+// isTokenExpired reports whether err is the idtoken expiry failure. The
+// idtoken package does not export a typed error, so the message is checked.
+func isTokenExpired(err error) bool {
+   return strings.Contains(err.Error(), "token expired")
+}
+
+// isAudienceMismatch reports whether err is the idtoken audience failure.
+func isAudienceMismatch(err error) bool {
+   return strings.Contains(err.Error(), "audience provided does not match")
+}
@@ -0,0 +1,105 @@
+package authn
+
+import (
+   "context"
+   "fmt"
+   "strings"
+
+   "google.golang.org/grpc"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// scopeClaims are the claims checked for OAuth scopes, in order.
+var scopeClaims = []string{"scope", "scp"}
+
+// Scopes returns the OAuth scopes granted to the authenticated caller, read
+// from the `scope` or `scp` claim as either a space delimited string or an
+// array of strings.
+func Scopes(ctx context.Context) []string {
+   for _, name := range scopeClaims {
+      if s, ok := ClaimString(ctx, name); ok {
+         return strings.Fields(s)
+      }
+
+      if scopes, ok := ClaimStringSlice(ctx, name); ok {
+         return scopes
+      }
+   }
+
+   return nil
+}
+
+// HasScope reports whether the authenticated caller was granted scope.
+func HasScope(ctx context.Context, scope string) bool {
+   for _, s := range Scopes(ctx) {
+      if s == scope {
+         return true
+      }
+   }
+
+   return false
+}
+
+// RequireScope returns an interceptor rejecting calls to the fully qualified
+// method, e.g. /pkg.Service/Method, with PermissionDenied unless the caller
+// was granted scope. Other methods pass through. method accepts the same
+// forms as the public methods of NewGcpIdentityPlatformValidator, e.g.
+// pkg.Service.Method. It must be chained after the authentication
+// interceptor.
+func RequireScope(method string, scope string) grpc.UnaryServerInterceptor {
+   method = canonicalMethod(method)
+
+   return func(
+      ctx context.Context,
+      req any,
+      info *grpc.UnaryServerInfo,
+      handler grpc.UnaryHandler,
+   ) (any, error) {
+      if err := checkScope(ctx, info.FullMethod, method, scope); err != nil {
+         return nil, err
+      }
+
+      return handler(ctx, req)
+   }
+}
+
+// RequireScopeStream is the streaming counterpart of RequireScope.
+func RequireScopeStream(
+   method string,
+   scope string,
+) grpc.StreamServerInterceptor {
+   method = canonicalMethod(method)
+
+   return func(
+      srv any,
+      ss grpc.ServerStream,
+      info *grpc.StreamServerInfo,
+      handler grpc.StreamHandler,
+   ) error {
+      err := checkScope(ss.Context(), info.FullMethod, method, scope)
+      if err != nil {
+         return err
+      }
+
+      return handler(srv, ss)
+   }
+}
+
+// checkScope returns PermissionDenied when fullMethod is the guarded method
+// and the caller of ctx was not granted scope.
+func checkScope(
+   ctx context.Context,
+   fullMethod string,
+   method string,
+   scope string,
+) error {
+   if canonicalMethod(fullMethod) != method || HasScope(ctx, scope) {
+      return nil
+   }
+
+   return status.Error(
+      codes.PermissionDenied,
+      fmt.Sprintf("missing required scope '%s'", scope),
+   )
+}
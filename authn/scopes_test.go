@@ -0,0 +1,155 @@
+package authn_test
+
+import (
+   "context"
+   "testing"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const testScopedMethod = "/acme.v1.Orders/Cancel"
+
+func TestHasScope_SpaceDelimitedString_ShouldFindScope(t *testing.T) {
+   ctx := claimsContext(map[string]any{
+      "scope": "orders.read orders.write",
+   })
+
+   assert.True(t, authn.HasScope(ctx, "orders.write"))
+   assert.False(t, authn.HasScope(ctx, "orders.admin"))
+}
+
+func TestHasScope_ArrayClaim_ShouldFindScope(t *testing.T) {
+   ctx := claimsContext(map[string]any{
+      "scp": []any{"orders.read", "orders.write"},
+   })
+
+   assert.True(t, authn.HasScope(ctx, "orders.read"))
+   assert.False(t, authn.HasScope(ctx, "orders.admin"))
+}
+
+func TestHasScope_NoClaims_ShouldReturnFalse(t *testing.T) {
+   assert.False(t, authn.HasScope(context.Background(), "orders.read"))
+}
+
+func callScoped(
+   ctx context.Context,
+   method string,
+   interceptor grpc.UnaryServerInterceptor,
+) (bool, error) {
+   called := false
+   _, err := interceptor(
+      ctx,
+      nil,
+      &grpc.UnaryServerInfo{FullMethod: method},
+      func(context.Context, any) (any, error) {
+         called = true
+         return nil, nil
+      },
+   )
+
+   return called, err
+}
+
+func TestRequireScope_ScopePresent_ShouldCallHandler(t *testing.T) {
+   ctx := claimsContext(map[string]any{"scope": "orders.write"})
+   interceptor := authn.RequireScope(testScopedMethod, "orders.write")
+
+   called, err := callScoped(ctx, testScopedMethod, interceptor)
+   assert.NoError(t, err)
+   assert.True(t, called)
+}
+
+func TestRequireScope_ScopeAbsent_ShouldDenyPermission(t *testing.T) {
+   ctx := claimsContext(map[string]any{"scope": "orders.read"})
+   interceptor := authn.RequireScope(testScopedMethod, "orders.write")
+
+   called, err := callScoped(ctx, testScopedMethod, interceptor)
+   assert.Equal(t, codes.PermissionDenied, status.Code(err))
+   assert.False(t, called)
+}
+
+func TestRequireScope_OtherMethod_ShouldCallHandler(t *testing.T) {
+   ctx := claimsContext(map[string]any{"scope": "orders.read"})
+   interceptor := authn.RequireScope(testScopedMethod, "orders.write")
+
+   called, err := callScoped(ctx, "/acme.v1.Orders/Get", interceptor)
+   assert.NoError(t, err)
+   assert.True(t, called)
+}
+
+// contextStream is a grpc.ServerStream carrying ctx.
+type contextStream struct {
+   grpc.ServerStream
+   ctx context.Context
+}
+
+func (s contextStream) Context() context.Context { return s.ctx }
+
+func callScopedStream(
+   ctx context.Context,
+   method string,
+   interceptor grpc.StreamServerInterceptor,
+) (bool, error) {
+   called := false
+   err := interceptor(
+      nil,
+      contextStream{ctx: ctx},
+      &grpc.StreamServerInfo{FullMethod: method},
+      func(any, grpc.ServerStream) error {
+         called = true
+         return nil
+      },
+   )
+
+   return called, err
+}
+
+func TestRequireScope_NonCanonicalMethod_ShouldStillGuard(t *testing.T) {
+   tests := []struct {
+      name       string
+      registered string
+   }{
+      {name: "canonical", registered: testScopedMethod},
+      {name: "no leading slash", registered: "acme.v1.Orders/Cancel"},
+      {name: "dot notation", registered: "acme.v1.Orders.Cancel"},
+      {name: "slash and dots", registered: "/acme.v1.Orders.Cancel"},
+   }
+
+   denied := claimsContext(map[string]any{"scope": "orders.read"})
+   granted := claimsContext(map[string]any{"scope": "orders.write"})
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         unary := authn.RequireScope(tt.registered, "orders.write")
+         called, err := callScoped(denied, testScopedMethod, unary)
+         assert.Equal(t, codes.PermissionDenied, status.Code(err))
+         assert.False(t, called)
+
+         called, err = callScoped(granted, testScopedMethod, unary)
+         assert.NoError(t, err)
+         assert.True(t, called)
+
+         stream := authn.RequireScopeStream(tt.registered, "orders.write")
+         called, err = callScopedStream(denied, testScopedMethod, stream)
+         assert.Equal(t, codes.PermissionDenied, status.Code(err))
+         assert.False(t, called)
+
+         called, err = callScopedStream(granted, testScopedMethod, stream)
+         assert.NoError(t, err)
+         assert.True(t, called)
+      })
+   }
+}
+
+func TestRequireScopeStream_OtherMethod_ShouldCallHandler(t *testing.T) {
+   ctx := claimsContext(map[string]any{"scope": "orders.read"})
+   interceptor := authn.RequireScopeStream(testScopedMethod, "orders.write")
+
+   called, err := callScopedStream(ctx, "/acme.v1.Orders/Get", interceptor)
+   assert.NoError(t, err)
+   assert.True(t, called)
+}
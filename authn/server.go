@@ -0,0 +1,26 @@
+package authn
+
+import (
+   "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/auth"
+   "google.golang.org/grpc"
+)
+
+// ServerOptions returns the options installing v on a gRPC server, e.g.
+// grpc.NewServer(v.ServerOptions()...). Unary and streaming calls are
+// authenticated with Authenticate, then given a request logger carrying the
+// authenticated identity, as by UnaryLoggingInterceptor with
+// slog.Default(). Interceptors such as RequireScope and RequireScopeStream
+// can be chained after them with further grpc.ChainUnaryInterceptor and
+// grpc.ChainStreamInterceptor options.
+func (v *GcpIdentifyPlatformAuthenticator) ServerOptions() []grpc.ServerOption {
+   return []grpc.ServerOption{
+      grpc.ChainUnaryInterceptor(
+         auth.UnaryServerInterceptor(v.Authenticate),
+         UnaryLoggingInterceptor(nil),
+      ),
+      grpc.ChainStreamInterceptor(
+         auth.StreamServerInterceptor(v.Authenticate),
+         StreamLoggingInterceptor(nil),
+      ),
+   }
+}
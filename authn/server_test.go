@@ -0,0 +1,104 @@
+package authn_test
+
+import (
+   "context"
+   "net"
+   "testing"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/api/idtoken"
+   "google.golang.org/grpc"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/credentials/insecure"
+   "google.golang.org/grpc/health"
+   healthpb "google.golang.org/grpc/health/grpc_health_v1"
+   "google.golang.org/grpc/metadata"
+   "google.golang.org/grpc/status"
+   "google.golang.org/grpc/test/bufconn"
+)
+
+// newHealthClient serves the health service on an in-memory listener with
+// the options of v and returns a client for it.
+func newHealthClient(
+   t *testing.T,
+   v *authn.GcpIdentifyPlatformAuthenticator,
+) healthpb.HealthClient {
+   t.Helper()
+
+   lis := bufconn.Listen(1 << 20)
+   srv := grpc.NewServer(v.ServerOptions()...)
+   healthpb.RegisterHealthServer(srv, health.NewServer())
+   go func() { _ = srv.Serve(lis) }()
+   t.Cleanup(srv.Stop)
+
+   conn, err := grpc.NewClient(
+      "passthrough:///bufnet",
+      grpc.WithContextDialer(
+         func(ctx context.Context, _ string) (net.Conn, error) {
+            return lis.DialContext(ctx)
+         },
+      ),
+      grpc.WithTransportCredentials(insecure.NewCredentials()),
+   )
+   require.NoError(t, err)
+   t.Cleanup(func() { _ = conn.Close() })
+
+   return healthpb.NewHealthClient(conn)
+}
+
+func newServerAuthenticator(
+   t *testing.T,
+) *authn.GcpIdentifyPlatformAuthenticator {
+   t.Helper()
+
+   validator := &fakeValidator{payload: &idtoken.Payload{
+      Issuer:   "https://securetoken.google.com/my-project",
+      Audience: "my-project",
+      Subject:  "user-1",
+   }}
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(), nil, authn.WithTokenValidator(validator),
+   )
+   require.NoError(t, err)
+
+   return v
+}
+
+func TestServerOptions_Unary_ShouldEnforceAuth(t *testing.T) {
+   client := newHealthClient(t, newServerAuthenticator(t))
+
+   _, err := client.Check(
+      context.Background(), &healthpb.HealthCheckRequest{},
+   )
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+   ctx := metadata.AppendToOutgoingContext(
+      context.Background(), "authorization", "Bearer token",
+   )
+   resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+   require.NoError(t, err)
+   assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
+
+func TestServerOptions_Stream_ShouldEnforceAuth(t *testing.T) {
+   client := newHealthClient(t, newServerAuthenticator(t))
+
+   stream, err := client.Watch(
+      context.Background(), &healthpb.HealthCheckRequest{},
+   )
+   require.NoError(t, err)
+   _, err = stream.Recv()
+   assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+   ctx, cancel := context.WithCancel(metadata.AppendToOutgoingContext(
+      context.Background(), "authorization", "Bearer token",
+   ))
+   defer cancel()
+   stream, err = client.Watch(ctx, &healthpb.HealthCheckRequest{})
+   require.NoError(t, err)
+   resp, err := stream.Recv()
+   require.NoError(t, err)
+   assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
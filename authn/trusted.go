@@ -0,0 +1,59 @@
+package authn
+
+import (
+   "context"
+   "log/slog"
+   "path/filepath"
+
+   "google.golang.org/grpc/peer"
+)
+
+// TrustedPeerClaim is the claim set to true in the synthetic claims of calls
+// trusted through WithTrustedUnixSocket.
+const TrustedPeerClaim = "trusted_peer"
+
+// WithTrustedUnixSocket skips token validation for calls arriving over the
+// unix socket listening at path, e.g. from a sidecar on the same host that
+// cannot mint tokens. Such calls are given synthetic claims naming subject
+// as their `sub` and carrying TrustedPeerClaim, so handlers and the logging
+// interceptors see a service identity. Calls over any other listener are
+// authenticated as usual. It is off by default; only trust a socket whose
+// file permissions restrict who may connect.
+func WithTrustedUnixSocket(path string, subject string) Option {
+   return func(v *GcpIdentifyPlatformAuthenticator) {
+      if path != "" {
+         v.trustedSocket = filepath.Clean(path)
+         v.trustedSubject = subject
+      }
+   }
+}
+
+// isTrustedPeer reports whether the call of ctx arrived over the trusted
+// unix socket, as given by the local address of its peer.
+func (v *GcpIdentifyPlatformAuthenticator) isTrustedPeer(
+   ctx context.Context,
+) bool {
+   if v.trustedSocket == "" {
+      return false
+   }
+
+   p, ok := peer.FromContext(ctx)
+   if !ok || p.LocalAddr == nil || p.LocalAddr.Network() != "unix" {
+      return false
+   }
+
+   return filepath.Clean(p.LocalAddr.String()) == v.trustedSocket
+}
+
+// trustedPeerContext stores the synthetic claims of a trusted peer in ctx.
+func (v *GcpIdentifyPlatformAuthenticator) trustedPeerContext(
+   ctx context.Context,
+) context.Context {
+   slog.Debug("Skipping authentication for trusted peer",
+      "socket", v.trustedSocket, "subject", v.trustedSubject,
+   )
+
+   claims := map[string]any{"sub": v.trustedSubject, TrustedPeerClaim: true}
+
+   return context.WithValue(ctx, ClaimsContextKey, claims)
+}
@@ -0,0 +1,136 @@
+package authn_test
+
+import (
+   "context"
+   "errors"
+   "net"
+   "os"
+   "path/filepath"
+   "testing"
+
+   "github.com/clintrovert/gobackend/authn"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/credentials/insecure"
+   "google.golang.org/grpc/health"
+   healthpb "google.golang.org/grpc/health/grpc_health_v1"
+   "google.golang.org/grpc/peer"
+   "google.golang.org/grpc/status"
+)
+
+const testTrustedSocket = "/run/acme/sidecar.sock"
+
+// peerContext returns a context without credentials for a call to a gated
+// method from a peer connected to local.
+func peerContext(local net.Addr, remote net.Addr) context.Context {
+   return peer.NewContext(
+      methodContext("/acme.v1.Service/Get"),
+      &peer.Peer{Addr: remote, LocalAddr: local},
+   )
+}
+
+func TestAuthenticate_TrustedUnixSocket_ShouldBypassAuth(t *testing.T) {
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithTokenValidator(&fakeValidator{err: errors.New("unused")}),
+      authn.WithTrustedUnixSocket(testTrustedSocket, "sidecar"),
+   )
+   require.NoError(t, err)
+
+   ctx, err := v.Authenticate(peerContext(
+      &net.UnixAddr{Name: testTrustedSocket, Net: "unix"},
+      &net.UnixAddr{Name: "@", Net: "unix"},
+   ))
+   require.NoError(t, err)
+
+   sub, ok := authn.ClaimString(ctx, "sub")
+   assert.True(t, ok)
+   assert.Equal(t, "sidecar", sub)
+
+   claims, ok := authn.Claims(ctx)
+   assert.True(t, ok)
+   assert.Equal(t, true, claims[authn.TrustedPeerClaim])
+}
+
+func TestAuthenticate_UntrustedPeer_ShouldEnforceAuth(t *testing.T) {
+   tests := []struct {
+      name  string
+      local net.Addr
+      opts  []authn.Option
+   }{
+      {
+         name:  "tcp peer",
+         local: &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8080},
+         opts: []authn.Option{
+            authn.WithTrustedUnixSocket(testTrustedSocket, "sidecar"),
+         },
+      },
+      {
+         name:  "other socket",
+         local: &net.UnixAddr{Name: "/run/acme/public.sock", Net: "unix"},
+         opts: []authn.Option{
+            authn.WithTrustedUnixSocket(testTrustedSocket, "sidecar"),
+         },
+      },
+      {
+         name:  "option not set",
+         local: &net.UnixAddr{Name: testTrustedSocket, Net: "unix"},
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         opts := append(
+            []authn.Option{authn.WithTokenValidator(&fakeValidator{})},
+            tt.opts...,
+         )
+         v, err := authn.NewGcpIdentityPlatformValidator(
+            newTestConfig(), nil, opts...,
+         )
+         require.NoError(t, err)
+
+         _, err = v.Authenticate(peerContext(tt.local, tt.local))
+         assert.Equal(t, codes.Unauthenticated, status.Code(err))
+      })
+   }
+}
+
+func TestServerOptions_TrustedUnixSocket_ShouldBypassAuth(t *testing.T) {
+   // Socket paths are limited to about 100 bytes, which t.TempDir can
+   // exceed.
+   dir, err := os.MkdirTemp("", "authn")
+   require.NoError(t, err)
+   t.Cleanup(func() { _ = os.RemoveAll(dir) })
+   socket := filepath.Join(dir, "sidecar.sock")
+
+   v, err := authn.NewGcpIdentityPlatformValidator(
+      newTestConfig(),
+      nil,
+      authn.WithTokenValidator(&fakeValidator{}),
+      authn.WithTrustedUnixSocket(socket, "sidecar"),
+   )
+   require.NoError(t, err)
+
+   lis, err := net.Listen("unix", socket)
+   require.NoError(t, err)
+   srv := grpc.NewServer(v.ServerOptions()...)
+   healthpb.RegisterHealthServer(srv, health.NewServer())
+   go func() { _ = srv.Serve(lis) }()
+   t.Cleanup(srv.Stop)
+
+   conn, err := grpc.NewClient(
+      "unix://"+socket,
+      grpc.WithTransportCredentials(insecure.NewCredentials()),
+   )
+   require.NoError(t, err)
+   t.Cleanup(func() { _ = conn.Close() })
+
+   resp, err := healthpb.NewHealthClient(conn).Check(
+      context.Background(), &healthpb.HealthCheckRequest{},
+   )
+   require.NoError(t, err)
+   assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+}
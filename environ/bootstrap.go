@@ -0,0 +1,25 @@
+package environ
+
+import (
+   "errors"
+   "fmt"
+   "reflect"
+)
+
+// Bootstrap unmarshals every supplied config and returns a single error
+// listing every missing or invalid variable across all of them, rather than
+// failing on the first config with a problem. Each config must be a pointer
+// to a struct, as with Unmarshal.
+func Bootstrap(configs ...any) error {
+   var errs []error
+
+   for _, config := range configs {
+      if err := Unmarshal(config); err != nil {
+         errs = append(errs, fmt.Errorf(
+            "config '%s': %w", reflect.TypeOf(config).Elem().Name(), err,
+         ))
+      }
+   }
+
+   return errors.Join(errs...)
+}
@@ -0,0 +1,47 @@
+package environ_test
+
+import (
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+)
+
+func TestBootstrap_TwoConfigsMissingVars_ShouldReportBoth(t *testing.T) {
+   type DatabaseConfig struct {
+      Host string `env:"TEST_DB_HOST"`
+   }
+   type CacheConfig struct {
+      Addr string `env:"TEST_CACHE_ADDR"`
+   }
+
+   db := DatabaseConfig{}
+   cache := CacheConfig{}
+
+   err := environ.Bootstrap(&db, &cache)
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+   assert.ErrorContains(t, err, "config 'DatabaseConfig'")
+   assert.ErrorContains(t, err, "required 'TEST_DB_HOST' missing")
+   assert.ErrorContains(t, err, "config 'CacheConfig'")
+   assert.ErrorContains(t, err, "required 'TEST_CACHE_ADDR' missing")
+}
+
+func TestBootstrap_AllConfigsValid_ShouldSucceed(t *testing.T) {
+   type DatabaseConfig struct {
+      Host string `env:"TEST_DB_HOST"`
+   }
+   type CacheConfig struct {
+      Addr string `env:"TEST_CACHE_ADDR"`
+   }
+
+   t.Setenv("TEST_DB_HOST", "localhost")
+   t.Setenv("TEST_CACHE_ADDR", "localhost:6379")
+
+   db := DatabaseConfig{}
+   cache := CacheConfig{}
+
+   err := environ.Bootstrap(&db, &cache)
+   assert.NoError(t, err)
+   assert.Equal(t, "localhost", db.Host)
+   assert.Equal(t, "localhost:6379", cache.Addr)
+}
@@ -0,0 +1,99 @@
+package environ
+
+import (
+   "fmt"
+   "math"
+   "reflect"
+   "strconv"
+   "strings"
+)
+
+var byteSizeType = reflect.TypeOf(ByteSize(0))
+
+// ByteSize is a size in bytes parsed from values such as 512MiB, e.g. for
+// memory limits or buffer sizes.
+type ByteSize int64
+
+// Binary byte size units.
+const (
+   Byte ByteSize = 1
+   KiB           = 1024 * Byte
+   MiB           = 1024 * KiB
+   GiB           = 1024 * MiB
+   TiB           = 1024 * GiB
+)
+
+// byteSizeUnits are the units understood by ParseByteSize, largest first.
+var byteSizeUnits = []struct {
+   name string
+   size ByteSize
+}{
+   {name: "TiB", size: TiB},
+   {name: "GiB", size: GiB},
+   {name: "MiB", size: MiB},
+   {name: "KiB", size: KiB},
+   {name: "B", size: Byte},
+}
+
+// String returns the size in the largest unit dividing it exactly, e.g.
+// 512MiB.
+func (b ByteSize) String() string {
+   for _, unit := range byteSizeUnits {
+      if b != 0 && b%unit.size == 0 {
+         return strconv.FormatInt(int64(b/unit.size), 10) + unit.name
+      }
+   }
+
+   return "0B"
+}
+
+// ParseByteSize parses a non-negative integer count of bytes followed by an
+// optional unit, one of B, KiB, MiB, GiB or TiB, e.g. 512MiB. A bare number
+// is a count of bytes.
+func ParseByteSize(s string) (ByteSize, error) {
+   s = strings.TrimSpace(s)
+   digits := strings.TrimRightFunc(s, func(r rune) bool {
+      return r < '0' || r > '9'
+   })
+   suffix := strings.TrimSpace(s[len(digits):])
+
+   count, err := strconv.ParseInt(digits, 10, 64)
+   if err != nil || count < 0 {
+      return 0, fmt.Errorf("size '%s' is not a byte count", s)
+   }
+
+   if suffix == "" {
+      return ByteSize(count), nil
+   }
+
+   for _, unit := range byteSizeUnits {
+      if suffix != unit.name {
+         continue
+      }
+
+      if count > math.MaxInt64/int64(unit.size) {
+         return 0, fmt.Errorf("size '%s' overflows int64", s)
+      }
+
+      return ByteSize(count) * unit.size, nil
+   }
+
+   return 0, fmt.Errorf("unknown size unit '%s'", suffix)
+}
+
+// setByteSize parses val into the ByteSize fieldVal.
+func setByteSize(fieldVal reflect.Value, val string, tag fieldTag) error {
+   size, err := ParseByteSize(val)
+   if err != nil {
+      errMsg := fmt.Sprintf(msgInvalidValueFmt, val, byteSizeType.Name())
+      return fmt.Errorf("%s; %w", errMsg, err)
+   }
+
+   if err := checkRange(float64(size), val, tag); err != nil {
+      return err
+   }
+
+   fieldVal.SetInt(int64(size))
+
+   return nil
+}
@@ -0,0 +1,92 @@
+package environ_test
+
+import (
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+)
+
+func TestParseByteSize_Units_ShouldScale(t *testing.T) {
+   tests := []struct {
+      value string
+      want  environ.ByteSize
+   }{
+      {value: "4096", want: 4096},
+      {value: "10B", want: 10},
+      {value: "64KiB", want: 64 * environ.KiB},
+      {value: "512MiB", want: 512 * environ.MiB},
+      {value: "2 GiB", want: 2 * environ.GiB},
+      {value: "1TiB", want: environ.TiB},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.value, func(t *testing.T) {
+         got, err := environ.ParseByteSize(tt.value)
+         assert.NoError(t, err)
+         assert.Equal(t, tt.want, got)
+      })
+   }
+}
+
+func TestParseByteSize_Invalid_ShouldReturnErr(t *testing.T) {
+   for _, value := range []string{"", "MiB", "-1MiB", "1.5GiB", "10MB"} {
+      t.Run(value, func(t *testing.T) {
+         _, err := environ.ParseByteSize(value)
+         assert.Error(t, err)
+      })
+   }
+}
+
+func TestByteSize_String_ShouldUseLargestExactUnit(t *testing.T) {
+   assert.Equal(t, "512MiB", (512 * environ.MiB).String())
+   assert.Equal(t, "1536KiB", (1536 * environ.KiB).String())
+   assert.Equal(t, "1000B", environ.ByteSize(1000).String())
+   assert.Equal(t, "0B", environ.ByteSize(0).String())
+}
+
+func TestUnmarshal_ByteSize_ShouldParseUnits(t *testing.T) {
+   type EnvironTest struct {
+      Memory  environ.ByteSize   `env:"TEST_MEMORY"`
+      Buffers []environ.ByteSize `env:"TEST_BUFFERS"`
+      Cache   environ.ByteSize   `env:"TEST_CACHE,default=1GiB"`
+   }
+
+   t.Setenv("TEST_MEMORY", "512MiB")
+   t.Setenv("TEST_BUFFERS", "4KiB,64KiB,1024")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, 512*environ.MiB, env.Memory)
+   assert.Equal(t,
+      []environ.ByteSize{4 * environ.KiB, 64 * environ.KiB, 1024},
+      env.Buffers,
+   )
+   assert.Equal(t, environ.GiB, env.Cache)
+}
+
+func TestUnmarshal_ByteSizeUnknownUnit_ShouldReturnErr(t *testing.T) {
+   type EnvironTest struct {
+      Memory environ.ByteSize `env:"TEST_MEMORY"`
+   }
+
+   t.Setenv("TEST_MEMORY", "512MB")
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorContains(t, err,
+      "invalid value '512MB' for type 'ByteSize'; unknown size unit 'MB'",
+   )
+}
+
+func TestUnmarshal_ByteSizeMax_ShouldCheckBytes(t *testing.T) {
+   type EnvironTest struct {
+      Memory environ.ByteSize `env:"TEST_MEMORY,max=1073741824"`
+   }
+
+   t.Setenv("TEST_MEMORY", "2GiB")
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrValueOutOfRange)
+}
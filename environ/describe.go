@@ -0,0 +1,171 @@
+package environ
+
+import (
+   "reflect"
+   "strings"
+)
+
+// VarDoc describes an environment variable consumed by a config struct.
+type VarDoc struct {
+   // Field is the name of the struct field the variable populates.
+   Field string
+   // Name is the environment variable name.
+   Name string
+   // Type is the Go type of the field, e.g. int or time.Duration.
+   Type string
+   // Optional is true when a missing variable is not an error.
+   Optional bool
+   // Default is the value applied when the variable is missing, valid only
+   // when HasDefault is true.
+   Default    string
+   HasDefault bool
+   // Constraints lists the remaining tag options, e.g. unit=s or trim.
+   Constraints []string
+   // Message is the guidance given by the msg tag option, if any.
+   Message string
+}
+
+// Describe walks the `env` tags of config, a pointer to a struct or a struct,
+// and returns a descriptor per variable, e.g. to print a table of the
+// variables a binary consumes. Fields with malformed tags are skipped.
+func Describe(config any) []VarDoc {
+   t := reflect.TypeOf(config)
+   if t.Kind() == reflect.Pointer {
+      t = t.Elem()
+   }
+
+   var docs []VarDoc
+   for i := 0; i < t.NumField(); i++ {
+      fieldType := t.Field(i)
+
+      tagEncoded, ok := fieldType.Tag.Lookup("env")
+      if !ok {
+         continue
+      }
+
+      tag, err := parseTagValue(tagEncoded)
+      if err != nil {
+         continue
+      }
+
+      docs = append(docs, VarDoc{
+         Field:       fieldType.Name,
+         Name:        tag.name,
+         Type:        fieldType.Type.String(),
+         Optional:    isOptional(tag),
+         Default:     tag.defaultValue,
+         HasDefault:  tag.hasDefault,
+         Constraints: tagConstraints(tagEncoded, tag.name),
+         Message:     tag.message,
+      })
+   }
+
+   return docs
+}
+
+// Template renders a .env.example style template of the variables consumed
+// by configs, each a pointer to a struct or a struct as for Describe. Every
+// variable gets an empty KEY= line preceded by a comment noting whether it is
+// required, its default and its constraints, and one with its msg guidance,
+// e.g.
+//
+//	# optional; default: 8080
+//	PORT=
+//
+// A variable consumed by several configs is listed once.
+func Template(configs ...any) string {
+   var b strings.Builder
+   seen := make(map[string]bool)
+   for _, config := range configs {
+      for _, doc := range Describe(config) {
+         if seen[doc.Name] {
+            continue
+         }
+         seen[doc.Name] = true
+
+         if b.Len() > 0 {
+            b.WriteString("\n")
+         }
+
+         if doc.Message != "" {
+            b.WriteString("# " + doc.Message + "\n")
+         }
+
+         b.WriteString("# ")
+         if doc.Optional {
+            b.WriteString("optional")
+         } else {
+            b.WriteString("required")
+         }
+         if doc.HasDefault {
+            b.WriteString("; default: " + doc.Default)
+         }
+         for _, c := range doc.Constraints {
+            b.WriteString("; " + c)
+         }
+         b.WriteString("\n")
+
+         b.WriteString(doc.Name + "=\n")
+      }
+   }
+
+   return b.String()
+}
+
+// isOptional reports whether a missing variable for tag can be an error-free
+// outcome, including in environments not listed by required_in.
+func isOptional(tag fieldTag) bool {
+   return tag.optional || tag.hasDefault || len(tag.requiredIn) > 0
+}
+
+// tagConstraints returns the options of an encoded tag other than the name,
+// optional, default and msg. Empty segments, such as the one left by a
+// trailing comma, are skipped.
+func tagConstraints(tagEncoded string, name string) []string {
+   var constraints []string
+   for _, part := range strings.Split(tagEncoded, ",") {
+      part = strings.TrimSpace(part)
+      if part == "" {
+         continue
+      }
+
+      key, _, hasVal := strings.Cut(part, "=")
+
+      // The message runs to the end of the tag.
+      if hasVal && strings.EqualFold(key, "msg") {
+         break
+      }
+
+      // Rejoin the elements of required_in and requires lists.
+      if n := len(constraints); n > 0 && !hasVal &&
+         continuesList(constraints[n-1], part) {
+         constraints[n-1] += "," + part
+         continue
+      }
+
+      if part == name ||
+         strings.EqualFold(part, "optional") ||
+         strings.EqualFold(key, "default") {
+         continue
+      }
+
+      constraints = append(constraints, part)
+   }
+
+   return constraints
+}
+
+// continuesList reports whether the bare tag part continues the list option
+// prev.
+func continuesList(prev string, part string) bool {
+   key, _, _ := strings.Cut(prev, "=")
+   switch strings.ToLower(key) {
+   case "required_in":
+      _, err := ParseEnvironment(part)
+      return err == nil
+   case "requires":
+      return !isTagFlag(part)
+   default:
+      return false
+   }
+}
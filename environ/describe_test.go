@@ -0,0 +1,120 @@
+package environ_test
+
+import (
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+)
+
+func TestDescribe_RepresentativeConfig_ShouldReturnDescriptors(t *testing.T) {
+   type Config struct {
+      Host    string        `env:"HOST"`
+      Port    int           `env:"PORT,default=8080"`
+      Debug   bool          `env:"DEBUG,optional,loose_bool"`
+      Timeout time.Duration `env:"TIMEOUT,unit=s,trim"`
+      Ignored string
+   }
+
+   docs := environ.Describe(&Config{})
+   assert.Equal(t, []environ.VarDoc{
+      {Field: "Host", Name: "HOST", Type: "string"},
+      {
+         Field:      "Port",
+         Name:       "PORT",
+         Type:       "int",
+         Optional:   true,
+         Default:    "8080",
+         HasDefault: true,
+      },
+      {
+         Field:       "Debug",
+         Name:        "DEBUG",
+         Type:        "bool",
+         Optional:    true,
+         Constraints: []string{"loose_bool"},
+      },
+      {
+         Field:       "Timeout",
+         Name:        "TIMEOUT",
+         Type:        "time.Duration",
+         Constraints: []string{"unit=s", "trim"},
+      },
+   }, docs)
+}
+
+func TestDescribe_RequiredIn_ShouldKeepEnvironmentList(t *testing.T) {
+   type Config struct {
+      SentryDSN string `env:"SENTRY_DSN,required_in=prd,stg,trim"`
+   }
+
+   docs := environ.Describe(Config{})
+   assert.Equal(t, []environ.VarDoc{{
+      Field:       "SentryDSN",
+      Name:        "SENTRY_DSN",
+      Type:        "string",
+      Optional:    true,
+      Constraints: []string{"required_in=prd,stg", "trim"},
+   }}, docs)
+}
+
+func TestDescribe_TrailingComma_ShouldSkipEmptyConstraint(t *testing.T) {
+   type Config struct {
+      Timeout time.Duration `env:"TIMEOUT,unit=s,trim,"`
+   }
+
+   docs := environ.Describe(Config{})
+   assert.Equal(t, []environ.VarDoc{{
+      Field:       "Timeout",
+      Name:        "TIMEOUT",
+      Type:        "time.Duration",
+      Constraints: []string{"unit=s", "trim"},
+   }}, docs)
+}
+
+func TestTemplate_SeveralConfigs_ShouldRenderEachVariableOnce(t *testing.T) {
+   type ServerConfig struct {
+      Host string `env:"HOST"`
+      Port int    `env:"PORT,default=8080"`
+   }
+   type ObservabilityConfig struct {
+      Host      string `env:"HOST"`
+      SentryDSN string `env:"SENTRY_DSN,required_in=prd,stg,trim"`
+      Debug     bool   `env:"DEBUG,optional"`
+   }
+
+   got := environ.Template(&ServerConfig{}, ObservabilityConfig{})
+   assert.Equal(t, "# required\n"+
+      "HOST=\n"+
+      "\n"+
+      "# optional; default: 8080\n"+
+      "PORT=\n"+
+      "\n"+
+      "# optional; required_in=prd,stg; trim\n"+
+      "SENTRY_DSN=\n"+
+      "\n"+
+      "# optional\n"+
+      "DEBUG=\n", got)
+}
+
+func TestTemplate_NoConfigs_ShouldReturnEmpty(t *testing.T) {
+   assert.Empty(t, environ.Template())
+}
+
+func TestTemplate_CustomMessage_ShouldRenderGuidance(t *testing.T) {
+   type EnvironTest struct {
+      LicenseKey string `env:"LICENSE_KEY,trim,msg=From the vendor portal, under Keys"` //nolint:lll
+   }
+
+   docs := environ.Describe(EnvironTest{})
+   require.Len(t, docs, 1)
+   assert.Equal(t, []string{"trim"}, docs[0].Constraints)
+   assert.Equal(t, "From the vendor portal, under Keys", docs[0].Message)
+
+   assert.Equal(t, "# From the vendor portal, under Keys\n"+
+      "# required; trim\n"+
+      "LICENSE_KEY=\n", environ.Template(EnvironTest{}),
+   )
+}
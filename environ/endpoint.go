@@ -0,0 +1,79 @@
+package environ
+
+import (
+   "errors"
+   "fmt"
+   "net"
+   "net/netip"
+   "reflect"
+   "strconv"
+   "strings"
+)
+
+// ErrInvalidEndpoint indicates a value is not a host:port endpoint.
+var ErrInvalidEndpoint = errors.New("environ, invalid endpoint")
+
+var (
+   endpointType = reflect.TypeOf(Endpoint{})
+   addrPortType = reflect.TypeOf(netip.AddrPort{})
+)
+
+// Endpoint is a network endpoint given as host:port, where the host may be a
+// hostname or an IP address, e.g. for service discovery configs. IPv6
+// addresses must be bracketed, e.g. [::1]:8080.
+type Endpoint struct {
+   Host string
+   Port uint16
+}
+
+// String returns the endpoint in host:port form.
+func (e Endpoint) String() string {
+   return net.JoinHostPort(e.Host, strconv.Itoa(int(e.Port)))
+}
+
+// ParseEndpoint parses a host:port endpoint. Both the host and a port in the
+// range 1-65535 are required.
+func ParseEndpoint(s string) (Endpoint, error) {
+   host, port, err := net.SplitHostPort(strings.TrimSpace(s))
+   if err != nil {
+      return Endpoint{}, fmt.Errorf("%s; %w", err.Error(), ErrInvalidEndpoint)
+   }
+
+   if host == "" {
+      errMsg := fmt.Sprintf("endpoint '%s' missing host", s)
+      return Endpoint{}, fmt.Errorf("%s; %w", errMsg, ErrInvalidEndpoint)
+   }
+
+   portNum, err := strconv.ParseUint(port, 10, 16)
+   if err != nil || portNum == 0 {
+      errMsg := fmt.Sprintf("endpoint '%s' has invalid port '%s'", s, port)
+      return Endpoint{}, fmt.Errorf("%s; %w", errMsg, ErrInvalidEndpoint)
+   }
+
+   return Endpoint{Host: host, Port: uint16(portNum)}, nil
+}
+
+// setEndpoint parses val into the Endpoint or netip.AddrPort fieldVal.
+func setEndpoint(fieldVal reflect.Value, val string) error {
+   if fieldVal.Type() == addrPortType {
+      addrPort, err := netip.ParseAddrPort(strings.TrimSpace(val))
+      if err != nil {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, val, addrPortType.String())
+         return fmt.Errorf("%s; %w; %w", errMsg, err, ErrInvalidEndpoint)
+      }
+
+      fieldVal.Set(reflect.ValueOf(addrPort))
+
+      return nil
+   }
+
+   endpoint, err := ParseEndpoint(val)
+   if err != nil {
+      errMsg := fmt.Sprintf(msgInvalidValueFmt, val, endpointType.String())
+      return fmt.Errorf("%s; %w", errMsg, err)
+   }
+
+   fieldVal.Set(reflect.ValueOf(endpoint))
+
+   return nil
+}
@@ -0,0 +1,73 @@
+package environ_test
+
+import (
+   "net/netip"
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshal_EndpointList_ShouldParseEachElement(t *testing.T) {
+   type EnvironTest struct {
+      Peers   []environ.Endpoint `env:"TEST_PEERS"`
+      Primary environ.Endpoint   `env:"TEST_PRIMARY"`
+   }
+
+   t.Setenv("TEST_PEERS", "a.internal:7000, 10.0.0.2:7001,[::1]:7002")
+   t.Setenv("TEST_PRIMARY", "db.internal:5432")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []environ.Endpoint{
+      {Host: "a.internal", Port: 7000},
+      {Host: "10.0.0.2", Port: 7001},
+      {Host: "::1", Port: 7002},
+   }, env.Peers)
+   assert.Equal(t, "db.internal:5432", env.Primary.String())
+   assert.Equal(t, "[::1]:7002", env.Peers[2].String())
+}
+
+func TestUnmarshal_EndpointMissingPort_ShouldReturnErrInvalidEndpoint(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Peers []environ.Endpoint `env:"TEST_PEERS"`
+   }
+
+   t.Setenv("TEST_PEERS", "a.internal:7000,b.internal")
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrInvalidEndpoint)
+   assert.ErrorContains(t, err, "element 1")
+}
+
+func TestUnmarshal_AddrPortList_ShouldParseIPEndpoints(t *testing.T) {
+   type EnvironTest struct {
+      Peers []netip.AddrPort `env:"TEST_PEERS"`
+   }
+
+   t.Setenv("TEST_PEERS", "10.0.0.1:7000,[::1]:7001")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []netip.AddrPort{
+      netip.MustParseAddrPort("10.0.0.1:7000"),
+      netip.MustParseAddrPort("[::1]:7001"),
+   }, env.Peers)
+}
+
+func TestParseEndpoint_InvalidValues_ShouldReturnErrInvalidEndpoint(
+   t *testing.T,
+) {
+   for _, val := range []string{"a.internal", ":7000", "a:0", "a:http", ""} {
+      t.Run(val, func(t *testing.T) {
+         _, err := environ.ParseEndpoint(val)
+         assert.ErrorIs(t, err, environ.ErrInvalidEndpoint)
+      })
+   }
+}
@@ -3,8 +3,10 @@ package environ
 import (
    "errors"
    "fmt"
+   "log/slog"
    "os"
    "strings"
+   "sync"
 )
 
 var (
@@ -18,13 +20,16 @@ type Environment int
 
 const (
    Unknown     Environment = iota
-   Development             = 1
-   Staging                 = 2
-   Production              = 3
-   Test                    = 4
+   Development Environment = 1
+   Staging     Environment = 2
+   Production  Environment = 3
+   Test        Environment = 4
 )
 
-// String returns a string representation of Environment.
+// String returns the canonical short form of Environment, e.g. "prd" for
+// Production, which ParseEnvironment maps back to the same Environment.
+// Aliases such as "production" are accepted by ParseEnvironment but never
+// produced by String.
 func (e Environment) String() string {
    switch e {
    case Test:
@@ -42,11 +47,63 @@ func (e Environment) String() string {
    }
 }
 
+// DefaultLogLevel returns a sensible default log level for the environment,
+// which callers may override:
+//
+//   - Development, Test: slog.LevelDebug
+//   - Staging, Unknown: slog.LevelInfo
+//   - Production: slog.LevelWarn
+func (e Environment) DefaultLogLevel() slog.Level {
+   switch e {
+   case Development, Test:
+      return slog.LevelDebug
+   case Production:
+      return slog.LevelWarn
+   default:
+      return slog.LevelInfo
+   }
+}
+
+// ProjectSuffix returns the suffix of GCP projects named after the
+// environment, e.g. "prd" for acme-prd. Unknown and invalid environments
+// have no suffix.
+func (e Environment) ProjectSuffix() string {
+   switch e {
+   case Development, Staging, Production, Test:
+      return e.String()
+   default:
+      return ""
+   }
+}
+
+// ProjectID returns the GCP project ID for the environment composed as
+// base-suffix, e.g. acme-dev, or base when the environment has no
+// ProjectSuffix.
+func (e Environment) ProjectID(base string) string {
+   suffix := e.ProjectSuffix()
+   if suffix == "" {
+      return base
+   }
+
+   return base + "-" + suffix
+}
+
 // ParseEnvironment takes in a string representation of Environment and
-// returns the Environment.
+// returns the Environment. Both the canonical forms returned by String and
+// common aliases are accepted, case-insensitively, so
+// ParseEnvironment(e.String()) returns e for every Environment. The numeric
+// values of the known environments are accepted too, as the single digits
+// 1 to 4, e.g. "3" for Production, for deploy systems that only pass enum
+// values; "0" and signed forms such as "+3" return ErrInvalidEnvironment.
 func ParseEnvironment(s string) (Environment, error) {
+   if len(s) == 1 && s[0] >= '1' && s[0] <= '4' {
+      return Environment(s[0] - '0'), nil
+   }
+
    s = strings.ToLower(s)
    switch s {
+   case "unknown":
+      return Unknown, nil
    case "test", "testing", "tst":
       return Test, nil
    case "dev", "development":
@@ -60,17 +117,175 @@ func ParseEnvironment(s string) (Environment, error) {
    }
 }
 
+// ParseEnvironments parses a comma-separated list of environments, e.g.
+// "dev,stg", in the order given with duplicates removed. Surrounding spaces
+// and empty entries are ignored. As for GetEnvironment, "unknown" is
+// rejected; every invalid entry is reported in the returned error.
+func ParseEnvironments(s string) ([]Environment, error) {
+   var (
+      envs []Environment
+      errs []error
+      seen = map[Environment]bool{}
+   )
+   for _, entry := range strings.Split(s, ",") {
+      entry = strings.TrimSpace(entry)
+      if entry == "" {
+         continue
+      }
+
+      env, err := ParseEnvironment(entry)
+      if err == nil && env == Unknown {
+         err = ErrInvalidEnvironment
+      }
+      if err != nil {
+         errs = append(errs, fmt.Errorf("environment '%s'; %w", entry, err))
+         continue
+      }
+
+      if !seen[env] {
+         seen[env] = true
+         envs = append(envs, env)
+      }
+   }
+
+   if len(errs) > 0 {
+      return nil, errors.Join(errs...)
+   }
+
+   return envs, nil
+}
+
 // GetEnvironment retrieves the environment from an environment variable.
 func GetEnvironment() (Environment, error) {
-   e := os.Getenv(environmentVarName)
+   return parseEnvironmentVar(os.Getenv(environmentVarName))
+}
+
+// parseEnvironmentVar parses e, the value of the ENVIRONMENT variable, as
+// GetEnvironment does.
+func parseEnvironmentVar(e string) (Environment, error) {
    if e == "" {
       return Unknown, ErrEnvironmentMissing
    }
 
+   // An explicit "unknown" is as unusable as an invalid value.
    env, err := ParseEnvironment(e)
+   if err == nil && env == Unknown {
+      err = ErrInvalidEnvironment
+   }
    if err != nil {
       return Unknown, fmt.Errorf("environment misconfigured: %w", err)
    }
 
    return env, nil
 }
+
+// Detector infers the environment, reporting false when it does not apply.
+type Detector func() (Environment, bool)
+
+// ciVariables are the variables set by common CI providers: GitHub Actions,
+// GitLab CI and the generic CI flag honored by most others.
+var ciVariables = []string{"GITHUB_ACTIONS", "GITLAB_CI", "CI"}
+
+// FromEnvironmentVar detects the environment from the ENVIRONMENT variable,
+// as GetEnvironment does.
+func FromEnvironmentVar() (Environment, bool) {
+   env, err := GetEnvironment()
+   return env, err == nil
+}
+
+// FromCI detects the Test environment when any of the well-known CI variables
+// is set to a truthy value.
+func FromCI() (Environment, bool) {
+   for _, name := range ciVariables {
+      val, ok := os.LookupEnv(name)
+      if !ok {
+         continue
+      }
+
+      switch strings.ToLower(strings.TrimSpace(val)) {
+      case "", "0", "false", "no":
+         continue
+      default:
+         return Test, true
+      }
+   }
+
+   return Unknown, false
+}
+
+// DefaultDetectors returns the detectors used by DetectEnvironment when none
+// are supplied, in order: FromEnvironmentVar, then FromCI.
+func DefaultDetectors() []Detector {
+   return []Detector{FromEnvironmentVar, FromCI}
+}
+
+// DetectEnvironment returns the environment reported by the first applicable
+// detector, or Unknown. Without detectors, DefaultDetectors is used, so an
+// explicit ENVIRONMENT wins over CI detection; pass detectors to change the
+// order or add custom ones.
+func DetectEnvironment(detectors ...Detector) Environment {
+   if len(detectors) == 0 {
+      detectors = DefaultDetectors()
+   }
+
+   for _, detect := range detectors {
+      if env, ok := detect(); ok {
+         return env
+      }
+   }
+
+   return Unknown
+}
+
+var (
+   currentMu   sync.Mutex
+   currentOnce = &sync.Once{}
+   currentEnv  Environment
+   currentErr  error
+)
+
+// resolveCurrent resolves the environment on first use and returns the
+// memoized result.
+func resolveCurrent() (Environment, error) {
+   currentMu.Lock()
+   once := currentOnce
+   currentMu.Unlock()
+
+   once.Do(func() {
+      env, err := GetEnvironment()
+
+      currentMu.Lock()
+      currentEnv, currentErr = env, err
+      currentMu.Unlock()
+   })
+
+   currentMu.Lock()
+   defer currentMu.Unlock()
+
+   return currentEnv, currentErr
+}
+
+// Current returns the environment resolved by GetEnvironment, reading and
+// parsing the variable only once per process. It returns Unknown if
+// resolution failed; the error is available from CurrentErr. Safe for
+// concurrent use.
+func Current() Environment {
+   env, _ := resolveCurrent()
+   return env
+}
+
+// CurrentErr returns the error, if any, from resolving Current.
+func CurrentErr() error {
+   _, err := resolveCurrent()
+   return err
+}
+
+// Reset clears the memoized environment so the next call to Current resolves
+// it again. It is intended for tests.
+func Reset() {
+   currentMu.Lock()
+   defer currentMu.Unlock()
+
+   currentOnce = &sync.Once{}
+   currentEnv, currentErr = Unknown, nil
+}
@@ -0,0 +1,283 @@
+package environ_test
+
+import (
+   "log/slog"
+   "os"
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+)
+
+func TestDefaultLogLevel_EachEnvironment_ShouldMapToLevel(t *testing.T) {
+   tests := []struct {
+      env  environ.Environment
+      want slog.Level
+   }{
+      {env: environ.Development, want: slog.LevelDebug},
+      {env: environ.Test, want: slog.LevelDebug},
+      {env: environ.Staging, want: slog.LevelInfo},
+      {env: environ.Production, want: slog.LevelWarn},
+      {env: environ.Unknown, want: slog.LevelInfo},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.env.String(), func(t *testing.T) {
+         assert.Equal(t, tt.want, tt.env.DefaultLogLevel())
+      })
+   }
+}
+
+func TestCurrent_EnvironmentChanged_ShouldReturnMemoizedValue(t *testing.T) {
+   environ.Reset()
+   t.Cleanup(environ.Reset)
+
+   t.Setenv("ENVIRONMENT", "stg")
+   assert.Equal(t, environ.Staging, environ.Current())
+   assert.NoError(t, environ.CurrentErr())
+
+   t.Setenv("ENVIRONMENT", "prd")
+   assert.Equal(t, environ.Staging, environ.Current())
+}
+
+func TestCurrent_AfterReset_ShouldResolveAgain(t *testing.T) {
+   environ.Reset()
+   t.Cleanup(environ.Reset)
+
+   t.Setenv("ENVIRONMENT", "dev")
+   assert.Equal(t, environ.Development, environ.Current())
+
+   t.Setenv("ENVIRONMENT", "prd")
+   environ.Reset()
+   assert.Equal(t, environ.Production, environ.Current())
+}
+
+func TestCurrent_InvalidEnvironment_ShouldReturnErrFromCurrentErr(
+   t *testing.T,
+) {
+   environ.Reset()
+   t.Cleanup(environ.Reset)
+
+   t.Setenv("ENVIRONMENT", "qa")
+   assert.Equal(t, environ.Unknown, environ.Current())
+   assert.ErrorIs(t, environ.CurrentErr(), environ.ErrInvalidEnvironment)
+}
+
+// clearDetectionVars unsets the variables inspected by DetectEnvironment for
+// the duration of the test.
+func clearDetectionVars(t *testing.T) {
+   for _, name := range []string{
+      "ENVIRONMENT", "GITHUB_ACTIONS", "GITLAB_CI", "CI",
+   } {
+      t.Setenv(name, "")
+      _ = os.Unsetenv(name)
+   }
+}
+
+func TestDetectEnvironment_CIProviders_ShouldDetectTest(t *testing.T) {
+   for _, name := range []string{"GITHUB_ACTIONS", "GITLAB_CI", "CI"} {
+      t.Run(name, func(t *testing.T) {
+         clearDetectionVars(t)
+         t.Setenv(name, "true")
+
+         assert.Equal(t, environ.Test, environ.DetectEnvironment())
+      })
+   }
+}
+
+func TestDetectEnvironment_ExplicitEnvironment_ShouldWinOverCI(
+   t *testing.T,
+) {
+   clearDetectionVars(t)
+   t.Setenv("ENVIRONMENT", "stg")
+   t.Setenv("GITHUB_ACTIONS", "true")
+
+   assert.Equal(t, environ.Staging, environ.DetectEnvironment())
+}
+
+func TestDetectEnvironment_NothingSet_ShouldReturnUnknown(t *testing.T) {
+   clearDetectionVars(t)
+   t.Setenv("CI", "false")
+
+   assert.Equal(t, environ.Unknown, environ.DetectEnvironment())
+}
+
+func TestDetectEnvironment_CustomOrder_ShouldUseSuppliedDetectors(
+   t *testing.T,
+) {
+   clearDetectionVars(t)
+   t.Setenv("ENVIRONMENT", "prd")
+   t.Setenv("CI", "1")
+
+   env := environ.DetectEnvironment(environ.FromCI, environ.FromEnvironmentVar)
+   assert.Equal(t, environ.Test, env)
+}
+
+func TestProjectID_EachEnvironment_ShouldComposeSuffix(t *testing.T) {
+   tests := []struct {
+      env        environ.Environment
+      wantSuffix string
+      wantID     string
+   }{
+      {env: environ.Development, wantSuffix: "dev", wantID: "acme-dev"},
+      {env: environ.Staging, wantSuffix: "stg", wantID: "acme-stg"},
+      {env: environ.Production, wantSuffix: "prd", wantID: "acme-prd"},
+      {env: environ.Test, wantSuffix: "test", wantID: "acme-test"},
+      {env: environ.Unknown, wantSuffix: "", wantID: "acme"},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.env.String(), func(t *testing.T) {
+         assert.Equal(t, tt.wantSuffix, tt.env.ProjectSuffix())
+         assert.Equal(t, tt.wantID, tt.env.ProjectID("acme"))
+      })
+   }
+}
+
+func TestParseEnvironment_String_ShouldRoundTripEveryEnvironment(
+   t *testing.T,
+) {
+   all := []environ.Environment{
+      environ.Unknown,
+      environ.Development,
+      environ.Staging,
+      environ.Production,
+      environ.Test,
+   }
+
+   for _, env := range all {
+      t.Run(env.String(), func(t *testing.T) {
+         got, err := environ.ParseEnvironment(env.String())
+         assert.NoError(t, err)
+         assert.Equal(t, env, got)
+      })
+   }
+}
+
+func TestParseEnvironment_Aliases_ShouldStringifyCanonically(t *testing.T) {
+   tests := map[string]string{
+      "production":  "prd",
+      "PROD":        "prd",
+      "staging":     "stg",
+      "stage":       "stg",
+      "development": "dev",
+      "testing":     "test",
+      "tst":         "test",
+   }
+
+   for alias, canonical := range tests {
+      t.Run(alias, func(t *testing.T) {
+         env, err := environ.ParseEnvironment(alias)
+         assert.NoError(t, err)
+         assert.Equal(t, canonical, env.String())
+
+         again, err := environ.ParseEnvironment(env.String())
+         assert.NoError(t, err)
+         assert.Equal(t, env, again)
+      })
+   }
+}
+
+func TestGetEnvironment_ExplicitUnknown_ShouldReturnInvalid(t *testing.T) {
+   t.Setenv("ENVIRONMENT", "unknown")
+
+   env, err := environ.GetEnvironment()
+   assert.ErrorIs(t, err, environ.ErrInvalidEnvironment)
+   assert.Equal(t, environ.Unknown, env)
+}
+
+func TestParseEnvironments_ValidList_ShouldParseInOrder(t *testing.T) {
+   envs, err := environ.ParseEnvironments("dev, stg,PROD")
+   assert.NoError(t, err)
+   assert.Equal(t, []environ.Environment{
+      environ.Development, environ.Staging, environ.Production,
+   }, envs)
+}
+
+func TestParseEnvironments_InvalidEntries_ShouldReportEach(t *testing.T) {
+   envs, err := environ.ParseEnvironments("dev,qa,unknown,stg")
+   assert.ErrorIs(t, err, environ.ErrInvalidEnvironment)
+   assert.ErrorContains(t, err, "'qa'")
+   assert.ErrorContains(t, err, "'unknown'")
+   assert.Nil(t, envs)
+}
+
+func TestParseEnvironments_Duplicates_ShouldDeduplicate(t *testing.T) {
+   envs, err := environ.ParseEnvironments("stg,dev,staging,,dev")
+   assert.NoError(t, err)
+   assert.Equal(t, []environ.Environment{
+      environ.Staging, environ.Development,
+   }, envs)
+}
+
+func TestParseEnvironment_Numeric_ShouldMapToConstant(t *testing.T) {
+   tests := []struct {
+      name    string
+      value   string
+      want    environ.Environment
+      wantErr error
+   }{
+      {name: "development", value: "1", want: environ.Development},
+      {name: "staging", value: "2", want: environ.Staging},
+      {name: "production", value: "3", want: environ.Production},
+      {name: "test", value: "4", want: environ.Test},
+      {
+         name:    "out of range",
+         value:   "5",
+         want:    environ.Unknown,
+         wantErr: environ.ErrInvalidEnvironment,
+      },
+      {
+         name:    "negative",
+         value:   "-1",
+         want:    environ.Unknown,
+         wantErr: environ.ErrInvalidEnvironment,
+      },
+      {
+         name:    "unknown",
+         value:   "0",
+         want:    environ.Unknown,
+         wantErr: environ.ErrInvalidEnvironment,
+      },
+      {
+         name:    "plus sign",
+         value:   "+3",
+         want:    environ.Unknown,
+         wantErr: environ.ErrInvalidEnvironment,
+      },
+      {
+         name:    "negative zero",
+         value:   "-0",
+         want:    environ.Unknown,
+         wantErr: environ.ErrInvalidEnvironment,
+      },
+      {
+         name:    "leading zero",
+         value:   "03",
+         want:    environ.Unknown,
+         wantErr: environ.ErrInvalidEnvironment,
+      },
+      {name: "string form", value: "prd", want: environ.Production},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         env, err := environ.ParseEnvironment(tt.value)
+         assert.ErrorIs(t, err, tt.wantErr)
+         assert.Equal(t, tt.want, env)
+      })
+   }
+}
+
+func TestGetEnvironment_Numeric_ShouldMapToConstant(t *testing.T) {
+   t.Setenv("ENVIRONMENT", "3")
+
+   env, err := environ.GetEnvironment()
+   assert.NoError(t, err)
+   assert.Equal(t, environ.Production, env)
+
+   t.Setenv("ENVIRONMENT", "9")
+
+   _, err = environ.GetEnvironment()
+   assert.ErrorIs(t, err, environ.ErrInvalidEnvironment)
+}
@@ -0,0 +1,16 @@
+package environ
+
+// SetPathListSeparator replaces the OS list separator until the returned
+// function is called, simulating other platforms.
+func SetPathListSeparator(sep string) (restore func()) {
+   prev := pathListSeparator
+   pathListSeparator = sep
+
+   return func() { pathListSeparator = prev }
+}
+
+// ParseTagName parses an `env` struct tag, returning its variable name.
+func ParseTagName(value string) (string, error) {
+   tag, err := parseTagValue(value)
+   return tag.name, err
+}
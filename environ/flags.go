@@ -0,0 +1,38 @@
+package environ
+
+import (
+   "flag"
+   "strings"
+)
+
+// UnmarshalWithFlags is like Unmarshal but also reads values from the flags
+// of fs set on the command line, with environment variables taking
+// precedence. The flag of a variable is its name in lower case with
+// underscores replaced by dashes, e.g. -database-url for DATABASE_URL. Flags
+// left at their default are ignored so tag defaults still apply; fs must
+// have been parsed.
+func UnmarshalWithFlags(config any, fs *flag.FlagSet, opts ...Option) error {
+   env := snapshotEnv()
+
+   set := make(map[string]string)
+   fs.Visit(func(f *flag.Flag) {
+      set[f.Name] = f.Value.String()
+   })
+
+   for _, doc := range Describe(config) {
+      if _, ok := env.lookup(doc.Name); ok {
+         continue
+      }
+
+      if val, ok := set[flagName(doc.Name)]; ok {
+         env[doc.Name] = val
+      }
+   }
+
+   return unmarshal(config, env, opts)
+}
+
+// flagName returns the flag name of the environment variable name.
+func flagName(name string) string {
+   return strings.ReplaceAll(strings.ToLower(name), "_", "-")
+}
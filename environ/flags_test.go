@@ -0,0 +1,76 @@
+package environ_test
+
+import (
+   "flag"
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+)
+
+type flagsConfig struct {
+   Host string `env:"TEST_FLAGS_HOST"`
+   Port int    `env:"TEST_FLAGS_PORT,default=8080"`
+}
+
+// parseFlags returns a parsed FlagSet defining the flags of flagsConfig.
+func parseFlags(t *testing.T, args ...string) *flag.FlagSet {
+   t.Helper()
+
+   fs := flag.NewFlagSet("test", flag.ContinueOnError)
+   fs.String("test-flags-host", "", "host")
+   fs.Int("test-flags-port", 9090, "port")
+   require.NoError(t, fs.Parse(args))
+
+   return fs
+}
+
+func TestUnmarshalWithFlags_EnvSet_ShouldOverrideFlag(t *testing.T) {
+   t.Setenv("TEST_FLAGS_HOST", "env.internal")
+   fs := parseFlags(t, "-test-flags-host=flag.internal")
+
+   config := flagsConfig{}
+
+   err := environ.UnmarshalWithFlags(&config, fs)
+   assert.NoError(t, err)
+   assert.Equal(t, "env.internal", config.Host)
+}
+
+func TestUnmarshalWithFlags_EnvAbsent_ShouldUseFlag(t *testing.T) {
+   fs := parseFlags(t,
+      "-test-flags-host=flag.internal", "-test-flags-port=7000",
+   )
+
+   config := flagsConfig{}
+
+   err := environ.UnmarshalWithFlags(&config, fs)
+   assert.NoError(t, err)
+   assert.Equal(t, flagsConfig{Host: "flag.internal", Port: 7000}, config)
+}
+
+func TestUnmarshalWithFlags_FlagNotSet_ShouldKeepTagDefault(t *testing.T) {
+   fs := parseFlags(t, "-test-flags-host=flag.internal")
+
+   config := flagsConfig{}
+
+   err := environ.UnmarshalWithFlags(&config, fs)
+   assert.NoError(t, err)
+   assert.Equal(t, 8080, config.Port)
+}
+
+func TestUnmarshalWithFlags_EnvironmentFlag_ShouldApplyRequiredIn(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Environment string `env:"ENVIRONMENT,optional"`
+      SentryDSN   string `env:"TEST_FLAGS_SENTRY_DSN,required_in=prd"`
+   }
+
+   fs := flag.NewFlagSet("test", flag.ContinueOnError)
+   fs.String("environment", "", "environment")
+   require.NoError(t, fs.Parse([]string{"-environment=prd"}))
+
+   err := environ.UnmarshalWithFlags(&EnvironTest{}, fs)
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
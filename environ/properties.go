@@ -0,0 +1,81 @@
+package environ
+
+import (
+   "bufio"
+   "errors"
+   "fmt"
+   "io"
+   "os"
+   "strings"
+)
+
+// ErrMalformedProperties indicates a properties file has a line that is not
+// a comment or a key=value pair.
+var ErrMalformedProperties = errors.New("environ, malformed properties file")
+
+// UnmarshalFromPropertiesFile is like Unmarshal but reads the variables from
+// the properties file named by the pathEnv environment variable, e.g. a
+// CONFIG_FILE provided by the platform. Variables missing from the file fall
+// back to the process environment.
+//
+// Each line of the file is a key=value pair, split at the first '=', with
+// surrounding whitespace removed from both. Blank lines and lines starting
+// with '#' or '!' are ignored. Any other line returns ErrMalformedProperties
+// naming its line number.
+func UnmarshalFromPropertiesFile(
+   config any,
+   pathEnv string,
+   opts ...Option,
+) error {
+   env := snapshotEnv()
+
+   path, ok := env.lookup(pathEnv)
+   if !ok || path == "" {
+      errMsg := fmt.Sprintf("required '%s' missing", pathEnv)
+      return fmt.Errorf("%s; %w", errMsg, ErrMissingEnvVariable)
+   }
+
+   f, err := os.Open(path)
+   if err != nil {
+      return fmt.Errorf("open properties file: %w", err)
+   }
+   defer f.Close()
+
+   props, err := parseProperties(f)
+   if err != nil {
+      return fmt.Errorf("properties file '%s': %w", path, err)
+   }
+
+   for name, val := range props {
+      env[name] = val
+   }
+
+   return unmarshal(config, env, opts)
+}
+
+// parseProperties reads the key=value pairs of a properties file.
+func parseProperties(r io.Reader) (map[string]string, error) {
+   props := make(map[string]string)
+   scanner := bufio.NewScanner(r)
+   for lineNum := 1; scanner.Scan(); lineNum++ {
+      line := strings.TrimSpace(scanner.Text())
+      if line == "" || line[0] == '#' || line[0] == '!' {
+         continue
+      }
+
+      key, val, ok := strings.Cut(line, "=")
+      key = strings.TrimSpace(key)
+      if !ok || key == "" {
+         errMsg := fmt.Sprintf("line %d: expected key=value", lineNum)
+         return nil, fmt.Errorf("%s; %w", errMsg, ErrMalformedProperties)
+      }
+
+      props[key] = strings.TrimSpace(val)
+   }
+
+   if err := scanner.Err(); err != nil {
+      return nil, err
+   }
+
+   return props, nil
+}
@@ -0,0 +1,92 @@
+package environ_test
+
+import (
+   "os"
+   "path/filepath"
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+)
+
+type propertiesConfig struct {
+   Host  string `env:"TEST_PROPS_HOST"`
+   Port  int    `env:"TEST_PROPS_PORT"`
+   Debug bool   `env:"TEST_PROPS_DEBUG,optional"`
+   Token string `env:"TEST_PROPS_TOKEN"`
+}
+
+// writeProperties writes contents to a properties file and points
+// TEST_CONFIG_FILE at it.
+func writeProperties(t *testing.T, contents string) {
+   t.Helper()
+
+   path := filepath.Join(t.TempDir(), "app.properties")
+   if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+      t.Fatal(err)
+   }
+   t.Setenv("TEST_CONFIG_FILE", path)
+}
+
+func TestUnmarshalFromPropertiesFile_ValidFile_ShouldPopulateConfig(
+   t *testing.T,
+) {
+   writeProperties(t, "# service settings\n"+
+      "TEST_PROPS_HOST = db.internal\n"+
+      "\n"+
+      "! legacy comment\n"+
+      "TEST_PROPS_PORT=5432\n"+
+      "TEST_PROPS_DEBUG=true\n")
+   t.Setenv("TEST_PROPS_HOST", "overridden-by-file")
+   t.Setenv("TEST_PROPS_TOKEN", "from-env")
+
+   config := propertiesConfig{}
+
+   err := environ.UnmarshalFromPropertiesFile(&config, "TEST_CONFIG_FILE")
+   assert.NoError(t, err)
+   assert.Equal(t, propertiesConfig{
+      Host:  "db.internal",
+      Port:  5432,
+      Debug: true,
+      Token: "from-env",
+   }, config)
+}
+
+func TestUnmarshalFromPropertiesFile_MalformedLine_ShouldReportLineNumber(
+   t *testing.T,
+) {
+   writeProperties(t, "TEST_PROPS_HOST=db.internal\n"+
+      "# comment\n"+
+      "TEST_PROPS_PORT 5432\n")
+
+   err := environ.UnmarshalFromPropertiesFile(
+      &propertiesConfig{}, "TEST_CONFIG_FILE",
+   )
+   assert.ErrorIs(t, err, environ.ErrMalformedProperties)
+   assert.ErrorContains(t, err, "line 3")
+}
+
+func TestUnmarshalFromPropertiesFile_PathVarMissing_ShouldReturnMissing(
+   t *testing.T,
+) {
+   err := environ.UnmarshalFromPropertiesFile(
+      &propertiesConfig{}, "TEST_CONFIG_FILE_UNSET",
+   )
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
+
+func TestUnmarshalFromPropertiesFile_EnvironmentInFile_ShouldApplyRequiredIn(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      SentryDSN string `env:"TEST_PROPS_SENTRY_DSN,required_in=prd"`
+   }
+
+   writeProperties(t, "ENVIRONMENT=prd\n")
+   t.Setenv("ENVIRONMENT", "dev")
+
+   err := environ.UnmarshalFromPropertiesFile(
+      &EnvironTest{}, "TEST_CONFIG_FILE",
+   )
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
@@ -3,14 +3,27 @@ package environ
 import (
    "errors"
    "fmt"
+   "log/slog"
    "os"
    "reflect"
+   "slices"
    "strconv"
    "strings"
+   "time"
 )
 
 const msgInvalidValueFmt = "invalid value '%s' for type '%s'"
 
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// durationUnits are the supported values of the `unit` tag option.
+var durationUnits = map[string]time.Duration{
+   "ms": time.Millisecond,
+   "s":  time.Second,
+   "m":  time.Minute,
+   "h":  time.Hour,
+}
+
 var (
    // ErrMissingEnvVariable indicates the expected environment variable was
    // not provided.
@@ -20,17 +33,247 @@ var (
    ErrNotSupportedTypeFound = errors.New("environ, env type not supported")
    // ErrMalformedTag indicates that the field tag is not corrected formatted.
    ErrMalformedTag = errors.New("environ, malformed tag")
+   // ErrSecretResolverMissing indicates a field is tagged `secretmanager` but
+   // no SecretResolver was configured.
+   ErrSecretResolverMissing = errors.New("environ, secret resolver missing")
+   // ErrSecretNotFound should be wrapped by a SecretResolver when the secret
+   // or its latest version does not exist.
+   ErrSecretNotFound = errors.New("environ, secret not found")
+   // ErrSecretPermissionDenied should be wrapped by a SecretResolver when the
+   // caller is not permitted to access the secret.
+   ErrSecretPermissionDenied = errors.New("environ, secret permission denied")
+   // ErrUnbalancedQuote indicates a slice value has an unterminated quoted
+   // element.
+   ErrUnbalancedQuote = errors.New("environ, unbalanced quote")
+   // ErrValueOutOfRange indicates a numeric value is outside the bounds set
+   // by the `min` and `max` tag options.
+   ErrValueOutOfRange = errors.New("environ, value out of range")
+   // ErrValidation indicates a value is not one of the values allowed by
+   // the `enum` tag option.
+   ErrValidation = errors.New("environ, validation failed")
+   // ErrIncompleteGroup indicates a variable was provided without the
+   // variables it requires through the `requires` tag option.
+   ErrIncompleteGroup = errors.New("environ, incomplete variable group")
+   // ErrUnexportedTaggedField indicates an unexported field carries an `env`
+   // tag, which Unmarshal cannot set. It is only reported with
+   // WithUnexportedAsError.
+   ErrUnexportedTaggedField = errors.New(
+      "environ, unexported field has env tag",
+   )
 )
 
+// SecretResolver fetches the payload of the latest version of the secret
+// identified by name, e.g. a GCP Secret Manager resource name such as
+// projects/my-project/secrets/db-password. Implementations should wrap
+// ErrSecretNotFound or ErrSecretPermissionDenied so callers can distinguish
+// the failures.
+type SecretResolver func(name string) (string, error)
+
+// Option configures the behavior of Unmarshal.
+type Option func(*options)
+
+type options struct {
+   emptyAsUnset      bool
+   looseBools        bool
+   trimSpace         bool
+   unexportedAsError bool
+   watchInterval     time.Duration
+   resolver          SecretResolver
+   environment       *Environment
+}
+
+// WithEmptyAsUnset treats every variable that is set to an empty string as
+// absent, so defaults apply and missing-variable checks fire. The same
+// behavior can be enabled per field with the `empty_as_unset` tag option.
+func WithEmptyAsUnset() Option {
+   return func(o *options) {
+      o.emptyAsUnset = true
+   }
+}
+
+// WithLooseBools accepts yes/no, on/off and enabled/disabled, in any case, for
+// every bool field in addition to the values understood by strconv.ParseBool.
+// The same behavior can be enabled per field with the `loose_bool` tag option.
+func WithLooseBools() Option {
+   return func(o *options) {
+      o.looseBools = true
+   }
+}
+
+// WithTrimSpace trims surrounding whitespace, such as a trailing newline
+// copied from a console, from values before they are converted. String fields
+// are left untouched since whitespace may be meaningful; use the `trim` tag
+// option to trim a string field.
+func WithTrimSpace() Option {
+   return func(o *options) {
+      o.trimSpace = true
+   }
+}
+
+// WithUnexportedAsError reports unexported fields carrying an `env` tag as
+// ErrUnexportedTaggedField, e.g. after a field was accidentally lowercased.
+// By default such fields are silently skipped.
+func WithUnexportedAsError() Option {
+   return func(o *options) {
+      o.unexportedAsError = true
+   }
+}
+
+// WithEnvironment sets the environment used to evaluate the `required_in` tag
+// option. Without it, the environment is resolved from the ENVIRONMENT
+// variable read by each call, like any other variable, so a value from a
+// properties file or flag applies and changes between calls are observed.
+func WithEnvironment(env Environment) Option {
+   return func(o *options) {
+      o.environment = &env
+   }
+}
+
+// WithSecretResolver configures the resolver used for fields tagged with the
+// `secretmanager` option. Wiring the resolver in keeps environ free of any
+// dependency on a particular secret store.
+func WithSecretResolver(resolver SecretResolver) Option {
+   return func(o *options) {
+      o.resolver = resolver
+   }
+}
+
+// fieldTag is the decoded form of an `env` struct tag.
+type fieldTag struct {
+   name         string
+   optional     bool
+   defaultValue string
+   hasDefault   bool
+   defaultBy    string
+   defaultCases map[string]string
+   emptyAsUnset bool
+   looseBool    bool
+   trim         bool
+   secret       bool
+   compose      string
+   unit         time.Duration
+   minValue     float64
+   hasMin       bool
+   maxValue     float64
+   hasMax       bool
+   requiredIn   []Environment
+   delim        byte
+   osList       bool
+   percent      bool
+   repeated     bool
+   enum         []string
+   enumFold     bool
+   requires     []string
+   message      string
+}
+
 // Unmarshal parses the supplied config for the `env` tags on its fields and
 // applies the associated env variables to the field value.
 //
 // e.g. fieldOne string `env:"MY_FIELD"` will apply the environment variable
 // MY_FIELD to the value of fieldOne.
-func Unmarshal(config any) error {
+//
+// The tag name may be followed by comma separated options:
+//   - optional: a missing variable is not an error.
+//   - default=VALUE: VALUE is applied when the variable is missing. Fields
+//     with a default are implicitly optional.
+//   - default_by=VAR:A=X;B=Y: when the variable is missing, the default is
+//     selected by the value of the VAR variable, e.g.
+//     `env:"BUCKET,default_by=REGION:us=us-bucket;eu=eu-bucket"` applies
+//     us-bucket when REGION=us. When VAR is missing or matches no case, a
+//     plain default applies if given, and the variable is otherwise treated
+//     as missing.
+//   - empty_as_unset: a variable set to the empty string is treated as
+//     missing.
+//   - loose_bool: bool fields also accept yes/no, on/off and
+//     enabled/disabled.
+//   - trim: surrounding whitespace is removed before conversion.
+//   - secretmanager: the variable holds a secret resource name, and the
+//     value is fetched with the SecretResolver configured through
+//     WithSecretResolver.
+//   - unit=ms|s|m|h: time.Duration fields are parsed as a bare integer
+//     count of the unit, e.g. `env:"TIMEOUT,unit=s"` reads TIMEOUT=30 as
+//     30 seconds. Without a unit, time.Duration fields are parsed with
+//     time.ParseDuration.
+//   - compose=TEMPLATE: when the variable is missing, the value is built
+//     from TEMPLATE by replacing each {VAR} placeholder with the value of
+//     the VAR environment variable, e.g.
+//     `env:"DATABASE_URL,compose=postgres://{DB_HOST}:{DB_PORT}/{DB_NAME}"`.
+//     A placeholder that cannot be resolved is an error.
+//   - required_in=ENV[,ENV...]: the variable is only required in the listed
+//     environments, e.g. `env:"SENTRY_DSN,required_in=prd,stg"`, and is
+//     optional elsewhere. See WithEnvironment. When the environment cannot
+//     be resolved the variable is treated as optional and a warning logged.
+//   - enum=A|B|...: string values, and each element of string slices, must
+//     be one of the listed values, e.g. `env:"LOG_FORMAT,enum=json|text"`.
+//     With case_insensitive, values match regardless of case and are set
+//     to the listed spelling.
+//   - requires=VAR[,VAR...]: when the variable is set, the listed variables
+//     must be set too, e.g. `env:"SMTP_HOST,requires=SMTP_USER,SMTP_PASS"`.
+//     A partial group returns ErrIncompleteGroup; none being set is fine.
+//   - min=N, max=N: numeric values, and each element of numeric slices,
+//     must be within the inclusive bounds.
+//   - percent: float fields are parsed as a percentage with an optional
+//     trailing %, e.g. `env:"SAMPLE_RATE,percent"` reads SAMPLE_RATE=10% as
+//     0.1. min and max bound the resulting fraction.
+//   - msg=TEXT: TEXT is appended to the errors of the field, e.g.
+//     `env:"LICENSE_KEY,msg=Set LICENSE_KEY to the value from the vendor
+//     portal"`, to guide operators. It must be the last option and runs to
+//     the end of the tag, so TEXT may contain commas.
+//
+// An empty name, empty options other than trailing ones, unknown or
+// repeated options and contradictory combinations, i.e. required_in with
+// optional or default, return ErrMalformedTag.
+//
+// Slice fields are populated from a comma separated list, each element being
+// converted to the element type of the slice. Elements containing commas can
+// be wrapped in double quotes, e.g. `"a,b",c` yields the elements a,b and c,
+// and a backslash escapes a quote or backslash within an element. Map fields
+// are populated the same way from key=value elements. The `delim=X` option
+// replaces the comma with the single character X, which also allows
+// multi-element defaults, e.g. `env:"HOSTS,delim=;,default=a;b"`. Defaults
+// are parsed like variable values, and an empty value yields an empty,
+// non-nil slice or map.
+//
+// With the `oslist` option a PATH-like list is instead split on
+// os.PathListSeparator, i.e. ':' on Unix and ';' on Windows, so
+// `env:"EXTRA_DIRS,oslist"` reads the same variable on every platform. Empty
+// entries, e.g. from a trailing separator, are dropped, and quotes and
+// backslashes have no special meaning. It cannot be combined with delim.
+//
+// Endpoint fields, and netip.AddrPort fields for IP addresses only, are
+// parsed from host:port values, so `env:"PEERS"` on a []Endpoint field reads
+// PEERS=a.internal:7000,b.internal:7000. A missing port is an error wrapping
+// ErrInvalidEndpoint.
+//
+// The sync/atomic types atomic.Bool, atomic.Int32, atomic.Int64 and
+// atomic.Value, which is set to a string, are parsed as their value types,
+// and slog.LevelVar fields are parsed from level names such as DEBUG, so
+// the fields can be kept up to date with Watch.
+//
+// ByteSize fields are parsed with ParseByteSize from a byte count with an
+// optional binary unit, so `env:"MEMORY_LIMIT"` reads MEMORY_LIMIT=512MiB.
+//
+// With the `repeated` option a slice is instead collected from indexed
+// variables, e.g. `env:"ORIGIN,repeated"` reads ORIGIN_1, ORIGIN_2 and so on
+// up to the first missing index.
+//
+// Every field is processed even if others fail; the failures are returned
+// together as a *ValidationError.
+func Unmarshal(config any, opts ...Option) error {
+   return unmarshal(config, snapshotEnv(), opts)
+}
+
+// unmarshal populates config from the variables of env.
+func unmarshal(config any, env envSnapshot, opts []Option) error {
+   var o options
+   for _, opt := range opts {
+      opt(&o)
+   }
+
    v := reflect.ValueOf(config).Elem()
    t := reflect.TypeOf(config).Elem()
-   var errs []error
+   var errs []FieldError
 
    for i := 0; i < v.NumField(); i++ {
       var envErr error
@@ -39,80 +282,500 @@ func Unmarshal(config any) error {
       fieldVal := v.Field(i)
       fieldType := t.Field(i)
 
-      if !fieldVal.CanSet() {
+      tagEncoded, ok := fieldType.Tag.Lookup("env")
+      if !ok {
          continue
       }
 
-      tagEncoded, ok := fieldType.Tag.Lookup("env")
-      if !ok {
+      if !fieldVal.CanSet() {
+         if o.unexportedAsError {
+            tag, _ := parseTagValue(tagEncoded)
+            errMsg = fmt.Sprintf("field '%s' is unexported", fieldType.Name)
+            envErr = fmt.Errorf("%s; %w", errMsg, ErrUnexportedTaggedField)
+            errs = append(errs, newFieldError(fieldType, tag, envErr))
+         }
+
          continue
       }
 
-      tag, optional, err := parseTagValue(tagEncoded)
+      tag, err := parseTagValue(tagEncoded)
       if err != nil {
          errMsg = fmt.Sprintf("env struct tag '%s' malformed", tagEncoded)
-         envErr = fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
-         errs = append(errs, envErr)
+         envErr = fmt.Errorf("%s; %w", errMsg, err)
+         errs = append(errs, newFieldError(fieldType, tag, envErr))
 
          continue
       }
 
-      val, ok := os.LookupEnv(tag)
-      if !ok && !optional {
-         errMsg = fmt.Sprintf("required '%s' missing", tag)
-         envErr = fmt.Errorf("%s; %w", errMsg, ErrMissingEnvVariable)
-         errs = append(errs, envErr)
+      if _, err := populateField(fieldVal, tag, env, o); err != nil {
+         errs = append(errs, newFieldError(fieldType, tag, err))
+      }
+   }
+
+   if len(errs) > 0 {
+      return &ValidationError{Fields: errs}
+   }
+
+   return nil
+}
+
+// populateField resolves the value of the variable described by tag from env,
+// falling back to its compose template and defaults, and assigns it to
+// fieldVal. It reports whether fieldVal was assigned; a missing optional
+// variable leaves it untouched.
+func populateField(
+   fieldVal reflect.Value,
+   tag fieldTag,
+   env envSnapshot,
+   o options,
+) (bool, error) {
+   if tag.repeated {
+      if elems := env.indexed(tag.name); len(elems) > 0 {
+         return true, setElements(fieldVal, elems, tag, o)
+      }
+   }
+
+   val, ok := env.lookup(tag.name)
+   if tag.repeated {
+      // Only the indexed variables populate a repeated field.
+      val, ok = "", false
+   }
+
+   if ok && val == "" && (tag.emptyAsUnset || o.emptyAsUnset) {
+      ok = false
+   }
+
+   if ok && len(tag.requires) > 0 {
+      if err := checkRequires(env, tag, o); err != nil {
+         return false, err
+      }
+   }
+
+   if !ok && tag.compose != "" {
+      composed, err := composeValue(tag.compose, env)
+      if err != nil {
+         errMsg := fmt.Sprintf("compose for '%s' failed", tag.name)
+         return false, fmt.Errorf("%s; %w", errMsg, err)
+      }
+      val, ok = composed, true
+   }
+
+   if !ok && tag.defaultBy != "" {
+      val, ok = selectDefault(env, tag)
+   }
+
+   if !ok && tag.hasDefault {
+      val, ok = tag.defaultValue, true
+   }
+
+   if !ok && isRequired(tag, env, o) {
+      errMsg := fmt.Sprintf("required '%s' missing", tag.name)
+      return false, fmt.Errorf("%s; %w", errMsg, ErrMissingEnvVariable)
+   }
+
+   if !ok {
+      return false, nil
+   }
+
+   if tag.secret {
+      secret, err := resolveSecret(o.resolver, tag.name, val)
+      if err != nil {
+         return false, err
+      }
+      val = secret
+   }
+
+   return true, setValue(fieldVal, val, tag, o)
+}
+
+// MustUnmarshal is like Unmarshal but panics if the config cannot be
+// populated. It is intended for program initialization, such as local
+// development or tests, where a loud failure is preferable; services run
+// under a supervisor should call Unmarshal and handle the returned error.
+func MustUnmarshal(config any, opts ...Option) {
+   if err := Unmarshal(config, opts...); err != nil {
+      panic(fmt.Sprintf("environ.MustUnmarshal: %v", err))
+   }
+}
+
+// envSnapshot is a copy of the process environment taken once per Unmarshal
+// call, so every field observes the same values even if the environment is
+// modified while parsing, e.g. by a SecretResolver.
+type envSnapshot map[string]string
 
+// snapshotEnv parses os.Environ into an envSnapshot.
+func snapshotEnv() envSnapshot {
+   vars := os.Environ()
+   env := make(envSnapshot, len(vars))
+   for _, kv := range vars {
+      // Skip malformed entries and Windows' hidden =C: style variables.
+      name, val, ok := strings.Cut(kv, "=")
+      if !ok || name == "" {
          continue
       }
+      env[name] = val
+   }
 
+   return env
+}
+
+// lookup returns the value of the named variable and whether it is set.
+func (e envSnapshot) lookup(name string) (string, bool) {
+   val, ok := e[name]
+   return val, ok
+}
+
+// environment resolves the environment from the ENVIRONMENT variable of the
+// snapshot as GetEnvironment does, returning Unknown if it is missing or
+// invalid.
+func (e envSnapshot) environment() Environment {
+   val, _ := e.lookup(environmentVarName)
+   env, _ := parseEnvironmentVar(val)
+
+   return env
+}
+
+// indexed returns the values of the variables NAME_1, NAME_2 and so on, in
+// order, stopping at the first index that is not set.
+func (e envSnapshot) indexed(name string) []string {
+   var vals []string
+   for i := 1; ; i++ {
+      val, ok := e.lookup(name + "_" + strconv.Itoa(i))
       if !ok {
-         continue
+         return vals
       }
+      vals = append(vals, val)
+   }
+}
 
-      switch fieldType.Type.Kind() {
-      case reflect.Bool:
-         boolVal, err := strconv.ParseBool(val)
-         if err != nil {
-            errMsg = fmt.Sprintf(msgInvalidValueFmt, val, fieldType.Type.Name())
-            envErr = fmt.Errorf("%s; %w", errMsg, err)
-            errs = append(errs, envErr)
+// selectDefault returns the default_by case of tag matching the value of the
+// referenced variable, and whether one matched.
+func selectDefault(env envSnapshot, tag fieldTag) (string, bool) {
+   ref, ok := env.lookup(tag.defaultBy)
+   if !ok {
+      return "", false
+   }
 
-            continue
-         }
+   val, ok := tag.defaultCases[ref]
+   return val, ok
+}
 
-         fieldVal.SetBool(boolVal)
-      case reflect.String:
-         fieldVal.SetString(val)
-      case reflect.Float32, reflect.Float64:
-         floatVal, err := strconv.ParseFloat(val, fieldType.Type.Bits())
-         if err != nil {
-            errMsg = fmt.Sprintf(msgInvalidValueFmt, val, fieldType.Type.Name())
-            envErr = fmt.Errorf("%s; %w", errMsg, err)
-            errs = append(errs, envErr)
+// parseDefaultBy parses the VAR:A=X;B=Y value of a default_by option.
+func parseDefaultBy(optVal string) (string, map[string]string, error) {
+   ref, list, ok := strings.Cut(optVal, ":")
+   if !ok || ref == "" || list == "" {
+      return "", nil, ErrMalformedTag
+   }
 
-            continue
-         }
+   cases := map[string]string{}
+   for _, c := range strings.Split(list, ";") {
+      match, val, ok := strings.Cut(c, "=")
+      if !ok || match == "" {
+         return "", nil, ErrMalformedTag
+      }
+      cases[match] = val
+   }
 
-         fieldVal.SetFloat(floatVal)
-      case reflect.Int, reflect.Int32, reflect.Int64:
-         intVal, err := strconv.ParseInt(val, 10, fieldType.Type.Bits())
-         if err != nil {
-            errMsg = fmt.Sprintf(msgInvalidValueFmt, val, fieldType.Type.Name())
-            envErr = fmt.Errorf("%s; %w", errMsg, err)
-            errs = append(errs, envErr)
+   return ref, cases, nil
+}
 
-            continue
+// checkRequires verifies that every variable required by tag is set.
+func checkRequires(env envSnapshot, tag fieldTag, o options) error {
+   var missing []string
+   for _, name := range tag.requires {
+      val, ok := env.lookup(name)
+      if !ok || (val == "" && (tag.emptyAsUnset || o.emptyAsUnset)) {
+         missing = append(missing, name)
+      }
+   }
+
+   if len(missing) == 0 {
+      return nil
+   }
+
+   errMsg := fmt.Sprintf(
+      "'%s' set without %s", tag.name, strings.Join(missing, ", "),
+   )
+   return fmt.Errorf("%s; %w", errMsg, ErrIncompleteGroup)
+}
+
+// isRequired reports whether a missing variable for tag is an error.
+func isRequired(tag fieldTag, snapshot envSnapshot, o options) bool {
+   if len(tag.requiredIn) == 0 {
+      return !tag.optional
+   }
+
+   env := snapshot.environment()
+   if o.environment != nil {
+      env = *o.environment
+   }
+
+   if env == Unknown {
+      slog.Warn("environ, environment unresolved; treating as optional",
+         "name", tag.name,
+      )
+
+      return false
+   }
+
+   return slices.Contains(tag.requiredIn, env)
+}
+
+// setValue converts val to the kind of fieldVal and assigns it.
+func setValue(
+   fieldVal reflect.Value,
+   val string,
+   tag fieldTag,
+   o options,
+) error {
+   fieldType := fieldVal.Type()
+
+   if tag.trim || (o.trimSpace && fieldType.Kind() != reflect.String) {
+      val = strings.TrimSpace(val)
+   }
+
+   if _, ok := watchableTypes[fieldType]; ok {
+      return setAtomic(fieldVal, val, tag, o)
+   }
+
+   if fieldType == durationType {
+      return setDuration(fieldVal, val, tag)
+   }
+
+   if tag.unit != 0 {
+      errMsg := fmt.Sprintf(
+         "unit option not supported for type '%s'", fieldType.Name(),
+      )
+      return fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
+   }
+
+   if (tag.hasMin || tag.hasMax) && !isNumeric(fieldType.Kind()) &&
+      !isCollection(fieldType.Kind()) {
+      errMsg := fmt.Sprintf(
+         "min/max options not supported for type '%s'", fieldType.Name(),
+      )
+      return fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
+   }
+
+   if len(tag.enum) > 0 && fieldType.Kind() != reflect.String &&
+      !isCollection(fieldType.Kind()) {
+      errMsg := fmt.Sprintf(
+         "enum option not supported for type '%s'", fieldType.Name(),
+      )
+      return fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
+   }
+
+   if tag.percent && fieldType.Kind() != reflect.Float32 &&
+      fieldType.Kind() != reflect.Float64 && !isCollection(fieldType.Kind()) {
+      errMsg := fmt.Sprintf(
+         "percent option not supported for type '%s'", fieldType.Name(),
+      )
+      return fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
+   }
+
+   if fieldType == endpointType || fieldType == addrPortType {
+      return setEndpoint(fieldVal, val)
+   }
+
+   if fieldType == byteSizeType {
+      return setByteSize(fieldVal, val, tag)
+   }
+
+   switch fieldType.Kind() {
+   case reflect.Bool:
+      boolVal, err := parseBool(val, tag.looseBool || o.looseBools)
+      if err != nil {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, val, fieldType.Name())
+         return fmt.Errorf("%s; %w", errMsg, err)
+      }
+
+      fieldVal.SetBool(boolVal)
+   case reflect.String:
+      if len(tag.enum) > 0 {
+         allowed, err := matchEnum(val, tag)
+         if err != nil {
+            return err
          }
+         val = allowed
+      }
 
-         fieldVal.SetInt(intVal)
-      default:
-         errMsg = fmt.Sprintf(
-            "found type '%s' is not supported",
-            fieldType.Type.Name(),
-         )
-         envErr = fmt.Errorf("%s; %w", errMsg, ErrNotSupportedTypeFound)
-         errs = append(errs, envErr)
+      fieldVal.SetString(val)
+   case reflect.Float32, reflect.Float64:
+      num := val
+      if tag.percent {
+         num = strings.TrimSpace(strings.TrimSuffix(val, "%"))
+      }
+
+      floatVal, err := strconv.ParseFloat(num, fieldType.Bits())
+      if err != nil {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, val, fieldType.Name())
+         return fmt.Errorf("%s; %w", errMsg, err)
+      }
+
+      if tag.percent {
+         floatVal /= 100
+      }
+
+      if err := checkRange(floatVal, val, tag); err != nil {
+         return err
+      }
+
+      fieldVal.SetFloat(floatVal)
+   case reflect.Int, reflect.Int32, reflect.Int64:
+      intVal, err := strconv.ParseInt(val, 10, fieldType.Bits())
+      if err != nil {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, val, fieldType.Name())
+         return fmt.Errorf("%s; %w", errMsg, err)
+      }
+
+      if err := checkRange(float64(intVal), val, tag); err != nil {
+         return err
+      }
+
+      fieldVal.SetInt(intVal)
+   case reflect.Slice:
+      return setSlice(fieldVal, val, tag, o)
+   case reflect.Map:
+      return setMap(fieldVal, val, tag, o)
+   default:
+      errMsg := fmt.Sprintf(
+         "found type '%s' is not supported",
+         fieldType.Name(),
+      )
+      return fmt.Errorf("%s; %w", errMsg, ErrNotSupportedTypeFound)
+   }
+
+   return nil
+}
+
+// matchEnum returns the allowed value of tag matching val.
+func matchEnum(val string, tag fieldTag) (string, error) {
+   for _, allowed := range tag.enum {
+      if val == allowed || (tag.enumFold && strings.EqualFold(val, allowed)) {
+         return allowed, nil
+      }
+   }
+
+   errMsg := fmt.Sprintf(
+      "value '%s' not one of %s", val, strings.Join(tag.enum, ", "),
+   )
+   return "", fmt.Errorf("%s; %w", errMsg, ErrValidation)
+}
+
+// isNumeric reports whether kind is one of the supported numeric kinds.
+func isNumeric(kind reflect.Kind) bool {
+   switch kind {
+   case reflect.Float32, reflect.Float64,
+      reflect.Int, reflect.Int32, reflect.Int64:
+      return true
+   default:
+      return false
+   }
+}
+
+// checkRange verifies num, parsed from val, is within the tag bounds.
+func checkRange(num float64, val string, tag fieldTag) error {
+   if (tag.hasMin && num < tag.minValue) || (tag.hasMax && num > tag.maxValue) {
+      errMsg := fmt.Sprintf("value '%s' outside of %s", val, tagBounds(tag))
+      return fmt.Errorf("%s; %w", errMsg, ErrValueOutOfRange)
+   }
+
+   return nil
+}
+
+// tagBounds describes the min and max of tag, e.g. [1, 65535].
+func tagBounds(tag fieldTag) string {
+   lower, upper := "-inf", "+inf"
+   if tag.hasMin {
+      lower = strconv.FormatFloat(tag.minValue, 'g', -1, 64)
+   }
+   if tag.hasMax {
+      upper = strconv.FormatFloat(tag.maxValue, 'g', -1, 64)
+   }
+
+   return fmt.Sprintf("[%s, %s]", lower, upper)
+}
+
+// isCollection reports whether kind is populated from a delimited list.
+func isCollection(kind reflect.Kind) bool {
+   return kind == reflect.Slice || kind == reflect.Map
+}
+
+// splitCollection validates the element types of the slice or map fieldType
+// and splits val into its elements.
+func splitCollection(
+   fieldType reflect.Type,
+   val string,
+   tag fieldTag,
+) ([]string, error) {
+   nested := isCollection(fieldType.Elem().Kind())
+   if fieldType.Kind() == reflect.Map {
+      nested = nested || isCollection(fieldType.Key().Kind())
+   }
+
+   if nested {
+      errMsg := fmt.Sprintf(
+         "found type '%s' is not supported",
+         fieldType.String(),
+      )
+      return nil, fmt.Errorf("%s; %w", errMsg, ErrNotSupportedTypeFound)
+   }
+
+   if tag.osList {
+      return splitPathList(val), nil
+   }
+
+   delim := tag.delim
+   if delim == 0 {
+      delim = ','
+   }
+
+   elems, err := splitList(val, delim)
+   if err != nil {
+      errMsg := fmt.Sprintf(msgInvalidValueFmt, val, fieldType.String())
+      return nil, fmt.Errorf("%s; %w", errMsg, err)
+   }
+
+   return elems, nil
+}
+
+// setSlice splits val into its elements and converts each one to the element
+// type of fieldVal. An empty val yields an empty, non-nil slice.
+func setSlice(
+   fieldVal reflect.Value,
+   val string,
+   tag fieldTag,
+   o options,
+) error {
+   elems, err := splitCollection(fieldVal.Type(), val, tag)
+   if err != nil {
+      return err
+   }
+
+   return setElements(fieldVal, elems, tag, o)
+}
+
+// setElements converts each of elems to the element type of the slice
+// fieldVal and assigns the result.
+func setElements(
+   fieldVal reflect.Value,
+   elems []string,
+   tag fieldTag,
+   o options,
+) error {
+   fieldType := fieldVal.Type()
+   if fieldType.Kind() != reflect.Slice {
+      errMsg := fmt.Sprintf(
+         "repeated option not supported for type '%s'", fieldType.String(),
+      )
+      return fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
+   }
+
+   slice := reflect.MakeSlice(fieldType, len(elems), len(elems))
+   var errs []error
+   for i, elem := range elems {
+      if err := setValue(slice.Index(i), elem, tag, o); err != nil {
+         errs = append(errs, fmt.Errorf("element %d: %w", i, err))
       }
    }
 
@@ -120,21 +783,437 @@ func Unmarshal(config any) error {
       return errors.Join(errs...)
    }
 
+   fieldVal.Set(slice)
+
+   return nil
+}
+
+// setMap splits val into key=value elements and converts each key and value
+// to the key and element types of fieldVal. An empty val yields an empty,
+// non-nil map.
+func setMap(
+   fieldVal reflect.Value,
+   val string,
+   tag fieldTag,
+   o options,
+) error {
+   fieldType := fieldVal.Type()
+   elems, err := splitCollection(fieldType, val, tag)
+   if err != nil {
+      return err
+   }
+
+   m := reflect.MakeMapWithSize(fieldType, len(elems))
+   var errs []error
+   for i, elem := range elems {
+      rawKey, rawVal, ok := strings.Cut(elem, "=")
+      if !ok {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, elem, fieldType.String())
+         errs = append(errs, fmt.Errorf("element %d: %s", i, errMsg))
+
+         continue
+      }
+
+      key := reflect.New(fieldType.Key()).Elem()
+      if err := setValue(key, rawKey, fieldTag{trim: tag.trim}, o); err != nil {
+         errs = append(errs, fmt.Errorf("element %d key: %w", i, err))
+         continue
+      }
+
+      value := reflect.New(fieldType.Elem()).Elem()
+      if err := setValue(value, rawVal, tag, o); err != nil {
+         errs = append(errs, fmt.Errorf("element %d: %w", i, err))
+         continue
+      }
+
+      m.SetMapIndex(key, value)
+   }
+
+   if len(errs) > 0 {
+      return errors.Join(errs...)
+   }
+
+   fieldVal.Set(m)
+
+   return nil
+}
+
+// splitList splits a list separated by delim, honoring double quoted
+// elements and backslash escapes. An empty list yields no elements.
+func splitList(val string, delim byte) ([]string, error) {
+   if val == "" {
+      return nil, nil
+   }
+
+   var elems []string
+   var b strings.Builder
+   inQuote := false
+
+   for i := 0; i < len(val); i++ {
+      c := val[i]
+      switch {
+      case c == '\\' && i+1 < len(val):
+         i++
+         b.WriteByte(val[i])
+      case c == '"':
+         inQuote = !inQuote
+      case c == delim && !inQuote:
+         elems = append(elems, b.String())
+         b.Reset()
+      default:
+         b.WriteByte(c)
+      }
+   }
+
+   if inQuote {
+      return nil, ErrUnbalancedQuote
+   }
+
+   return append(elems, b.String()), nil
+}
+
+// pathListSeparator separates the entries of OS lists; it is a variable so
+// tests can simulate other platforms.
+var pathListSeparator = string(os.PathListSeparator)
+
+// splitPathList splits a PATH-like list on the OS path list separator,
+// dropping empty entries. Quotes and backslashes are kept as is, as they
+// appear in Windows paths.
+func splitPathList(val string) []string {
+   elems := []string{}
+   for _, elem := range strings.Split(val, pathListSeparator) {
+      if elem != "" {
+         elems = append(elems, elem)
+      }
+   }
+
+   return elems
+}
+
+// setDuration parses val as a time.Duration, either as a duration string or,
+// when the tag specifies a unit, as an integer count of that unit.
+func setDuration(fieldVal reflect.Value, val string, tag fieldTag) error {
+   if tag.unit == 0 {
+      d, err := time.ParseDuration(val)
+      if err != nil {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, val, durationType.String())
+         return fmt.Errorf("%s; %w", errMsg, err)
+      }
+
+      fieldVal.SetInt(int64(d))
+
+      return nil
+   }
+
+   count, err := strconv.ParseInt(val, 10, 64)
+   if err != nil {
+      errMsg := fmt.Sprintf(msgInvalidValueFmt, val, durationType.String())
+      return fmt.Errorf("%s; %w", errMsg, err)
+   }
+
+   fieldVal.SetInt(count * int64(tag.unit))
+
    return nil
 }
 
-func parseTagValue(value string) (envVar string, optional bool, err error) {
-   parts := strings.Split(value, ",")
-   for _, part := range parts {
+// resolveSecret fetches the secret named by val for the variable envVar.
+func resolveSecret(
+   resolver SecretResolver,
+   envVar string,
+   val string,
+) (string, error) {
+   if resolver == nil {
+      errMsg := fmt.Sprintf("secret for '%s' not resolvable", envVar)
+      return "", fmt.Errorf("%s; %w", errMsg, ErrSecretResolverMissing)
+   }
+
+   secret, err := resolver(val)
+   if err != nil {
+      errMsg := fmt.Sprintf("secret '%s' for '%s' not resolved", val, envVar)
+      return "", fmt.Errorf("%s; %w", errMsg, err)
+   }
+
+   return secret, nil
+}
+
+// composeValue replaces each {VAR} placeholder in tmpl with the value of the
+// VAR environment variable.
+func composeValue(tmpl string, env envSnapshot) (string, error) {
+   var b strings.Builder
+   var errs []error
+
+   for {
+      start := strings.IndexByte(tmpl, '{')
+      if start < 0 {
+         if strings.IndexByte(tmpl, '}') >= 0 {
+            return "", ErrMalformedTag
+         }
+         b.WriteString(tmpl)
+
+         break
+      }
+
+      end := strings.IndexByte(tmpl[start:], '}')
+      if end < 0 || strings.IndexByte(tmpl[:start], '}') >= 0 {
+         return "", ErrMalformedTag
+      }
+      end += start
+
+      name := tmpl[start+1 : end]
+      val, ok := env.lookup(name)
+      if name == "" || !ok {
+         errMsg := fmt.Sprintf("placeholder '%s' unresolved", name)
+         errs = append(errs,
+            fmt.Errorf("%s; %w", errMsg, ErrMissingEnvVariable),
+         )
+      }
+
+      b.WriteString(tmpl[:start])
+      b.WriteString(val)
+      tmpl = tmpl[end+1:]
+   }
+
+   if len(errs) > 0 {
+      return "", errors.Join(errs...)
+   }
+
+   return b.String(), nil
+}
+
+// parseBool parses val with strconv.ParseBool, additionally accepting common
+// on/off synonyms when loose is set.
+func parseBool(val string, loose bool) (bool, error) {
+   boolVal, err := strconv.ParseBool(val)
+   if err == nil || !loose {
+      return boolVal, err
+   }
+
+   switch strings.ToLower(val) {
+   case "yes", "y", "on", "enabled", "enable":
+      return true, nil
+   case "no", "n", "off", "disabled", "disable":
+      return false, nil
+   default:
+      return false, err
+   }
+}
+
+// tagFlags are the tag options that take no value.
+var tagFlags = map[string]bool{
+   "optional":         true,
+   "empty_as_unset":   true,
+   "loose_bool":       true,
+   "trim":             true,
+   "case_insensitive": true,
+   "repeated":         true,
+   "secretmanager":    true,
+   "oslist":           true,
+   "percent":          true,
+}
+
+// isTagFlag reports whether part is one of the tagFlags.
+func isTagFlag(part string) bool {
+   return tagFlags[strings.ToLower(part)]
+}
+
+// tagValueOptions are the tag options that take a value.
+var tagValueOptions = map[string]bool{
+   "unit":        true,
+   "min":         true,
+   "max":         true,
+   "required_in": true,
+   "requires":    true,
+   "enum":        true,
+   "delim":       true,
+   "compose":     true,
+   "default":     true,
+   "default_by":  true,
+}
+
+// parseTagValue decodes an `env` struct tag. The name must come first and be
+// non-empty. Trailing empty segments, e.g. "FOO,optional,", are tolerated,
+// while empty segments elsewhere, repeated options and unknown options
+// return an error wrapping ErrMalformedTag describing the problem, as do
+// invalid option values and contradictory options. The first problem found
+// is returned.
+func parseTagValue(value string) (fieldTag, error) {
+   var tag fieldTag
+   parts := strings.Split(strings.TrimRight(value, ","), ",")
+   if parts[0] == "" || strings.Contains(parts[0], "=") {
+      return tag, fmt.Errorf("missing variable name; %w", ErrMalformedTag)
+   }
+
+   tag.name = parts[0]
+
+   malformed := func(opt string) error {
+      return fmt.Errorf("'%s' option '%s': %w", tag.name, opt, ErrMalformedTag)
+   }
+
+   // The message runs to the end of the tag, commas included.
+   for i, part := range parts[1:] {
+      if key, msg, ok := strings.Cut(part, "="); ok &&
+         strings.EqualFold(key, "msg") {
+         rest := append([]string{msg}, parts[i+2:]...)
+         tag.message = strings.TrimSpace(strings.Join(rest, ","))
+         if tag.message == "" {
+            return tag, fmt.Errorf("empty msg option; %w", ErrMalformedTag)
+         }
+         parts = parts[:i+1]
+
+         break
+      }
+   }
+
+   seen := map[string]bool{}
+   inRequiredIn, inRequires := false, false
+   for _, part := range parts[1:] {
+      key, optVal, hasVal := strings.Cut(part, "=")
+
+      if part == "" {
+         return tag, fmt.Errorf("empty option; %w", ErrMalformedTag)
+      }
+
+      // Environments listed after required_in continue the list.
+      if inRequiredIn && !hasVal {
+         env, envErr := ParseEnvironment(part)
+         if envErr == nil && env != Unknown {
+            tag.requiredIn = append(tag.requiredIn, env)
+            continue
+         }
+      }
+      inRequiredIn = false
+
+      // Variables listed after requires continue the list.
+      if inRequires && !hasVal && !isTagFlag(part) {
+         tag.requires = append(tag.requires, part)
+         continue
+      }
+      inRequires = false
+
+      option := strings.ToLower(key)
+      if hasVal && tagValueOptions[option] || !hasVal && tagFlags[option] {
+         if seen[option] {
+            errMsg := fmt.Sprintf("duplicate option '%s'", option)
+            return tag, fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
+         }
+         seen[option] = true
+      }
+
       //nolint:gocritic
       if strings.EqualFold(part, "optional") {
-         optional = true
-      } else if envVar == "" {
-         envVar = part
+         tag.optional = true
+      } else if strings.EqualFold(part, "empty_as_unset") {
+         tag.emptyAsUnset = true
+      } else if strings.EqualFold(part, "loose_bool") {
+         tag.looseBool = true
+      } else if strings.EqualFold(part, "trim") {
+         tag.trim = true
+      } else if strings.EqualFold(part, "case_insensitive") {
+         tag.enumFold = true
+      } else if strings.EqualFold(part, "repeated") {
+         tag.repeated = true
+      } else if strings.EqualFold(part, "oslist") {
+         tag.osList = true
+      } else if strings.EqualFold(part, "percent") {
+         tag.percent = true
+      } else if strings.EqualFold(part, "secretmanager") {
+         tag.secret = true
+      } else if hasVal && strings.EqualFold(key, "unit") {
+         unit, ok := durationUnits[strings.ToLower(optVal)]
+         if !ok {
+            return tag, malformed(part)
+         }
+         tag.unit = unit
+      } else if hasVal && strings.EqualFold(key, "min") {
+         bound, parseErr := strconv.ParseFloat(optVal, 64)
+         if parseErr != nil {
+            return tag, malformed(part)
+         }
+         tag.minValue, tag.hasMin = bound, true
+      } else if hasVal && strings.EqualFold(key, "max") {
+         bound, parseErr := strconv.ParseFloat(optVal, 64)
+         if parseErr != nil {
+            return tag, malformed(part)
+         }
+         tag.maxValue, tag.hasMax = bound, true
+      } else if hasVal && strings.EqualFold(key, "required_in") {
+         env, envErr := ParseEnvironment(optVal)
+         if envErr != nil || env == Unknown {
+            return tag, malformed(part)
+         }
+         tag.requiredIn = append(tag.requiredIn, env)
+         inRequiredIn = true
+      } else if hasVal && strings.EqualFold(key, "requires") {
+         if optVal == "" {
+            return tag, malformed(part)
+         }
+         tag.requires = append(tag.requires, optVal)
+         inRequires = true
+      } else if hasVal && strings.EqualFold(key, "enum") {
+         tag.enum = strings.Split(optVal, "|")
+      } else if hasVal && strings.EqualFold(key, "delim") {
+         if len(optVal) != 1 || strings.ContainsAny(optVal, `"\`) {
+            return tag, malformed(part)
+         }
+         tag.delim = optVal[0]
+      } else if hasVal && strings.EqualFold(key, "compose") {
+         tag.compose = optVal
+      } else if hasVal && strings.EqualFold(key, "default") {
+         tag.defaultValue, tag.hasDefault = optVal, true
+      } else if hasVal && strings.EqualFold(key, "default_by") {
+         ref, cases, parseErr := parseDefaultBy(optVal)
+         if parseErr != nil {
+            return tag, malformed(part)
+         }
+         tag.defaultBy, tag.defaultCases = ref, cases
       } else {
-         err = ErrMalformedTag
+         // Unknown options, e.g. a misspelled "defualt=", are rejected
+         // rather than ignored.
+         errMsg := fmt.Sprintf("unknown option '%s'", part)
+         return tag, fmt.Errorf("%s; %w", errMsg, ErrMalformedTag)
       }
    }
 
-   return
+   // A variable cannot be both required in some environments and optional
+   // or defaulted everywhere.
+   if len(tag.requiredIn) > 0 && tag.optional {
+      return tag, malformed("required_in")
+   }
+   if len(tag.requiredIn) > 0 && tag.hasDefault {
+      return tag, malformed("required_in")
+   }
+
+   // A compose template either resolves or fails, so defaults would never
+   // apply. A plain default alongside default_by is its fallback.
+   if tag.compose != "" && tag.hasDefault {
+      return tag, malformed("default")
+   }
+   if tag.compose != "" && tag.defaultBy != "" {
+      return tag, malformed("default_by")
+   }
+
+   // A variable cannot select its own default.
+   if tag.defaultBy == tag.name {
+      return tag, malformed("default_by")
+   }
+
+   // The separator of an OS list is fixed by the platform, and only one
+   // source may populate a slice.
+   if tag.osList && tag.delim != 0 {
+      return tag, malformed("delim")
+   }
+   if tag.osList && tag.repeated {
+      return tag, malformed("repeated")
+   }
+
+   if tag.hasMin && tag.hasMax && tag.minValue > tag.maxValue {
+      return tag, malformed("min")
+   }
+
+   // case_insensitive only applies to the values listed by enum.
+   if tag.enumFold && len(tag.enum) == 0 {
+      return tag, malformed("case_insensitive")
+   }
+
+   return tag, nil
 }
@@ -1,10 +1,14 @@
 package environ_test
 
 import (
+   "errors"
    "fmt"
    "math"
+   "os"
    "strconv"
+   "strings"
    "testing"
+   "time"
 
    "github.com/clintrovert/gobackend/environ"
    "github.com/stretchr/testify/assert"
@@ -42,3 +46,1273 @@ func TestUnmarshal_AllSupportedTypes_ShouldSucceed(t *testing.T) {
    assert.Equal(t, float32(math.MaxFloat32), env.TestFloat32)
    assert.Equal(t, float64(math.MaxFloat64), env.TestFloat64)
 }
+
+func TestUnmarshal_EmptyAsUnsetWithDefault_ShouldApplyDefault(t *testing.T) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_STRING,empty_as_unset,default=fallback"`
+      TestInt    int    `env:"TEST_INT,empty_as_unset,default=42"`
+   }
+
+   t.Setenv("TEST_STRING", "")
+   t.Setenv("TEST_INT", "")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "fallback", env.TestString)
+   assert.Equal(t, 42, env.TestInt)
+}
+
+func TestUnmarshal_EmptyAsUnsetRequired_ShouldReturnMissing(t *testing.T) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_STRING,empty_as_unset"`
+   }
+
+   t.Setenv("TEST_STRING", "")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
+
+func TestUnmarshal_EmptyWithoutOption_ShouldKeepEmptyValue(t *testing.T) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_STRING,default=fallback"`
+   }
+
+   t.Setenv("TEST_STRING", "")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "", env.TestString)
+}
+
+func TestUnmarshal_WithEmptyAsUnsetOption_ShouldApplyToAllFields(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      TestString   string `env:"TEST_STRING,default=fallback"`
+      TestRequired string `env:"TEST_REQUIRED"`
+   }
+
+   t.Setenv("TEST_STRING", "")
+   t.Setenv("TEST_REQUIRED", "")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env, environ.WithEmptyAsUnset())
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+   assert.Equal(t, "fallback", env.TestString)
+}
+
+func TestUnmarshal_UnexportedTaggedField_ShouldSkipByDefault(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_STRING"`
+      testHidden string `env:"TEST_HIDDEN"`
+   }
+
+   t.Setenv("TEST_STRING", "value")
+   t.Setenv("TEST_HIDDEN", "hidden")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "value", env.TestString)
+   assert.Empty(t, env.testHidden)
+}
+
+func TestUnmarshal_WithUnexportedAsError_ShouldReturnErr(t *testing.T) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_STRING"`
+      testHidden string `env:"TEST_HIDDEN,optional"`
+      testPlain  string
+   }
+
+   t.Setenv("TEST_STRING", "value")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env, environ.WithUnexportedAsError())
+   assert.ErrorIs(t, err, environ.ErrUnexportedTaggedField)
+   assert.Equal(t, "value", env.TestString)
+   assert.Empty(t, env.testHidden)
+   assert.Empty(t, env.testPlain)
+
+   var validationErr *environ.ValidationError
+   if assert.ErrorAs(t, err, &validationErr) {
+      assert.Len(t, validationErr.Fields, 1)
+      assert.Equal(t, "testHidden", validationErr.Fields[0].Field)
+      assert.Equal(t, "TEST_HIDDEN", validationErr.Fields[0].Var)
+      assert.Equal(t,
+         environ.ErrUnexportedTaggedField, validationErr.Fields[0].Kind,
+      )
+   }
+}
+
+func TestUnmarshal_LooseBoolSynonyms_ShouldParse(t *testing.T) {
+   type EnvironTest struct {
+      TestBool bool `env:"TEST_BOOL,loose_bool"`
+   }
+
+   tests := []struct {
+      value string
+      want  bool
+   }{
+      {value: "yes", want: true},
+      {value: "YES", want: true},
+      {value: "no", want: false},
+      {value: "On", want: true},
+      {value: "off", want: false},
+      {value: "Enabled", want: true},
+      {value: "disabled", want: false},
+      {value: "1", want: true},
+      {value: "0", want: false},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.value, func(t *testing.T) {
+         t.Setenv("TEST_BOOL", tt.value)
+
+         env := EnvironTest{TestBool: !tt.want}
+
+         err := environ.Unmarshal(&env)
+         assert.NoError(t, err)
+         assert.Equal(t, tt.want, env.TestBool)
+      })
+   }
+}
+
+func TestUnmarshal_LooseBoolUnknownValue_ShouldReturnInvalidValue(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      TestBool bool `env:"TEST_BOOL,loose_bool"`
+   }
+
+   t.Setenv("TEST_BOOL", "maybe")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorContains(t, err, "invalid value 'maybe' for type 'bool'")
+}
+
+func TestUnmarshal_WithLooseBoolsOption_ShouldParseSynonyms(t *testing.T) {
+   type EnvironTest struct {
+      TestBool bool `env:"TEST_BOOL"`
+   }
+
+   t.Setenv("TEST_BOOL", "on")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.Error(t, err)
+
+   err = environ.Unmarshal(&env, environ.WithLooseBools())
+   assert.NoError(t, err)
+   assert.True(t, env.TestBool)
+}
+
+func TestUnmarshal_ComposeDirectValueSet_ShouldUseDirectValue(t *testing.T) {
+   type EnvironTest struct {
+      DatabaseURL string `env:"DATABASE_URL,compose=postgres://{DB_HOST}:{DB_PORT}/{DB_NAME}"` //nolint:lll
+   }
+
+   t.Setenv("DATABASE_URL", "postgres://direct:5432/db")
+   t.Setenv("DB_HOST", "composed")
+   t.Setenv("DB_PORT", "6543")
+   t.Setenv("DB_NAME", "other")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "postgres://direct:5432/db", env.DatabaseURL)
+}
+
+func TestUnmarshal_ComposeDirectValueMissing_ShouldCompose(t *testing.T) {
+   type EnvironTest struct {
+      DatabaseURL string `env:"DATABASE_URL,compose=postgres://{DB_HOST}:{DB_PORT}/{DB_NAME}"` //nolint:lll
+   }
+
+   t.Setenv("DB_HOST", "localhost")
+   t.Setenv("DB_PORT", "5432")
+   t.Setenv("DB_NAME", "app")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "postgres://localhost:5432/app", env.DatabaseURL)
+}
+
+func TestUnmarshal_ComposeUnresolvedPlaceholder_ShouldReturnMissing(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      DatabaseURL string `env:"DATABASE_URL,compose=postgres://{DB_HOST}:{DB_PORT}/{DB_NAME}"` //nolint:lll
+   }
+
+   t.Setenv("DB_HOST", "localhost")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+   assert.ErrorContains(t, err, "placeholder 'DB_PORT' unresolved")
+   assert.ErrorContains(t, err, "placeholder 'DB_NAME' unresolved")
+}
+
+func TestUnmarshal_WithTrimSpacePaddedInt_ShouldParse(t *testing.T) {
+   type EnvironTest struct {
+      TestInt int `env:"TEST_INT"`
+   }
+
+   t.Setenv("TEST_INT", " 8080\n")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.Error(t, err)
+
+   err = environ.Unmarshal(&env, environ.WithTrimSpace())
+   assert.NoError(t, err)
+   assert.Equal(t, 8080, env.TestInt)
+}
+
+func TestUnmarshal_TrimTagPaddedBool_ShouldParse(t *testing.T) {
+   type EnvironTest struct {
+      TestBool bool `env:"TEST_BOOL,trim"`
+   }
+
+   t.Setenv("TEST_BOOL", "true ")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.True(t, env.TestBool)
+}
+
+func TestUnmarshal_TrimPaddedString_ShouldOnlyTrimTaggedField(t *testing.T) {
+   type EnvironTest struct {
+      Trimmed   string `env:"TEST_TRIMMED,trim"`
+      Untrimmed string `env:"TEST_UNTRIMMED"`
+   }
+
+   t.Setenv("TEST_TRIMMED", "  value \n")
+   t.Setenv("TEST_UNTRIMMED", "  value \n")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env, environ.WithTrimSpace())
+   assert.NoError(t, err)
+   assert.Equal(t, "value", env.Trimmed)
+   assert.Equal(t, "  value \n", env.Untrimmed)
+}
+
+func TestUnmarshal_SecretResolved_ShouldApplyPayload(t *testing.T) {
+   type EnvironTest struct {
+      DBPassword string `env:"DB_PASSWORD,secretmanager"`
+   }
+
+   t.Setenv("DB_PASSWORD", "projects/my-project/secrets/db-password")
+
+   var requested string
+   resolver := func(name string) (string, error) {
+      requested = name
+      return "s3cr3t", nil
+   }
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env, environ.WithSecretResolver(resolver))
+   assert.NoError(t, err)
+   assert.Equal(t, "s3cr3t", env.DBPassword)
+   assert.Equal(t, "projects/my-project/secrets/db-password", requested)
+}
+
+func TestUnmarshal_SecretResolverFails_ShouldReturnDistinctErrors(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Missing string `env:"TEST_MISSING_SECRET,secretmanager"`
+      Denied  string `env:"TEST_DENIED_SECRET,secretmanager"`
+   }
+
+   t.Setenv("TEST_MISSING_SECRET", "projects/p/secrets/missing")
+   t.Setenv("TEST_DENIED_SECRET", "projects/p/secrets/denied")
+
+   resolver := func(name string) (string, error) {
+      if name == "projects/p/secrets/missing" {
+         return "", fmt.Errorf("%s: %w", name, environ.ErrSecretNotFound)
+      }
+
+      return "", fmt.Errorf("%s: %w", name, environ.ErrSecretPermissionDenied)
+   }
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env, environ.WithSecretResolver(resolver))
+   assert.ErrorIs(t, err, environ.ErrSecretNotFound)
+   assert.ErrorIs(t, err, environ.ErrSecretPermissionDenied)
+   assert.ErrorContains(t, err, "TEST_MISSING_SECRET")
+   assert.ErrorContains(t, err, "TEST_DENIED_SECRET")
+}
+
+func TestUnmarshal_SecretWithoutResolver_ShouldReturnResolverMissing(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      DBPassword string `env:"DB_PASSWORD,secretmanager"`
+   }
+
+   t.Setenv("DB_PASSWORD", "projects/my-project/secrets/db-password")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrSecretResolverMissing)
+}
+
+func TestUnmarshal_DurationUnits_ShouldMultiplyByUnit(t *testing.T) {
+   type EnvironTest struct {
+      Seconds time.Duration `env:"TEST_SECONDS,unit=s"`
+      Millis  time.Duration `env:"TEST_MILLIS,unit=ms"`
+      Minutes time.Duration `env:"TEST_MINUTES,unit=m"`
+      Parsed  time.Duration `env:"TEST_PARSED"`
+   }
+
+   t.Setenv("TEST_SECONDS", "30")
+   t.Setenv("TEST_MILLIS", "250")
+   t.Setenv("TEST_MINUTES", "5")
+   t.Setenv("TEST_PARSED", "1h30m")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, 30*time.Second, env.Seconds)
+   assert.Equal(t, 250*time.Millisecond, env.Millis)
+   assert.Equal(t, 5*time.Minute, env.Minutes)
+   assert.Equal(t, 90*time.Minute, env.Parsed)
+}
+
+func TestUnmarshal_DurationUnitWithDurationString_ShouldError(t *testing.T) {
+   type EnvironTest struct {
+      Timeout time.Duration `env:"TEST_TIMEOUT,unit=s"`
+   }
+
+   t.Setenv("TEST_TIMEOUT", "30s")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorContains(t, err,
+      "invalid value '30s' for type 'time.Duration'",
+   )
+}
+
+func TestMustUnmarshal_MissingRequired_ShouldPanic(t *testing.T) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_MUST_STRING"`
+   }
+
+   env := EnvironTest{}
+
+   assert.Panics(t, func() {
+      environ.MustUnmarshal(&env)
+   })
+}
+
+func TestMustUnmarshal_AllPresent_ShouldSucceed(t *testing.T) {
+   type EnvironTest struct {
+      TestString string `env:"TEST_MUST_STRING"`
+   }
+
+   t.Setenv("TEST_MUST_STRING", "present")
+
+   env := EnvironTest{}
+
+   assert.NotPanics(t, func() {
+      environ.MustUnmarshal(&env)
+   })
+   assert.Equal(t, "present", env.TestString)
+}
+
+func TestUnmarshal_SliceQuotedElements_ShouldKeepEmbeddedCommas(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Values []string `env:"TEST_SLICE"`
+   }
+
+   t.Setenv("TEST_SLICE", `"a,b",c`)
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []string{"a,b", "c"}, env.Values)
+}
+
+func TestUnmarshal_SliceEscapedQuotes_ShouldUnescape(t *testing.T) {
+   type EnvironTest struct {
+      Values []string `env:"TEST_SLICE"`
+   }
+
+   t.Setenv("TEST_SLICE", `"say \"hi\", then go",plain`)
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []string{`say "hi", then go`, "plain"}, env.Values)
+}
+
+func TestUnmarshal_SliceUnbalancedQuote_ShouldError(t *testing.T) {
+   type EnvironTest struct {
+      Values []string `env:"TEST_SLICE"`
+   }
+
+   t.Setenv("TEST_SLICE", `"a,b,c`)
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrUnbalancedQuote)
+   assert.ErrorContains(t, err, `invalid value '"a,b,c' for type '[]string'`)
+   assert.Nil(t, env.Values)
+}
+
+func TestUnmarshal_IntSlice_ShouldConvertElements(t *testing.T) {
+   type EnvironTest struct {
+      Values []int `env:"TEST_SLICE"`
+   }
+
+   t.Setenv("TEST_SLICE", "1,2,3")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []int{1, 2, 3}, env.Values)
+}
+
+func TestUnmarshal_Percent_ShouldDivideByHundred(t *testing.T) {
+   type EnvironTest struct {
+      SampleRate float64   `env:"TEST_SAMPLE_RATE,percent,max=1"`
+      Bare       float64   `env:"TEST_BARE,percent"`
+      Fallback   float32   `env:"TEST_FALLBACK,percent,default=2.5%"`
+      Weights    []float64 `env:"TEST_WEIGHTS,percent"`
+   }
+
+   t.Setenv("TEST_SAMPLE_RATE", "10%")
+   t.Setenv("TEST_BARE", "50")
+   t.Setenv("TEST_WEIGHTS", "25%,75%")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.InDelta(t, 0.1, env.SampleRate, 1e-9)
+   assert.InDelta(t, 0.5, env.Bare, 1e-9)
+   assert.InDelta(t, 0.025, env.Fallback, 1e-6)
+   assert.InDeltaSlice(t, []float64{0.25, 0.75}, env.Weights, 1e-9)
+}
+
+func TestUnmarshal_PercentInvalid_ShouldReturnErr(t *testing.T) {
+   type EnvironTest struct {
+      SampleRate float64 `env:"TEST_SAMPLE_RATE,percent,max=1"`
+   }
+
+   tests := []struct {
+      value   string
+      wantErr error
+   }{
+      {value: "150%", wantErr: environ.ErrValueOutOfRange},
+      {value: "ten%"},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.value, func(t *testing.T) {
+         t.Setenv("TEST_SAMPLE_RATE", tt.value)
+
+         err := environ.Unmarshal(&EnvironTest{})
+         assert.Error(t, err)
+         if tt.wantErr != nil {
+            assert.ErrorIs(t, err, tt.wantErr)
+         }
+      })
+   }
+}
+
+func TestUnmarshal_PercentOnInt_ShouldReturnMalformedTag(t *testing.T) {
+   type EnvironTest struct {
+      SampleRate int `env:"TEST_SAMPLE_RATE,percent"`
+   }
+
+   t.Setenv("TEST_SAMPLE_RATE", "10")
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+}
+
+func TestUnmarshal_IntSliceWithinRange_ShouldSucceed(t *testing.T) {
+   type EnvironTest struct {
+      Ports []int `env:"TEST_ALLOWED_PORTS,min=1,max=65535"`
+   }
+
+   t.Setenv("TEST_ALLOWED_PORTS", "80,443,8080")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []int{80, 443, 8080}, env.Ports)
+}
+
+func TestUnmarshal_IntSliceOutOfRange_ShouldReportElement(t *testing.T) {
+   type EnvironTest struct {
+      Ports []int `env:"TEST_ALLOWED_PORTS,min=1,max=65535"`
+      Count int   `env:"TEST_COUNT,max=10"`
+   }
+
+   t.Setenv("TEST_ALLOWED_PORTS", "80,70000,443")
+   t.Setenv("TEST_COUNT", "11")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrValueOutOfRange)
+   assert.ErrorContains(t, err,
+      "element 1: value '70000' outside of [1, 65535]",
+   )
+   assert.ErrorContains(t, err, "value '11' outside of [-inf, 10]")
+   assert.Nil(t, env.Ports)
+}
+
+func TestUnmarshal_RangeOnString_ShouldReturnMalformedTag(t *testing.T) {
+   type EnvironTest struct {
+      Name string `env:"TEST_NAME,min=1"`
+   }
+
+   t.Setenv("TEST_NAME", "acme")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+}
+
+func TestUnmarshal_RequiredIn_ShouldEnforceOnlyListedEnvironments(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      SentryDSN string `env:"TEST_SENTRY_DSN,required_in=prd,stg"`
+   }
+
+   tests := []struct {
+      env     environ.Environment
+      wantErr bool
+   }{
+      {env: environ.Production, wantErr: true},
+      {env: environ.Staging, wantErr: true},
+      {env: environ.Development, wantErr: false},
+      {env: environ.Test, wantErr: false},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.env.String(), func(t *testing.T) {
+         env := EnvironTest{}
+
+         err := environ.Unmarshal(&env, environ.WithEnvironment(tt.env))
+         if tt.wantErr {
+            assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+         } else {
+            assert.NoError(t, err)
+         }
+      })
+   }
+}
+
+func TestUnmarshal_RequiredInPresent_ShouldSetValue(t *testing.T) {
+   type EnvironTest struct {
+      SentryDSN string `env:"TEST_SENTRY_DSN,required_in=prd,stg"`
+   }
+
+   t.Setenv("TEST_SENTRY_DSN", "https://key@sentry.example/1")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env,
+      environ.WithEnvironment(environ.Production),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, "https://key@sentry.example/1", env.SentryDSN)
+}
+
+func TestUnmarshal_RequiredInEnvironmentChanged_ShouldReadEachCall(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      SentryDSN string `env:"TEST_SENTRY_DSN,required_in=prd"`
+   }
+
+   t.Cleanup(environ.Reset)
+
+   t.Setenv("ENVIRONMENT", "production")
+   environ.Reset()
+   assert.Equal(t, environ.Production, environ.Current())
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+
+   // Current stays memoized as Production; the next call must not use it.
+   t.Setenv("ENVIRONMENT", "")
+
+   err = environ.Unmarshal(&EnvironTest{})
+   assert.NoError(t, err)
+
+   err = environ.Unmarshal(&EnvironTest{},
+      environ.WithEnvironment(environ.Production),
+   )
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
+
+func TestUnmarshal_RequiredInInvalidEnvironment_ShouldReturnMalformedTag(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      SentryDSN string `env:"TEST_SENTRY_DSN,required_in=qa"`
+   }
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+}
+
+func TestUnmarshal_EnvironmentChangedMidParse_ShouldReadSnapshot(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Password string `env:"TEST_DB_PASSWORD,secretmanager"`
+      Host     string `env:"TEST_DB_HOST"`
+   }
+
+   t.Setenv("TEST_DB_PASSWORD", "projects/p/secrets/db-password")
+   t.Setenv("TEST_DB_HOST", "db.internal")
+
+   resolver := func(name string) (string, error) {
+      // Simulate the environment changing while fields are parsed.
+      if err := os.Setenv("TEST_DB_HOST", "changed.internal"); err != nil {
+         return "", err
+      }
+
+      return "hunter2", nil
+   }
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env, environ.WithSecretResolver(resolver))
+   assert.NoError(t, err)
+   assert.Equal(t, "hunter2", env.Password)
+   assert.Equal(t, "db.internal", env.Host)
+}
+
+func TestUnmarshal_SliceDefaultSingleElement_ShouldYieldOneElement(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Hosts []string `env:"TEST_HOSTS,default=localhost"`
+   }
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []string{"localhost"}, env.Hosts)
+}
+
+func TestUnmarshal_SliceDefaultMultiElement_ShouldUseDelimiter(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Hosts []string `env:"TEST_HOSTS,delim=;,default=db-1;db-2"`
+      Ports []int    `env:"TEST_PORTS,delim=;"`
+   }
+
+   t.Setenv("TEST_PORTS", "5432;5433")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []string{"db-1", "db-2"}, env.Hosts)
+   assert.Equal(t, []int{5432, 5433}, env.Ports)
+}
+
+func TestUnmarshal_SliceEmptyDefault_ShouldYieldEmptyNonNilSlice(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Hosts []string `env:"TEST_HOSTS,default="`
+   }
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.NotNil(t, env.Hosts)
+   assert.Empty(t, env.Hosts)
+}
+
+func TestUnmarshal_MapDefault_ShouldParseKeyValuePairs(t *testing.T) {
+   type EnvironTest struct {
+      Weights map[string]int `env:"TEST_WEIGHTS,default=a=1,optional"`
+      Limits  map[string]int `env:"TEST_LIMITS"`
+   }
+
+   t.Setenv("TEST_LIMITS", "read=100,write=10")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, map[string]int{"a": 1}, env.Weights)
+   assert.Equal(t, map[string]int{"read": 100, "write": 10}, env.Limits)
+}
+
+func TestUnmarshal_MapMissingSeparator_ShouldError(t *testing.T) {
+   type EnvironTest struct {
+      Limits map[string]int `env:"TEST_LIMITS"`
+   }
+
+   t.Setenv("TEST_LIMITS", "read=100,write")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorContains(t, err,
+      "element 1: invalid value 'write' for type 'map[string]int'",
+   )
+   assert.Nil(t, env.Limits)
+}
+
+func TestUnmarshal_Repeated_ShouldCollectIndexedVars(t *testing.T) {
+   type EnvironTest struct {
+      Origins []string `env:"TEST_ORIGIN,repeated"`
+   }
+
+   t.Setenv("TEST_ORIGIN_1", "https://a.example")
+   t.Setenv("TEST_ORIGIN_2", "https://b.example,https://c.example")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []string{
+      "https://a.example", "https://b.example,https://c.example",
+   }, env.Origins)
+}
+
+func TestUnmarshal_RepeatedGap_ShouldStopCollecting(t *testing.T) {
+   type EnvironTest struct {
+      Ports []int `env:"TEST_PORT,repeated"`
+   }
+
+   t.Setenv("TEST_PORT_1", "80")
+   t.Setenv("TEST_PORT_2", "443")
+   t.Setenv("TEST_PORT_4", "8080")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, []int{80, 443}, env.Ports)
+}
+
+func TestUnmarshal_RepeatedNoneSet_ShouldApplyRequiredCheck(t *testing.T) {
+   type EnvironTest struct {
+      Origins []string `env:"TEST_ORIGIN,repeated"`
+   }
+
+   t.Setenv("TEST_ORIGIN", "https://ignored.example")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
+
+func TestUnmarshal_EnumValidValue_ShouldSucceed(t *testing.T) {
+   type EnvironTest struct {
+      LogFormat string `env:"TEST_LOG_FORMAT,enum=json|text"`
+   }
+
+   t.Setenv("TEST_LOG_FORMAT", "text")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "text", env.LogFormat)
+}
+
+func TestUnmarshal_EnumInvalidValue_ShouldListAllowedValues(t *testing.T) {
+   type EnvironTest struct {
+      LogFormat string `env:"TEST_LOG_FORMAT,enum=json|text"`
+   }
+
+   t.Setenv("TEST_LOG_FORMAT", "xml")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrValidation)
+   assert.ErrorContains(t, err, "value 'xml' not one of json, text")
+   assert.Empty(t, env.LogFormat)
+}
+
+func TestUnmarshal_EnumCase_ShouldHonorCaseInsensitive(t *testing.T) {
+   type EnvironTest struct {
+      Strict string `env:"TEST_LOG_FORMAT,enum=json|text"`
+      Folded string `env:"TEST_LOG_FORMAT,enum=json|text,case_insensitive"`
+   }
+
+   t.Setenv("TEST_LOG_FORMAT", "JSON")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrValidation)
+   assert.Empty(t, env.Strict)
+   assert.Equal(t, "json", env.Folded)
+}
+
+type smtpConfig struct {
+   Host string `env:"TEST_SMTP_HOST,optional,requires=TEST_SMTP_USER,TEST_SMTP_PASS"` //nolint:lll
+   User string `env:"TEST_SMTP_USER,optional"`
+   Pass string `env:"TEST_SMTP_PASS,optional"`
+}
+
+func TestUnmarshal_RequiresAllPresent_ShouldSucceed(t *testing.T) {
+   t.Setenv("TEST_SMTP_HOST", "smtp.example")
+   t.Setenv("TEST_SMTP_USER", "mailer")
+   t.Setenv("TEST_SMTP_PASS", "hunter2")
+
+   env := smtpConfig{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, smtpConfig{
+      Host: "smtp.example", User: "mailer", Pass: "hunter2",
+   }, env)
+}
+
+func TestUnmarshal_RequiresPartial_ShouldReturnErrIncompleteGroup(
+   t *testing.T,
+) {
+   t.Setenv("TEST_SMTP_HOST", "smtp.example")
+   t.Setenv("TEST_SMTP_USER", "mailer")
+
+   env := smtpConfig{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrIncompleteGroup)
+   assert.ErrorContains(t, err, "'TEST_SMTP_HOST' set without TEST_SMTP_PASS")
+}
+
+func TestUnmarshal_RequiresNonePresent_ShouldSucceed(t *testing.T) {
+   env := smtpConfig{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, smtpConfig{}, env)
+}
+
+func TestUnmarshal_ConflictingOrUnknownOptions_ShouldReturnMalformedTag(
+   t *testing.T,
+) {
+   tests := []struct {
+      name   string
+      config any
+   }{
+      {
+         name: "required_in with default",
+         config: &struct {
+            DSN string `env:"TEST_SENTRY_DSN,required_in=prd,default=x"`
+         }{},
+      },
+      {
+         name: "required_in with optional",
+         config: &struct {
+            DSN string `env:"TEST_SENTRY_DSN,optional,required_in=prd,stg"`
+         }{},
+      },
+      {
+         name: "repeated default",
+         config: &struct {
+            Port int `env:"TEST_PORT,default=80,default=8080"`
+         }{},
+      },
+      {
+         name: "misspelled default",
+         config: &struct {
+            Port int `env:"TEST_PORT,defualt=8080"`
+         }{},
+      },
+      {
+         name: "unknown option before name",
+         config: &struct {
+            Port int `env:"defualt=8080"`
+         }{},
+      },
+      {
+         name: "unknown flag",
+         config: &struct {
+            Port int `env:"TEST_PORT,optinal"`
+         }{},
+      },
+      {
+         name: "compose with default",
+         config: &struct {
+            URL string `env:"TEST_DB_URL,compose={TEST_DB_HOST},default=x"`
+         }{},
+      },
+      {
+         name: "compose with default_by",
+         config: &struct {
+            URL string `env:"TEST_URL,compose={TEST_H},default_by=TEST_R:us=x"`
+         }{},
+      },
+      {
+         name: "default_by itself",
+         config: &struct {
+            Bucket string `env:"TEST_BUCKET,default_by=TEST_BUCKET:us=x"`
+         }{},
+      },
+      {
+         name: "oslist with repeated",
+         config: &struct {
+            Dirs []string `env:"TEST_DIRS,oslist,repeated"`
+         }{},
+      },
+      {
+         name: "min above max",
+         config: &struct {
+            Port int `env:"TEST_PORT,min=10,max=1"`
+         }{},
+      },
+      {
+         name: "case_insensitive without enum",
+         config: &struct {
+            Format string `env:"TEST_LOG_FORMAT,case_insensitive"`
+         }{},
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         err := environ.Unmarshal(tt.config)
+         assert.ErrorIs(t, err, environ.ErrMalformedTag)
+      })
+   }
+}
+
+func TestUnmarshal_MalformedOptions_ShouldReportFirstProblem(t *testing.T) {
+   type EnvironTest struct {
+      Timeout time.Duration `env:"TEST_TIMEOUT,unit=weeks,min=x,optinal"`
+   }
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+   assert.ErrorContains(t, err, "'TEST_TIMEOUT' option 'unit=weeks'")
+   assert.NotContains(t, err.Error(), "option 'min=x'")
+   assert.NotContains(t, err.Error(), "unknown option")
+}
+
+func TestUnmarshal_RequiredInUnknown_ShouldReturnMalformedTag(t *testing.T) {
+   type EnvironTest struct {
+      SentryDSN string `env:"TEST_SENTRY_DSN,required_in=unknown"`
+   }
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+}
+
+func TestUnmarshal_OSList_ShouldSplitOnPathListSeparator(t *testing.T) {
+   type EnvironTest struct {
+      Dirs []string `env:"TEST_DIRS,oslist"`
+   }
+
+   tests := []struct {
+      name string
+      sep  string
+      val  string
+      want []string
+   }{
+      {
+         name: "unix",
+         sep:  ":",
+         val:  "/usr/local/bin:/opt/tools:",
+         want: []string{"/usr/local/bin", "/opt/tools"},
+      },
+      {
+         name: "windows",
+         sep:  ";",
+         val:  `C:\Tools;;"D:\My Apps";`,
+         want: []string{`C:\Tools`, `"D:\My Apps"`},
+      },
+      {name: "empty", sep: ":", val: "", want: []string{}},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         defer environ.SetPathListSeparator(tt.sep)()
+         t.Setenv("TEST_DIRS", tt.val)
+
+         env := EnvironTest{}
+
+         err := environ.Unmarshal(&env)
+         assert.NoError(t, err)
+         assert.Equal(t, tt.want, env.Dirs)
+      })
+   }
+}
+
+func TestUnmarshal_OSListWithDelim_ShouldReturnErrMalformedTag(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Dirs []string `env:"TEST_DIRS,oslist,delim=;"`
+   }
+
+   t.Setenv("TEST_DIRS", "a;b")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+}
+
+func TestUnmarshal_DefaultBy_ShouldSelectByReferencedVariable(t *testing.T) {
+   type EnvironTest struct {
+      Bucket string `env:"TEST_BUCKET,default_by=TEST_REGION:us=us-bucket;eu=eu-bucket,default=global-bucket"` //nolint:lll
+   }
+
+   tests := []struct {
+      name   string
+      region string
+      set    bool
+      want   string
+   }{
+      {name: "matched region", region: "eu", set: true, want: "eu-bucket"},
+      {
+         name:   "unmatched region falls back",
+         region: "ap",
+         set:    true,
+         want:   "global-bucket",
+      },
+      {name: "missing reference falls back", want: "global-bucket"},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         if tt.set {
+            t.Setenv("TEST_REGION", tt.region)
+         }
+
+         env := EnvironTest{}
+
+         err := environ.Unmarshal(&env)
+         assert.NoError(t, err)
+         assert.Equal(t, tt.want, env.Bucket)
+      })
+   }
+}
+
+func TestUnmarshal_DefaultByUnmatchedWithoutDefault_ShouldBeRequired(
+   t *testing.T,
+) {
+   type EnvironTest struct {
+      Bucket string `env:"TEST_BUCKET,default_by=TEST_REGION:us=us-bucket"`
+   }
+
+   t.Setenv("TEST_REGION", "ap")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+}
+
+func TestUnmarshal_DefaultByVariableSet_ShouldWin(t *testing.T) {
+   type EnvironTest struct {
+      Bucket string `env:"TEST_BUCKET,default_by=TEST_REGION:us=us-bucket"`
+   }
+
+   t.Setenv("TEST_REGION", "us")
+   t.Setenv("TEST_BUCKET", "explicit")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "explicit", env.Bucket)
+}
+
+func TestUnmarshal_DefaultByMatched_ShouldNotRequireValue(t *testing.T) {
+   type EnvironTest struct {
+      Strict string `env:"TEST_STRICT,default_by=TEST_REGION:us=us-strict"`
+   }
+
+   t.Setenv("TEST_REGION", "us")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.NoError(t, err)
+   assert.Equal(t, "us-strict", env.Strict)
+}
+
+func TestUnmarshal_DefaultByMalformed_ShouldReturnErrMalformedTag(
+   t *testing.T,
+) {
+   tests := []struct {
+      name   string
+      config any
+   }{
+      {
+         name: "missing reference",
+         config: &struct {
+            Value string `env:"TEST_VALUE,default_by=us=a"`
+         }{},
+      },
+      {
+         name: "case without value",
+         config: &struct {
+            Value string `env:"TEST_VALUE,default_by=TEST_REGION:us"`
+         }{},
+      },
+      {
+         name: "repeated",
+         config: &struct {
+            Value string `env:"TEST_VALUE,default_by=R:a=1,default_by=R:b=2"`
+         }{},
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         err := environ.Unmarshal(tt.config)
+         assert.ErrorIs(t, err, environ.ErrMalformedTag)
+      })
+   }
+}
+
+func TestParseTagValue_EdgeCases_ShouldRejectOrTolerate(t *testing.T) {
+   tests := []struct {
+      name     string
+      tag      string
+      wantName string
+      wantMsg  string
+   }{
+      {name: "empty tag", tag: "", wantMsg: "missing variable name"},
+      {name: "empty name", tag: ",optional", wantMsg: "missing variable name"},
+      {name: "double comma", tag: "FOO,,optional", wantMsg: "empty option"},
+      {
+         name:    "duplicate optional",
+         tag:     "FOO,optional,optional",
+         wantMsg: "duplicate option 'optional'",
+      },
+      {
+         name:    "duplicate valued option",
+         tag:     "FOO,unit=s,UNIT=ms",
+         wantMsg: "duplicate option 'unit'",
+      },
+      {
+         name:    "unknown option",
+         tag:     "FOO,bogus",
+         wantMsg: "unknown option 'bogus'",
+      },
+      {name: "trailing comma", tag: "FOO,optional,", wantName: "FOO"},
+      {name: "trailing commas", tag: "FOO,,", wantName: "FOO"},
+      {name: "flag like name", tag: "OPTIONAL", wantName: "OPTIONAL"},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         name, err := environ.ParseTagName(tt.tag)
+         if tt.wantMsg == "" {
+            assert.NoError(t, err)
+            assert.Equal(t, tt.wantName, name)
+            return
+         }
+
+         assert.ErrorIs(t, err, environ.ErrMalformedTag)
+         assert.ErrorContains(t, err, tt.wantMsg)
+      })
+   }
+}
+
+func TestUnmarshal_DuplicateOption_ShouldReportProblem(t *testing.T) {
+   type EnvironTest struct {
+      Port int `env:"TEST_PORT,optional,optional"`
+   }
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+   assert.ErrorContains(t, err, "duplicate option 'optional'")
+}
+
+func FuzzParseTagValue(f *testing.F) {
+   seeds := []string{
+      "FOO",
+      ",optional",
+      "FOO,,optional",
+      "FOO,optional,optional",
+      "FOO,optional,",
+      "FOO,default=a,default=b",
+      "FOO,required_in=prd,stg,trim",
+      "FOO,requires=A,B,optional",
+      "FOO,default_by=R:a=1;b=2",
+      "FOO,delim=;,default=a;b",
+      "FOO,enum=a|b,case_insensitive",
+      "=,=",
+   }
+   for _, seed := range seeds {
+      f.Add(seed)
+   }
+
+   f.Fuzz(func(t *testing.T, tag string) {
+      name, err := environ.ParseTagName(tag)
+      if err != nil {
+         if !errors.Is(err, environ.ErrMalformedTag) {
+            t.Fatalf("tag %q: error %v does not wrap ErrMalformedTag", tag, err)
+         }
+         return
+      }
+
+      if name == "" || strings.ContainsAny(name, ",=") {
+         t.Fatalf("tag %q: accepted invalid name %q", tag, name)
+      }
+
+      // Trailing empty segments never change the outcome.
+      again, err := environ.ParseTagName(tag + ",")
+      if err != nil || again != name {
+         t.Fatalf("tag %q: trailing comma changed result: %q, %v",
+            tag, again, err,
+         )
+      }
+   })
+}
@@ -0,0 +1,104 @@
+package environ
+
+import (
+   "errors"
+   "reflect"
+   "strings"
+)
+
+// errorKinds are the sentinels reported as FieldError.Kind, in the order
+// they are matched.
+var errorKinds = []error{
+   ErrMalformedTag,
+   ErrMissingEnvVariable,
+   ErrIncompleteGroup,
+   ErrNotSupportedTypeFound,
+   ErrSecretResolverMissing,
+   ErrSecretNotFound,
+   ErrSecretPermissionDenied,
+   ErrUnbalancedQuote,
+   ErrValueOutOfRange,
+   ErrValidation,
+   ErrInvalidEndpoint,
+   ErrUnexportedTaggedField,
+}
+
+// FieldError describes the failure to populate a single config field.
+type FieldError struct {
+   // Field is the name of the struct field.
+   Field string
+   // Var is the environment variable name. It may be empty when the tag is
+   // malformed.
+   Var string
+   // Kind is the sentinel error matched by Err, e.g. ErrMissingEnvVariable,
+   // or nil when the value could not be converted to the field type.
+   Kind error
+   // Err is the underlying error.
+   Err error
+   // Message is the guidance given by the msg tag option, if any.
+   Message string
+}
+
+// newFieldError builds the FieldError of err for the field tagged tag.
+func newFieldError(
+   fieldType reflect.StructField,
+   tag fieldTag,
+   err error,
+) FieldError {
+   fieldErr := FieldError{
+      Field:   fieldType.Name,
+      Var:     tag.name,
+      Err:     err,
+      Message: tag.message,
+   }
+   for _, kind := range errorKinds {
+      if errors.Is(err, kind) {
+         fieldErr.Kind = kind
+         break
+      }
+   }
+
+   return fieldErr
+}
+
+// Error returns the message of the underlying error, followed by Message
+// when set.
+func (e FieldError) Error() string {
+   if e.Message != "" {
+      return e.Err.Error() + "; " + e.Message
+   }
+
+   return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e FieldError) Unwrap() error {
+   return e.Err
+}
+
+// ValidationError is returned by Unmarshal when one or more fields could not
+// be populated, carrying an entry per failed field so callers can render the
+// problems individually. errors.Is matches the sentinel of any entry.
+type ValidationError struct {
+   Fields []FieldError
+}
+
+// Error returns the messages of every entry, one per line.
+func (e *ValidationError) Error() string {
+   msgs := make([]string, len(e.Fields))
+   for i, field := range e.Fields {
+      msgs[i] = field.Error()
+   }
+
+   return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the entries, so errors.Is and errors.As inspect each.
+func (e *ValidationError) Unwrap() []error {
+   errs := make([]error, len(e.Fields))
+   for i, field := range e.Fields {
+      errs[i] = field
+   }
+
+   return errs
+}
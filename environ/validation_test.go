@@ -0,0 +1,113 @@
+package environ_test
+
+import (
+   "errors"
+   "testing"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+)
+
+func TestUnmarshal_MultipleFailures_ShouldReturnFieldErrors(t *testing.T) {
+   type EnvironTest struct {
+      Host    string `env:"TEST_HOST"`
+      Port    int    `env:"TEST_PORT,max=65535"`
+      Retries int    `env:"TEST_RETRIES"`
+      Format  string `env:"TEST_FORMAT,enum=json|text"`
+      Valid   string `env:"TEST_VALID"`
+   }
+
+   t.Setenv("TEST_PORT", "70000")
+   t.Setenv("TEST_RETRIES", "three")
+   t.Setenv("TEST_FORMAT", "xml")
+   t.Setenv("TEST_VALID", "ok")
+
+   env := EnvironTest{}
+
+   err := environ.Unmarshal(&env)
+
+   var validationErr *environ.ValidationError
+   require.ErrorAs(t, err, &validationErr)
+   require.Len(t, validationErr.Fields, 4)
+
+   want := []struct {
+      field string
+      name  string
+      kind  error
+   }{
+      {field: "Host", name: "TEST_HOST", kind: environ.ErrMissingEnvVariable},
+      {field: "Port", name: "TEST_PORT", kind: environ.ErrValueOutOfRange},
+      {field: "Retries", name: "TEST_RETRIES", kind: nil},
+      {field: "Format", name: "TEST_FORMAT", kind: environ.ErrValidation},
+   }
+   for i, w := range want {
+      got := validationErr.Fields[i]
+      assert.Equal(t, w.field, got.Field)
+      assert.Equal(t, w.name, got.Var)
+      assert.Equal(t, w.kind, got.Kind)
+      assert.Error(t, got.Err)
+   }
+
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+   assert.ErrorIs(t, err, environ.ErrValueOutOfRange)
+   assert.ErrorIs(t, err, environ.ErrValidation)
+   assert.Equal(t, "ok", env.Valid)
+}
+
+func TestUnmarshal_MalformedTag_ShouldReportMalformedKind(t *testing.T) {
+   type EnvironTest struct {
+      Port int `env:"TEST_PORT,defualt=80"`
+   }
+
+   err := environ.Unmarshal(&EnvironTest{})
+
+   var fieldErr environ.FieldError
+   require.True(t, errors.As(err, &fieldErr))
+   assert.Equal(t, "Port", fieldErr.Field)
+   assert.Equal(t, "TEST_PORT", fieldErr.Var)
+   assert.Equal(t, environ.ErrMalformedTag, fieldErr.Kind)
+}
+
+func TestUnmarshal_CustomMessage_ShouldAppearInError(t *testing.T) {
+   type EnvironTest struct {
+      LicenseKey string `env:"TEST_LICENSE_KEY,msg=Set TEST_LICENSE_KEY to the value from the vendor portal"` //nolint:lll
+      Seats      int    `env:"TEST_SEATS,min=1,msg=Seats, as purchased, must be a positive count"`            //nolint:lll
+      Region     string `env:"TEST_REGION"`
+   }
+
+   t.Setenv("TEST_SEATS", "zero")
+
+   err := environ.Unmarshal(&EnvironTest{})
+
+   var validationErr *environ.ValidationError
+   require.ErrorAs(t, err, &validationErr)
+   require.Len(t, validationErr.Fields, 3)
+   assert.Equal(t,
+      "Set TEST_LICENSE_KEY to the value from the vendor portal",
+      validationErr.Fields[0].Message,
+   )
+   assert.Equal(t,
+      "Seats, as purchased, must be a positive count",
+      validationErr.Fields[1].Message,
+   )
+   assert.Empty(t, validationErr.Fields[2].Message)
+
+   assert.ErrorIs(t, err, environ.ErrMissingEnvVariable)
+   assert.ErrorContains(t, err, "required 'TEST_LICENSE_KEY' missing; "+
+      "environ, missing env variable; "+
+      "Set TEST_LICENSE_KEY to the value from the vendor portal",
+   )
+   assert.ErrorContains(t, err,
+      "; Seats, as purchased, must be a positive count",
+   )
+}
+
+func TestUnmarshal_EmptyCustomMessage_ShouldReturnMalformedTag(t *testing.T) {
+   type EnvironTest struct {
+      LicenseKey string `env:"TEST_LICENSE_KEY,msg= "`
+   }
+
+   err := environ.Unmarshal(&EnvironTest{})
+   assert.ErrorIs(t, err, environ.ErrMalformedTag)
+}
@@ -0,0 +1,248 @@
+package environ
+
+import (
+   "errors"
+   "fmt"
+   "log/slog"
+   "reflect"
+   "sync"
+   "sync/atomic"
+   "time"
+)
+
+// defaultWatchInterval is how often Watch re-reads the environment unless
+// WithWatchInterval is given.
+const defaultWatchInterval = 10 * time.Second
+
+// ErrNotWatchable indicates a field passed to Watch does not exist, has no
+// `env` tag or is not of a type that can be updated atomically.
+var ErrNotWatchable = errors.New("environ, field not watchable")
+
+// watchableTypes maps the types Watch can update atomically to the type
+// their values are parsed as.
+var watchableTypes = map[reflect.Type]reflect.Type{
+   reflect.TypeFor[atomic.Bool]():   reflect.TypeFor[bool](),
+   reflect.TypeFor[atomic.Int32]():  reflect.TypeFor[int32](),
+   reflect.TypeFor[atomic.Int64]():  reflect.TypeFor[int64](),
+   reflect.TypeFor[atomic.Value]():  reflect.TypeFor[string](),
+   reflect.TypeFor[slog.LevelVar](): reflect.TypeFor[string](),
+}
+
+// WithWatchInterval sets how often Watch re-reads the environment. An
+// interval that is not positive keeps the 10s default. It has no effect on
+// Unmarshal.
+func WithWatchInterval(interval time.Duration) Option {
+   return func(o *options) {
+      if interval > 0 {
+         o.watchInterval = interval
+      }
+   }
+}
+
+// watchedField is a config field kept up to date by Watch.
+type watchedField struct {
+   val reflect.Value
+   tag fieldTag
+}
+
+// Watch periodically re-reads the variables of the named fields of config,
+// a pointer to a struct already populated with Unmarshal, e.g. to pick up a
+// new log level without a restart. Values are resolved as by Unmarshal, and
+// onChange is called from the watching goroutine after one or more fields
+// changed. A variable that is missing or fails to parse leaves its field
+// untouched; the failure is logged.
+//
+// Watched fields must be of type atomic.Bool, atomic.Int32, atomic.Int64,
+// atomic.Value, which holds the value as a string, or slog.LevelVar, so
+// readers never observe a torn value. Fields that do not exist, have no
+// `env` tag or are of another type return ErrNotWatchable, and fields with a
+// malformed tag return ErrMalformedTag, before watching starts.
+//
+// The returned stop func ends the watch and waits for an in-flight
+// onChange call to return.
+func Watch(
+   config any,
+   fields []string,
+   onChange func(),
+   opts ...Option,
+) (stop func(), err error) {
+   o := options{watchInterval: defaultWatchInterval}
+   for _, opt := range opts {
+      opt(&o)
+   }
+
+   v := reflect.ValueOf(config)
+   if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+      errMsg := fmt.Sprintf("config of type '%T' is not a struct pointer",
+         config,
+      )
+      return nil, fmt.Errorf("%s; %w", errMsg, ErrNotWatchable)
+   }
+
+   watched := make([]watchedField, 0, len(fields))
+   var errs []error
+   for _, name := range fields {
+      field, err := newWatchedField(v.Elem(), name)
+      if err != nil {
+         errs = append(errs, err)
+         continue
+      }
+      watched = append(watched, field)
+   }
+
+   if len(errs) > 0 {
+      return nil, errors.Join(errs...)
+   }
+
+   done := make(chan struct{})
+   var wg sync.WaitGroup
+   wg.Add(1)
+   go func() {
+      defer wg.Done()
+
+      ticker := time.NewTicker(o.watchInterval)
+      defer ticker.Stop()
+
+      for {
+         select {
+         case <-done:
+            return
+         case <-ticker.C:
+         }
+
+         if refreshFields(watched, o) && onChange != nil {
+            onChange()
+         }
+      }
+   }()
+
+   var once sync.Once
+   return func() {
+      once.Do(func() {
+         close(done)
+         wg.Wait()
+      })
+   }, nil
+}
+
+// newWatchedField looks up the field name of the struct v and checks it can
+// be watched.
+func newWatchedField(v reflect.Value, name string) (watchedField, error) {
+   fieldType, ok := v.Type().FieldByName(name)
+   if !ok || len(fieldType.Index) != 1 {
+      errMsg := fmt.Sprintf("field '%s' not found", name)
+      return watchedField{}, fmt.Errorf("%s; %w", errMsg, ErrNotWatchable)
+   }
+
+   tagEncoded, ok := fieldType.Tag.Lookup("env")
+   if !ok || !fieldType.IsExported() {
+      errMsg := fmt.Sprintf("field '%s' has no env tag or is unexported",
+         name,
+      )
+      return watchedField{}, fmt.Errorf("%s; %w", errMsg, ErrNotWatchable)
+   }
+
+   if _, ok := watchableTypes[fieldType.Type]; !ok {
+      errMsg := fmt.Sprintf("field '%s' of type '%s' cannot be updated "+
+         "atomically", name, fieldType.Type.String(),
+      )
+      return watchedField{}, fmt.Errorf("%s; %w", errMsg, ErrNotWatchable)
+   }
+
+   tag, err := parseTagValue(tagEncoded)
+   if err != nil {
+      errMsg := fmt.Sprintf("env struct tag '%s' malformed", tagEncoded)
+      return watchedField{}, fmt.Errorf("%s; %w", errMsg, err)
+   }
+
+   return watchedField{val: v.Field(fieldType.Index[0]), tag: tag}, nil
+}
+
+// refreshFields re-reads the variables of fields and stores the values that
+// changed, reporting whether any did.
+func refreshFields(fields []watchedField, o options) bool {
+   env := snapshotEnv()
+   changed := false
+   for _, field := range fields {
+      // Resolve into a scratch value so a failure never touches the field.
+      scratch := reflect.New(field.val.Type()).Elem()
+      ok, err := populateField(scratch, field.tag, env, o)
+      if err != nil {
+         slog.Warn("environ, watched variable not reloaded",
+            "name", field.tag.name, "error", err.Error(),
+         )
+         continue
+      }
+
+      next := loadAtomic(scratch)
+      if !ok || next == loadAtomic(field.val) {
+         continue
+      }
+
+      storeAtomic(field.val, next)
+      changed = true
+   }
+
+   return changed
+}
+
+// setAtomic parses val as the type of the watchable fieldVal and stores it.
+func setAtomic(
+   fieldVal reflect.Value,
+   val string,
+   tag fieldTag,
+   o options,
+) error {
+   plain := reflect.New(watchableTypes[fieldVal.Type()]).Elem()
+   if err := setValue(plain, val, tag, o); err != nil {
+      return err
+   }
+
+   if level, ok := fieldVal.Addr().Interface().(*slog.LevelVar); ok {
+      if err := level.UnmarshalText([]byte(plain.String())); err != nil {
+         errMsg := fmt.Sprintf(msgInvalidValueFmt, val, "slog.LevelVar")
+         return fmt.Errorf("%s; %w", errMsg, err)
+      }
+
+      return nil
+   }
+
+   storeAtomic(fieldVal, plain.Interface())
+
+   return nil
+}
+
+// loadAtomic returns the value held by the watchable fieldVal.
+func loadAtomic(fieldVal reflect.Value) any {
+   switch p := fieldVal.Addr().Interface().(type) {
+   case *atomic.Bool:
+      return p.Load()
+   case *atomic.Int32:
+      return p.Load()
+   case *atomic.Int64:
+      return p.Load()
+   case *atomic.Value:
+      return p.Load()
+   case *slog.LevelVar:
+      return p.Level()
+   default:
+      return nil
+   }
+}
+
+// storeAtomic stores next, as returned by loadAtomic or parsed by setAtomic,
+// in the watchable fieldVal.
+func storeAtomic(fieldVal reflect.Value, next any) {
+   switch p := fieldVal.Addr().Interface().(type) {
+   case *atomic.Bool:
+      p.Store(next.(bool))
+   case *atomic.Int32:
+      p.Store(next.(int32))
+   case *atomic.Int64:
+      p.Store(next.(int64))
+   case *atomic.Value:
+      p.Store(next)
+   case *slog.LevelVar:
+      p.Set(next.(slog.Level))
+   }
+}
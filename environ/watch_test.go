@@ -0,0 +1,169 @@
+package environ_test
+
+import (
+   "log/slog"
+   "sync/atomic"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+)
+
+type watchedConfig struct {
+   Level   slog.LevelVar `env:"TEST_LOG_LEVEL,default=INFO"`
+   Verbose atomic.Bool   `env:"TEST_VERBOSE,optional"`
+   Limit   atomic.Int64  `env:"TEST_LIMIT,default=10"`
+   Region  atomic.Value  `env:"TEST_REGION,optional"`
+   Name    string        `env:"TEST_NAME,optional"`
+}
+
+func TestUnmarshal_AtomicFields_ShouldPopulate(t *testing.T) {
+   t.Setenv("TEST_LOG_LEVEL", "debug")
+   t.Setenv("TEST_VERBOSE", "true")
+   t.Setenv("TEST_REGION", "eu")
+
+   var cfg watchedConfig
+   require.NoError(t, environ.Unmarshal(&cfg))
+   assert.Equal(t, slog.LevelDebug, cfg.Level.Level())
+   assert.True(t, cfg.Verbose.Load())
+   assert.Equal(t, int64(10), cfg.Limit.Load())
+   assert.Equal(t, "eu", cfg.Region.Load())
+}
+
+func TestWatch_ChangedVariable_ShouldUpdateAndNotify(t *testing.T) {
+   t.Setenv("TEST_LOG_LEVEL", "info")
+   t.Setenv("TEST_LIMIT", "10")
+
+   var cfg watchedConfig
+   require.NoError(t, environ.Unmarshal(&cfg))
+
+   changed := make(chan struct{}, 1)
+   stop, err := environ.Watch(
+      &cfg,
+      []string{"Level", "Limit"},
+      func() {
+         select {
+         case changed <- struct{}{}:
+         default:
+         }
+      },
+      environ.WithWatchInterval(time.Millisecond),
+   )
+   require.NoError(t, err)
+   defer stop()
+
+   t.Setenv("TEST_LOG_LEVEL", "warn")
+   t.Setenv("TEST_LIMIT", "oops")
+
+   select {
+   case <-changed:
+   case <-time.After(time.Second):
+      t.Fatal("onChange not called")
+   }
+
+   assert.Equal(t, slog.LevelWarn, cfg.Level.Level())
+   // A value that fails to parse leaves the field untouched.
+   assert.Equal(t, int64(10), cfg.Limit.Load())
+
+   stop()
+   stop()
+}
+
+func TestWatch_UnchangedVariables_ShouldNotNotify(t *testing.T) {
+   t.Setenv("TEST_LOG_LEVEL", "info")
+
+   var cfg watchedConfig
+   require.NoError(t, environ.Unmarshal(&cfg))
+
+   var calls atomic.Int32
+   stop, err := environ.Watch(
+      &cfg, []string{"Level", "Verbose"}, func() { calls.Add(1) },
+      environ.WithWatchInterval(time.Millisecond),
+   )
+   require.NoError(t, err)
+
+   time.Sleep(20 * time.Millisecond)
+   stop()
+   assert.Zero(t, calls.Load())
+}
+
+func TestWatch_NonPositiveInterval_ShouldKeepDefault(t *testing.T) {
+   for _, interval := range []time.Duration{0, -time.Second} {
+      t.Run(interval.String(), func(t *testing.T) {
+         t.Setenv("TEST_LOG_LEVEL", "info")
+
+         var cfg watchedConfig
+         require.NoError(t, environ.Unmarshal(&cfg))
+
+         var calls atomic.Int32
+         stop, err := environ.Watch(
+            &cfg, []string{"Level"}, func() { calls.Add(1) },
+            environ.WithWatchInterval(interval),
+         )
+         require.NoError(t, err)
+
+         // The default interval is not reached before stop, and the ticker
+         // would panic on the interval itself.
+         t.Setenv("TEST_LOG_LEVEL", "warn")
+         time.Sleep(20 * time.Millisecond)
+         stop()
+         assert.Zero(t, calls.Load())
+         assert.Equal(t, slog.LevelInfo, cfg.Level.Level())
+      })
+   }
+}
+
+func TestWatch_NotWatchableFields_ShouldReturnErr(t *testing.T) {
+   type EnvironTest struct {
+      Untagged atomic.Bool
+      Bad      atomic.Bool `env:"TEST_BAD,bogus"`
+   }
+
+   tests := []struct {
+      name    string
+      config  any
+      field   string
+      wantErr error
+   }{
+      {
+         name:    "plain string",
+         config:  &watchedConfig{},
+         field:   "Name",
+         wantErr: environ.ErrNotWatchable,
+      },
+      {
+         name:    "unknown field",
+         config:  &watchedConfig{},
+         field:   "Missing",
+         wantErr: environ.ErrNotWatchable,
+      },
+      {
+         name:    "untagged field",
+         config:  &EnvironTest{},
+         field:   "Untagged",
+         wantErr: environ.ErrNotWatchable,
+      },
+      {
+         name:    "malformed tag",
+         config:  &EnvironTest{},
+         field:   "Bad",
+         wantErr: environ.ErrMalformedTag,
+      },
+      {
+         name:    "not a pointer",
+         config:  watchedConfig{},
+         field:   "Level",
+         wantErr: environ.ErrNotWatchable,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         stop, err := environ.Watch(tt.config, []string{tt.field}, nil)
+         assert.ErrorIs(t, err, tt.wantErr)
+         assert.Nil(t, stop)
+      })
+   }
+}
@@ -0,0 +1,188 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+   "sync"
+
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// ErrBatchAborted marks the accounts of a batch that were not attempted
+// because an earlier account failed with a fatal error.
+var ErrBatchAborted = errors.New("gcputils, batch aborted")
+
+// BatchPolicy controls how a batch operation reacts to failures.
+type BatchPolicy int
+
+const (
+   // ContinueOnError attempts every item regardless of failures.
+   ContinueOnError BatchPolicy = iota
+   // AbortOnFatal stops at the first fatal error, i.e. one that would fail
+   // every remaining item such as a missing project or permission, while
+   // continuing past per-item errors such as a duplicate account ID.
+   AbortOnFatal
+)
+
+// fatalCodes are the gRPC codes indicating a failure of the batch as a whole
+// rather than of a single item.
+var fatalCodes = map[codes.Code]bool{
+   codes.PermissionDenied:   true,
+   codes.Unauthenticated:    true,
+   codes.NotFound:           true,
+   codes.FailedPrecondition: true,
+   codes.ResourceExhausted:  true,
+}
+
+// isFatal reports whether err would fail every remaining item of a batch.
+func isFatal(err error) bool {
+   return errors.Is(err, ErrProjectNotFound) || fatalCodes[status.Code(err)]
+}
+
+// M2MAccountRequest describes one account of a batch creation.
+type M2MAccountRequest struct {
+   ClientID    string
+   DisplayName string
+}
+
+// M2MAccountResult is the outcome of creating one account of a batch.
+type M2MAccountResult struct {
+   ClientID string
+   // Account is the created account, nil when Err is set.
+   Account *M2MServiceAccount
+   Err     error
+}
+
+// NewM2MServiceAccounts creates several M2M service accounts using a
+// short-lived Provisioner.
+func NewM2MServiceAccounts(
+   ctx context.Context,
+   projectID string,
+   accounts []M2MAccountRequest,
+   policy BatchPolicy,
+   opts ...M2MOption,
+) ([]M2MAccountResult, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.NewM2MServiceAccounts(ctx, projectID, accounts, policy, opts...)
+}
+
+// NewM2MServiceAccounts creates an M2M service account, with opts applied, for
+// each request, subject to the Provisioner's batch concurrency and rate
+// limits. A result is returned per request, in order; under AbortOnFatal,
+// requests not yet started when a fatal error occurs fail with
+// ErrBatchAborted without being attempted. Requests not started because ctx
+// is done fail with the context error. The returned error joins every
+// failure.
+func (p *Provisioner) NewM2MServiceAccounts(
+   ctx context.Context,
+   projectID string,
+   accounts []M2MAccountRequest,
+   policy BatchPolicy,
+   opts ...M2MOption,
+) ([]M2MAccountResult, error) {
+   results := make([]M2MAccountResult, len(accounts))
+   aborted := make([]bool, len(accounts))
+
+   var mu sync.Mutex
+   var fatal error
+
+   p.runBatch(ctx, len(accounts), func(i int) {
+      req := accounts[i]
+      results[i].ClientID = req.ClientID
+
+      mu.Lock()
+      fatalErr := fatal
+      mu.Unlock()
+      if fatalErr != nil {
+         results[i].Err = fmt.Errorf("%w: %w", ErrBatchAborted, fatalErr)
+         aborted[i] = true
+         return
+      }
+
+      sa, err := p.NewM2MServiceAccount(
+         ctx, projectID, req.ClientID, req.DisplayName, opts...,
+      )
+      if err != nil {
+         results[i].Err = err
+
+         if policy == AbortOnFatal && isFatal(err) {
+            slog.Error("Aborting batch on fatal error",
+               "client", req.ClientID, "error", err.Error(),
+            )
+
+            mu.Lock()
+            if fatal == nil {
+               fatal = err
+            }
+            mu.Unlock()
+         }
+
+         return
+      }
+
+      results[i].Account = sa
+   }, func(i int, err error) {
+      results[i].ClientID = accounts[i].ClientID
+      results[i].Err = err
+   })
+
+   var errs []error
+   for i, result := range results {
+      if result.Err != nil && !aborted[i] {
+         errs = append(errs,
+            fmt.Errorf("client '%s': %w", result.ClientID, result.Err),
+         )
+      }
+   }
+
+   if fatal != nil {
+      errs = append(errs, ErrBatchAborted)
+   }
+
+   return results, errors.Join(errs...)
+}
+
+// runBatch calls run for each item index below n on up to the Provisioner's
+// batch concurrency goroutines, waiting on its rate limiter before starting
+// each item, and returns once every started item is done. Items not started
+// because ctx is done are passed to skip with the context error instead.
+func (p *Provisioner) runBatch(
+   ctx context.Context,
+   n int,
+   run func(i int),
+   skip func(i int, err error),
+) {
+   workers := make(chan struct{}, p.batchConcurrency)
+   var wg sync.WaitGroup
+
+   for i := 0; i < n; i++ {
+      workers <- struct{}{}
+
+      if err := p.batchLimiter.Wait(ctx); err != nil {
+         <-workers
+         for ; i < n; i++ {
+            skip(i, err)
+         }
+
+         break
+      }
+
+      wg.Add(1)
+      go func() {
+         defer wg.Done()
+         defer func() { <-workers }()
+
+         run(i)
+      }()
+   }
+
+   wg.Wait()
+}
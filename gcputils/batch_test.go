@@ -0,0 +1,246 @@
+package gcputils
+
+import (
+   "context"
+   "fmt"
+   "sync"
+   "testing"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/api/cloudresourcemanager/v3"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// failingCreate returns a createServiceAccount func failing with the code
+// mapped to the requested account ID and counting attempts.
+func failingCreate(
+   failures map[string]codes.Code,
+   attempts *int,
+) func(
+   *iamadminpb.CreateServiceAccountRequest,
+) (*iamadminpb.ServiceAccount, error) {
+   return func(
+      req *iamadminpb.CreateServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error) {
+      *attempts++
+      if code, ok := failures[req.AccountId]; ok {
+         return nil, status.Error(code, "create failed")
+      }
+
+      return &iamadminpb.ServiceAccount{
+         Name:  "projects/my-project/serviceAccounts/" + req.AccountId,
+         Email: req.AccountId + "@my-project.iam.gserviceaccount.com",
+      }, nil
+   }
+}
+
+var batchAccounts = []M2MAccountRequest{
+   {ClientID: "client-a", DisplayName: "Client A"},
+   {ClientID: "client-b", DisplayName: "Client B"},
+   {ClientID: "client-c", DisplayName: "Client C"},
+}
+
+func TestNewM2MServiceAccounts_FatalError_ShouldAbort(t *testing.T) {
+   attempts := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: failingCreate(
+         map[string]codes.Code{"client-b": codes.PermissionDenied}, &attempts,
+      ),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   results, err := p.NewM2MServiceAccounts(
+      context.Background(), "my-project", batchAccounts, AbortOnFatal,
+   )
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   assert.ErrorIs(t, err, ErrBatchAborted)
+   assert.Equal(t, 2, attempts)
+
+   require.Len(t, results, 3)
+   assert.NoError(t, results[0].Err)
+   assert.NotNil(t, results[0].Account)
+   assert.ErrorIs(t, results[1].Err, ErrPermissionDenied)
+   assert.ErrorIs(t, results[2].Err, ErrBatchAborted)
+   assert.Nil(t, results[2].Account)
+}
+
+func TestNewM2MServiceAccounts_ProjectNotFound_ShouldAbort(t *testing.T) {
+   lookups, attempts := 0, 0
+   admin := &fakeAdminClient{
+      createServiceAccount: failingCreate(nil, &attempts),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   p.projects = &fakeProjectsClient{
+      getProject: func(string) (*cloudresourcemanager.Project, error) {
+         lookups++
+         return &cloudresourcemanager.Project{State: "DELETE_REQUESTED"}, nil
+      },
+   }
+
+   results, err := p.NewM2MServiceAccounts(
+      context.Background(), "my-project", batchAccounts, AbortOnFatal,
+      WithProjectValidation(),
+   )
+   assert.ErrorIs(t, err, ErrProjectNotFound)
+   assert.ErrorIs(t, err, ErrBatchAborted)
+   assert.Equal(t, 1, lookups)
+   assert.Zero(t, attempts)
+
+   require.Len(t, results, 3)
+   assert.ErrorIs(t, results[0].Err, ErrProjectNotFound)
+   assert.ErrorIs(t, results[1].Err, ErrBatchAborted)
+   assert.ErrorIs(t, results[2].Err, ErrBatchAborted)
+}
+
+func TestNewM2MServiceAccounts_PerItemError_ShouldContinue(t *testing.T) {
+   attempts := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: failingCreate(
+         map[string]codes.Code{"client-a": codes.AlreadyExists}, &attempts,
+      ),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   results, err := p.NewM2MServiceAccounts(
+      context.Background(), "my-project", batchAccounts, AbortOnFatal,
+   )
+   assert.ErrorIs(t, err, ErrAlreadyExists)
+   assert.NotErrorIs(t, err, ErrBatchAborted)
+   assert.Equal(t, 3, attempts)
+
+   require.Len(t, results, 3)
+   assert.ErrorIs(t, results[0].Err, ErrAlreadyExists)
+   assert.NotNil(t, results[1].Account)
+   assert.NotNil(t, results[2].Account)
+}
+
+func TestNewM2MServiceAccounts_ContinueOnError_ShouldAttemptAll(
+   t *testing.T,
+) {
+   attempts := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: failingCreate(
+         map[string]codes.Code{"client-a": codes.PermissionDenied}, &attempts,
+      ),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   results, err := p.NewM2MServiceAccounts(
+      context.Background(), "my-project", batchAccounts, ContinueOnError,
+   )
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   assert.Equal(t, 3, attempts)
+   assert.NotNil(t, results[2].Account)
+}
+
+// concurrencyProbe records the peak number of concurrent calls to enter.
+type concurrencyProbe struct {
+   mu     sync.Mutex
+   active int
+   peak   int
+}
+
+// enter marks a call as active for d and returns once it is done.
+func (c *concurrencyProbe) enter(d time.Duration) {
+   c.mu.Lock()
+   c.active++
+   c.peak = max(c.peak, c.active)
+   c.mu.Unlock()
+
+   time.Sleep(d)
+
+   c.mu.Lock()
+   c.active--
+   c.mu.Unlock()
+}
+
+// manyAccounts returns n batch requests with distinct client IDs.
+func manyAccounts(n int) []M2MAccountRequest {
+   accounts := make([]M2MAccountRequest, n)
+   for i := range accounts {
+      accounts[i] = M2MAccountRequest{
+         ClientID:    fmt.Sprintf("client-%02d", i),
+         DisplayName: fmt.Sprintf("Client %d", i),
+      }
+   }
+
+   return accounts
+}
+
+func TestNewM2MServiceAccounts_ConcurrencyCap_ShouldNotBeExceeded(
+   t *testing.T,
+) {
+   probe := &concurrencyProbe{}
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         req *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         probe.enter(10 * time.Millisecond)
+         return &iamadminpb.ServiceAccount{
+            Email: req.AccountId + "@my-project.iam.gserviceaccount.com",
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithBatchConcurrency(3)(p)
+
+   accounts := manyAccounts(12)
+   results, err := p.NewM2MServiceAccounts(
+      context.Background(), "my-project", accounts, ContinueOnError,
+      WithGenerateKey(false),
+   )
+   require.NoError(t, err)
+   assert.LessOrEqual(t, probe.peak, 3)
+   assert.Greater(t, probe.peak, 1)
+   for i, result := range results {
+      assert.Equal(t, accounts[i].ClientID, result.ClientID)
+      assert.NotNil(t, result.Account)
+   }
+}
+
+func TestNewM2MServiceAccounts_RateLimit_ShouldSpaceAccounts(t *testing.T) {
+   attempts := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: failingCreate(nil, &attempts),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithBatchRateLimit(50, 1)(p)
+
+   start := time.Now()
+   _, err := p.NewM2MServiceAccounts(
+      context.Background(), "my-project", manyAccounts(6), ContinueOnError,
+      WithGenerateKey(false),
+   )
+   require.NoError(t, err)
+
+   // The first account uses the burst; the other five wait 20ms each.
+   assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+   assert.Equal(t, 6, attempts)
+}
+
+func TestNewM2MServiceAccounts_ContextCanceled_ShouldSkipRemaining(
+   t *testing.T,
+) {
+   ctx, cancel := context.WithCancel(context.Background())
+   cancel()
+
+   attempts := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: failingCreate(nil, &attempts),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithBatchRateLimit(1, 1)(p)
+
+   results, err := p.NewM2MServiceAccounts(
+      ctx, "my-project", batchAccounts, ContinueOnError,
+   )
+   assert.ErrorIs(t, err, context.Canceled)
+   assert.Equal(t, 0, attempts)
+   for _, result := range results {
+      assert.ErrorIs(t, result.Err, context.Canceled)
+   }
+}
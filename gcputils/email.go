@@ -0,0 +1,43 @@
+package gcputils
+
+import (
+   "errors"
+   "fmt"
+   "regexp"
+   "strings"
+)
+
+// serviceAccountDomain is the email domain suffix of user-created service
+// accounts, following the project ID.
+const serviceAccountDomain = ".iam.gserviceaccount.com"
+
+// ErrInvalidEmail indicates a string is not a user-created service account
+// email of the form {account}@{project}.iam.gserviceaccount.com.
+var ErrInvalidEmail = errors.New("gcputils, invalid service account email")
+
+var (
+   // accountIDPattern matches service account IDs: 6 to 30 lowercase
+   // letters, digits and hyphens, starting with a letter and not ending
+   // with a hyphen.
+   accountIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+   // projectIDPattern matches project IDs, which follow the same rules.
+   projectIDPattern = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+)
+
+// ParseServiceAccountEmail validates that email has the shape
+// {account}@{project}.iam.gserviceaccount.com and returns its account ID and
+// project ID, or ErrInvalidEmail.
+func ParseServiceAccountEmail(
+   email string,
+) (accountID string, projectID string, err error) {
+   accountID, domain, ok := strings.Cut(email, "@")
+   projectID, hasSuffix := strings.CutSuffix(domain, serviceAccountDomain)
+
+   if !ok || !hasSuffix ||
+      !accountIDPattern.MatchString(accountID) ||
+      !projectIDPattern.MatchString(projectID) {
+      return "", "", fmt.Errorf("email '%s'; %w", email, ErrInvalidEmail)
+   }
+
+   return accountID, projectID, nil
+}
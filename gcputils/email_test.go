@@ -0,0 +1,62 @@
+package gcputils
+
+import (
+   "testing"
+
+   "github.com/stretchr/testify/assert"
+)
+
+func TestParseServiceAccountEmail_Valid_ShouldExtractParts(t *testing.T) {
+   tests := []struct {
+      email       string
+      wantAccount string
+      wantProject string
+   }{
+      {
+         email:       testEmail,
+         wantAccount: "client",
+         wantProject: "my-project",
+      },
+      {
+         email:       "acme-client-01@prod-123456.iam.gserviceaccount.com",
+         wantAccount: "acme-client-01",
+         wantProject: "prod-123456",
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.email, func(t *testing.T) {
+         account, project, err := ParseServiceAccountEmail(tt.email)
+         assert.NoError(t, err)
+         assert.Equal(t, tt.wantAccount, account)
+         assert.Equal(t, tt.wantProject, project)
+      })
+   }
+}
+
+func TestParseServiceAccountEmail_Malformed_ShouldReturnErrInvalidEmail(
+   t *testing.T,
+) {
+   emails := []string{
+      "",
+      "client",
+      "client@",
+      "@my-project.iam.gserviceaccount.com",
+      "client@my-project",
+      "client@my-project.gserviceaccount.com",
+      "client@@my-project.iam.gserviceaccount.com",
+      "Client@my-project.iam.gserviceaccount.com",
+      "abc@my-project.iam.gserviceaccount.com",
+      "client-@my-project.iam.gserviceaccount.com",
+      "1client@my-project.iam.gserviceaccount.com",
+      "client@my.project.iam.gserviceaccount.com",
+      "123-compute@developer.gserviceaccount.com",
+   }
+
+   for _, email := range emails {
+      t.Run(email, func(t *testing.T) {
+         _, _, err := ParseServiceAccountEmail(email)
+         assert.ErrorIs(t, err, ErrInvalidEmail)
+      })
+   }
+}
@@ -0,0 +1,53 @@
+package gcputils
+
+import (
+   "errors"
+   "fmt"
+
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+var (
+   // ErrNotFound indicates the requested GCP resource does not exist.
+   ErrNotFound = errors.New("gcputils, not found")
+   // ErrAlreadyExists indicates the GCP resource being created already
+   // exists.
+   ErrAlreadyExists = errors.New("gcputils, already exists")
+   // ErrPermissionDenied indicates the caller lacks the IAM permissions for
+   // the operation.
+   ErrPermissionDenied = errors.New("gcputils, permission denied")
+   // ErrQuotaExceeded indicates a GCP quota or rate limit was exhausted.
+   ErrQuotaExceeded = errors.New("gcputils, quota exceeded")
+   // ErrPolicyConflict indicates an IAM policy kept being modified
+   // concurrently while it was being updated, exhausting the retries.
+   ErrPolicyConflict = errors.New("gcputils, IAM policy modified concurrently")
+   // ErrPreconditionFailed indicates the project is not in a state allowing
+   // the operation, e.g. an organization policy disabling key creation.
+   ErrPreconditionFailed = errors.New("gcputils, precondition failed")
+   // ErrInvalidArgument indicates GCP rejected a request parameter, e.g. a
+   // malformed account ID.
+   ErrInvalidArgument = errors.New("gcputils, invalid argument")
+)
+
+// codeSentinels maps gRPC status codes to the exported sentinel errors.
+var codeSentinels = map[codes.Code]error{
+   codes.NotFound:           ErrNotFound,
+   codes.AlreadyExists:      ErrAlreadyExists,
+   codes.PermissionDenied:   ErrPermissionDenied,
+   codes.ResourceExhausted:  ErrQuotaExceeded,
+   codes.FailedPrecondition: ErrPreconditionFailed,
+   codes.InvalidArgument:    ErrInvalidArgument,
+}
+
+// wrapError annotates err returned by the GCP call op. When the gRPC status
+// code has a matching sentinel, the result wraps both the sentinel and the
+// original error so either can be matched with errors.Is and status.Code.
+func wrapError(op string, err error) error {
+   sentinel, ok := codeSentinels[status.Code(err)]
+   if !ok {
+      return fmt.Errorf("%s: %w", op, err)
+   }
+
+   return fmt.Errorf("%s: %w; %w", op, err, sentinel)
+}
@@ -0,0 +1,110 @@
+package gcputils
+
+import (
+   "context"
+   "testing"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+func TestWrapError_EachCode_ShouldMapToSentinel(t *testing.T) {
+   tests := []struct {
+      code codes.Code
+      want error
+   }{
+      {code: codes.NotFound, want: ErrNotFound},
+      {code: codes.AlreadyExists, want: ErrAlreadyExists},
+      {code: codes.PermissionDenied, want: ErrPermissionDenied},
+      {code: codes.ResourceExhausted, want: ErrQuotaExceeded},
+      {code: codes.FailedPrecondition, want: ErrPreconditionFailed},
+      {code: codes.InvalidArgument, want: ErrInvalidArgument},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.code.String(), func(t *testing.T) {
+         rpcErr := status.Error(tt.code, "failed")
+         ctx := context.Background()
+         admin := &fakeAdminClient{
+            createServiceAccount: func(
+               *iamadminpb.CreateServiceAccountRequest,
+            ) (*iamadminpb.ServiceAccount, error) {
+               return nil, rpcErr
+            },
+            deleteServiceAccount: func(
+               *iamadminpb.DeleteServiceAccountRequest,
+            ) error {
+               return rpcErr
+            },
+         }
+         policy := &fakePolicyClient{getPolicyErr: rpcErr}
+         p := newProvisioner(admin, policy)
+
+         _, err := p.NewM2MServiceAccount(ctx, "my-project", "acme", "Acme")
+         assert.ErrorIs(t, err, tt.want)
+         assert.ErrorIs(t, err, rpcErr)
+         assert.Equal(t, tt.code, status.Code(err))
+
+         err = p.DeleteM2MServiceAccount(ctx, "my-project", testEmail)
+         assert.ErrorIs(t, err, tt.want)
+
+         _, err = p.GrantRolesToServiceAccount(
+            ctx, "my-project", testEmail, []string{"roles/viewer"},
+         )
+         assert.ErrorIs(t, err, tt.want)
+      })
+   }
+}
+
+func TestWrapError_UnmappedCode_ShouldWrapOriginalOnly(t *testing.T) {
+   rpcErr := status.Error(codes.Internal, "failed")
+
+   err := wrapError("CreateServiceAccount", rpcErr)
+   assert.ErrorIs(t, err, rpcErr)
+   assert.NotErrorIs(t, err, ErrNotFound)
+   assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+func TestNewM2MServiceAccount_KeyCreationRejected_ShouldMapAndCleanUp(
+   t *testing.T,
+) {
+   tests := []struct {
+      code codes.Code
+      want error
+   }{
+      {code: codes.FailedPrecondition, want: ErrPreconditionFailed},
+      {code: codes.InvalidArgument, want: ErrInvalidArgument},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.code.String(), func(t *testing.T) {
+         var req *iamadminpb.CreateServiceAccountRequest
+         deleted := false
+         admin := &fakeAdminClient{
+            createServiceAccount: recordCreate(&req),
+            createServiceAccountKey: func(
+               *iamadminpb.CreateServiceAccountKeyRequest,
+            ) (*iamadminpb.ServiceAccountKey, error) {
+               return nil, status.Error(tt.code, "key creation disabled")
+            },
+            deleteServiceAccount: func(
+               *iamadminpb.DeleteServiceAccountRequest,
+            ) error {
+               deleted = true
+               return nil
+            },
+         }
+         p := newProvisioner(admin, &fakePolicyClient{})
+
+         _, err := p.NewM2MServiceAccount(
+            context.Background(), "my-project", "acme", "Acme",
+         )
+         assert.ErrorIs(t, err, tt.want)
+         assert.Equal(t, tt.code, status.Code(err))
+         assert.ErrorContains(t, err, "CreateServiceAccountKey")
+         assert.True(t, deleted)
+      })
+   }
+}
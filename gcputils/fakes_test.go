@@ -0,0 +1,285 @@
+package gcputils
+
+import (
+   "context"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "cloud.google.com/go/iam/apiv1/iampb"
+   "github.com/googleapis/gax-go/v2"
+   "google.golang.org/api/cloudresourcemanager/v3"
+   "google.golang.org/protobuf/proto"
+)
+
+// fakeAdminClient is an in-memory iamAdminClient. Each RPC delegates to the
+// corresponding func field when set and otherwise returns a zero value.
+type fakeAdminClient struct {
+   closed   bool
+   closeErr error
+
+   createServiceAccount func(
+      *iamadminpb.CreateServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error)
+   getServiceAccount func(
+      *iamadminpb.GetServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error)
+   listAllServiceAccounts func(
+      name string,
+   ) ([]*iamadminpb.ServiceAccount, error)
+   patchServiceAccount func(
+      *iamadminpb.PatchServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error)
+   createServiceAccountKey func(
+      *iamadminpb.CreateServiceAccountKeyRequest,
+   ) (*iamadminpb.ServiceAccountKey, error)
+   deleteServiceAccount func(
+      *iamadminpb.DeleteServiceAccountRequest,
+   ) error
+   listServiceAccountKeys func(
+      *iamadminpb.ListServiceAccountKeysRequest,
+   ) (*iamadminpb.ListServiceAccountKeysResponse, error)
+   getServiceAccountKey func(
+      *iamadminpb.GetServiceAccountKeyRequest,
+   ) (*iamadminpb.ServiceAccountKey, error)
+   deleteServiceAccountKey func(
+      *iamadminpb.DeleteServiceAccountKeyRequest,
+   ) error
+   createRole func(
+      *iamadminpb.CreateRoleRequest,
+   ) (*iamadminpb.Role, error)
+   getRole func(
+      *iamadminpb.GetRoleRequest,
+   ) (*iamadminpb.Role, error)
+   queryGrantableRoles func(
+      *iamadminpb.QueryGrantableRolesRequest,
+   ) (*iamadminpb.QueryGrantableRolesResponse, error)
+}
+
+func (f *fakeAdminClient) CreateServiceAccount(
+   _ context.Context,
+   req *iamadminpb.CreateServiceAccountRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ServiceAccount, error) {
+   if f.createServiceAccount == nil {
+      return &iamadminpb.ServiceAccount{}, nil
+   }
+
+   return f.createServiceAccount(req)
+}
+
+func (f *fakeAdminClient) GetServiceAccount(
+   _ context.Context,
+   req *iamadminpb.GetServiceAccountRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ServiceAccount, error) {
+   if f.getServiceAccount == nil {
+      return &iamadminpb.ServiceAccount{Name: req.Name}, nil
+   }
+
+   return f.getServiceAccount(req)
+}
+
+func (f *fakeAdminClient) ListAllServiceAccounts(
+   _ context.Context,
+   name string,
+) ([]*iamadminpb.ServiceAccount, error) {
+   if f.listAllServiceAccounts == nil {
+      return nil, nil
+   }
+
+   return f.listAllServiceAccounts(name)
+}
+
+func (f *fakeAdminClient) PatchServiceAccount(
+   _ context.Context,
+   req *iamadminpb.PatchServiceAccountRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ServiceAccount, error) {
+   if f.patchServiceAccount == nil {
+      return req.ServiceAccount, nil
+   }
+
+   return f.patchServiceAccount(req)
+}
+
+func (f *fakeAdminClient) CreateServiceAccountKey(
+   _ context.Context,
+   req *iamadminpb.CreateServiceAccountKeyRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ServiceAccountKey, error) {
+   if f.createServiceAccountKey == nil {
+      return &iamadminpb.ServiceAccountKey{}, nil
+   }
+
+   return f.createServiceAccountKey(req)
+}
+
+func (f *fakeAdminClient) DeleteServiceAccount(
+   _ context.Context,
+   req *iamadminpb.DeleteServiceAccountRequest,
+   _ ...gax.CallOption,
+) error {
+   if f.deleteServiceAccount == nil {
+      return nil
+   }
+
+   return f.deleteServiceAccount(req)
+}
+
+func (f *fakeAdminClient) ListServiceAccountKeys(
+   _ context.Context,
+   req *iamadminpb.ListServiceAccountKeysRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+   if f.listServiceAccountKeys == nil {
+      return &iamadminpb.ListServiceAccountKeysResponse{}, nil
+   }
+
+   return f.listServiceAccountKeys(req)
+}
+
+func (f *fakeAdminClient) GetServiceAccountKey(
+   _ context.Context,
+   req *iamadminpb.GetServiceAccountKeyRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ServiceAccountKey, error) {
+   if f.getServiceAccountKey == nil {
+      return &iamadminpb.ServiceAccountKey{
+         Name:    req.Name,
+         KeyType: iamadminpb.ListServiceAccountKeysRequest_USER_MANAGED,
+      }, nil
+   }
+
+   return f.getServiceAccountKey(req)
+}
+
+func (f *fakeAdminClient) DeleteServiceAccountKey(
+   _ context.Context,
+   req *iamadminpb.DeleteServiceAccountKeyRequest,
+   _ ...gax.CallOption,
+) error {
+   if f.deleteServiceAccountKey == nil {
+      return nil
+   }
+
+   return f.deleteServiceAccountKey(req)
+}
+
+func (f *fakeAdminClient) CreateRole(
+   _ context.Context,
+   req *iamadminpb.CreateRoleRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.Role, error) {
+   if f.createRole == nil {
+      return req.Role, nil
+   }
+
+   return f.createRole(req)
+}
+
+func (f *fakeAdminClient) GetRole(
+   _ context.Context,
+   req *iamadminpb.GetRoleRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.Role, error) {
+   if f.getRole == nil {
+      return &iamadminpb.Role{Name: req.Name}, nil
+   }
+
+   return f.getRole(req)
+}
+
+func (f *fakeAdminClient) QueryGrantableRoles(
+   _ context.Context,
+   req *iamadminpb.QueryGrantableRolesRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.QueryGrantableRolesResponse, error) {
+   if f.queryGrantableRoles == nil {
+      return &iamadminpb.QueryGrantableRolesResponse{}, nil
+   }
+
+   return f.queryGrantableRoles(req)
+}
+
+func (f *fakeAdminClient) Close() error {
+   f.closed = true
+   return f.closeErr
+}
+
+// fakePolicyClient is an in-memory iamPolicyClient holding a single policy.
+type fakePolicyClient struct {
+   closed   bool
+   closeErr error
+
+   policy         *iampb.Policy
+   getPolicyErr   error
+   setPolicyErr   error
+   getPolicyCalls int
+   // getPolicyReq is the request of the last GetIamPolicy call.
+   getPolicyReq *iampb.GetIamPolicyRequest
+   // setPolicyErrs are returned by successive SetIamPolicy calls before
+   // setPolicyErr applies.
+   setPolicyErrs  []error
+   setPolicyCalls int
+}
+
+func (f *fakePolicyClient) GetIamPolicy(
+   _ context.Context,
+   req *iampb.GetIamPolicyRequest,
+   _ ...gax.CallOption,
+) (*iampb.Policy, error) {
+   f.getPolicyCalls++
+   f.getPolicyReq = req
+   if f.getPolicyErr != nil {
+      return nil, f.getPolicyErr
+   }
+
+   if f.policy == nil {
+      f.policy = &iampb.Policy{}
+   }
+
+   // Each read returns a copy, as from the API, so a failed write leaves the
+   // stored policy untouched.
+   return proto.Clone(f.policy).(*iampb.Policy), nil
+}
+
+func (f *fakePolicyClient) SetIamPolicy(
+   _ context.Context,
+   req *iampb.SetIamPolicyRequest,
+   _ ...gax.CallOption,
+) (*iampb.Policy, error) {
+   f.setPolicyCalls++
+   if len(f.setPolicyErrs) > 0 {
+      err := f.setPolicyErrs[0]
+      f.setPolicyErrs = f.setPolicyErrs[1:]
+      return nil, err
+   }
+
+   if f.setPolicyErr != nil {
+      return nil, f.setPolicyErr
+   }
+
+   f.policy = req.Policy
+   return f.policy, nil
+}
+
+func (f *fakePolicyClient) Close() error {
+   f.closed = true
+   return f.closeErr
+}
+
+// fakeProjectsClient is an in-memory projectsClient. GetProject delegates to
+// getProject when set and otherwise returns an ACTIVE project.
+type fakeProjectsClient struct {
+   getProject func(name string) (*cloudresourcemanager.Project, error)
+}
+
+func (f *fakeProjectsClient) GetProject(
+   _ context.Context,
+   name string,
+) (*cloudresourcemanager.Project, error) {
+   if f.getProject == nil {
+      return &cloudresourcemanager.Project{Name: name, State: "ACTIVE"}, nil
+   }
+
+   return f.getProject(name)
+}
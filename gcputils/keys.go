@@ -0,0 +1,135 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+   "strings"
+
+   "cloud.google.com/go/auth/credentials"
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+)
+
+var (
+   // ErrInvalidKeyName indicates a key resource name is not of the form
+   // projects/{project}/serviceAccounts/{account}/keys/{key}.
+   ErrInvalidKeyName = errors.New("gcputils, invalid key name")
+   // ErrSystemManagedKey indicates an operation targeted a key managed by
+   // Google, which cannot be deleted by callers.
+   ErrSystemManagedKey = errors.New("gcputils, system managed key")
+   // ErrKeyEncryption indicates the KeyEncrypter configured with
+   // WithKeyEncrypter failed to encrypt the generated key.
+   ErrKeyEncryption = errors.New("gcputils, key encryption failed")
+   // ErrKeyVerification indicates a generated key could not be used to
+   // authenticate when verified with WithKeyVerification.
+   ErrKeyVerification = errors.New("gcputils, key verification failed")
+)
+
+// cloudPlatformScope is the scope of the token minted by VerifyKey.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// KeyEncrypter encrypts the credentials JSON of a generated key, e.g. with a
+// Cloud KMS key or a public key of the caller, returning the ciphertext.
+type KeyEncrypter func(ctx context.Context, plaintext []byte) ([]byte, error)
+
+// KeyVerifier checks that the credentials JSON of a generated key can
+// authenticate, returning an error when it cannot. VerifyKey is the default.
+type KeyVerifier func(ctx context.Context, credentialsJSON []byte) error
+
+// VerifyKey builds credentials from the credentials JSON of a service
+// account key and mints an access token with them, confirming Google
+// accepts the key. It makes a call to the OAuth token endpoint but requires
+// no further permissions.
+func VerifyKey(ctx context.Context, credentialsJSON []byte) error {
+   creds, err := credentials.DetectDefault(&credentials.DetectOptions{
+      CredentialsJSON: credentialsJSON,
+      Scopes:          []string{cloudPlatformScope},
+   })
+   if err != nil {
+      return fmt.Errorf("build credentials: %w", err)
+   }
+
+   if _, err := creds.Token(ctx); err != nil {
+      return fmt.Errorf("mint token: %w", err)
+   }
+
+   return nil
+}
+
+// validateKeyName checks that keyName has the form
+// projects/{project}/serviceAccounts/{account}/keys/{key}.
+func validateKeyName(keyName string) error {
+   parts := strings.Split(keyName, "/")
+   if len(parts) != 6 ||
+      parts[0] != "projects" ||
+      parts[2] != "serviceAccounts" ||
+      parts[4] != "keys" {
+      return fmt.Errorf("key name '%s'; %w", keyName, ErrInvalidKeyName)
+   }
+
+   for _, part := range parts {
+      if part == "" {
+         return fmt.Errorf("key name '%s'; %w", keyName, ErrInvalidKeyName)
+      }
+   }
+
+   return nil
+}
+
+// isSystemManaged reports whether key is managed by Google rather than the
+// caller.
+func isSystemManaged(key *iamadminpb.ServiceAccountKey) bool {
+   return key.KeyType == iamadminpb.ListServiceAccountKeysRequest_SYSTEM_MANAGED
+}
+
+// DeleteServiceAccountKey deletes a service account key using a short-lived
+// Provisioner.
+func DeleteServiceAccountKey(ctx context.Context, keyName string) error {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return err
+   }
+   defer p.Close()
+
+   return p.DeleteServiceAccountKey(ctx, keyName)
+}
+
+// DeleteServiceAccountKey deletes the key identified by its full resource
+// name, e.g. as returned in M2MServiceAccount.KeyName. A key that does not
+// exist returns ErrNotFound, and a system-managed key returns
+// ErrSystemManagedKey without attempting deletion.
+func (p *Provisioner) DeleteServiceAccountKey(
+   ctx context.Context,
+   keyName string,
+) error {
+   if err := validateKeyName(keyName); err != nil {
+      return err
+   }
+
+   key, err := p.admin.GetServiceAccountKey(
+      ctx, &iamadminpb.GetServiceAccountKeyRequest{Name: keyName},
+   )
+   if err != nil {
+      return fmt.Errorf(
+         "key '%s': %w", keyName, wrapError("GetServiceAccountKey", err),
+      )
+   }
+
+   if isSystemManaged(key) {
+      return fmt.Errorf("key '%s'; %w", keyName, ErrSystemManagedKey)
+   }
+
+   err = p.admin.DeleteServiceAccountKey(
+      ctx, &iamadminpb.DeleteServiceAccountKeyRequest{Name: keyName},
+   )
+   if err != nil {
+      return fmt.Errorf(
+         "key '%s': %w", keyName, wrapError("DeleteServiceAccountKey", err),
+      )
+   }
+
+   slog.Info("Key deleted", "key ID", keyName)
+
+   return nil
+}
@@ -0,0 +1,85 @@
+package gcputils
+
+import (
+   "context"
+   "testing"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const testKeyName = "projects/my-project/serviceAccounts/" + testEmail +
+   "/keys/abc123"
+
+func TestDeleteServiceAccountKey_ValidName_ShouldDelete(t *testing.T) {
+   var deleted string
+   admin := &fakeAdminClient{
+      deleteServiceAccountKey: func(
+         req *iamadminpb.DeleteServiceAccountKeyRequest,
+      ) error {
+         deleted = req.Name
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   err := p.DeleteServiceAccountKey(context.Background(), testKeyName)
+   assert.NoError(t, err)
+   assert.Equal(t, testKeyName, deleted)
+}
+
+func TestDeleteServiceAccountKey_MalformedName_ShouldReturnInvalidKeyName(
+   t *testing.T,
+) {
+   names := []string{
+      "",
+      "abc123",
+      "projects/my-project/serviceAccounts/" + testEmail,
+      "projects/my-project/keys/" + testEmail + "/keys/abc123",
+      "projects//serviceAccounts/" + testEmail + "/keys/abc123",
+   }
+
+   p := newProvisioner(&fakeAdminClient{}, &fakePolicyClient{})
+   for _, name := range names {
+      err := p.DeleteServiceAccountKey(context.Background(), name)
+      assert.ErrorIs(t, err, ErrInvalidKeyName, name)
+   }
+}
+
+func TestDeleteServiceAccountKey_MissingKey_ShouldReturnNotFound(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      getServiceAccountKey: func(
+         *iamadminpb.GetServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return nil, status.Error(codes.NotFound, "key not found")
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   err := p.DeleteServiceAccountKey(context.Background(), testKeyName)
+   assert.ErrorIs(t, err, ErrNotFound)
+   assert.ErrorContains(t, err, testKeyName)
+}
+
+func TestDeleteServiceAccountKey_SystemManaged_ShouldReturnError(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      getServiceAccountKey: func(
+         req *iamadminpb.GetServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            Name:    req.Name,
+            KeyType: iamadminpb.ListServiceAccountKeysRequest_SYSTEM_MANAGED,
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   err := p.DeleteServiceAccountKey(context.Background(), testKeyName)
+   assert.ErrorIs(t, err, ErrSystemManagedKey)
+}
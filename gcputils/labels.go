@@ -0,0 +1,86 @@
+package gcputils
+
+import (
+   "errors"
+   "fmt"
+   "maps"
+   "regexp"
+   "slices"
+   "strings"
+)
+
+// ErrInvalidLabels indicates labels do not follow the GCP label rules or do
+// not fit in the account description.
+var ErrInvalidLabels = errors.New("gcputils, invalid labels")
+
+var (
+   // labelKeyPattern matches label keys: up to 63 lowercase letters,
+   // digits, underscores and hyphens, starting with a letter.
+   labelKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,62}$`)
+   // labelValuePattern matches label values, which may also be empty.
+   labelValuePattern = regexp.MustCompile(`^[a-z0-9_-]{0,63}$`)
+)
+
+// validateLabels checks labels against the GCP label rules.
+func validateLabels(labels map[string]string) error {
+   for key, val := range labels {
+      if !labelKeyPattern.MatchString(key) ||
+         !labelValuePattern.MatchString(val) {
+         return fmt.Errorf("label '%s=%s'; %w", key, val, ErrInvalidLabels)
+      }
+   }
+
+   return nil
+}
+
+// withLabels appends labels to the account description as a trailing
+// "{key=value,...}" block sorted by key. IAM service accounts have no labels
+// field, so the description carries them.
+func withLabels(description string, labels map[string]string) string {
+   pairs := make([]string, 0, len(labels))
+   for _, key := range slices.Sorted(maps.Keys(labels)) {
+      pairs = append(pairs, key+"="+labels[key])
+   }
+
+   return description + " {" + strings.Join(pairs, ",") + "}"
+}
+
+// parseLabels returns the labels carried by an account description, or nil
+// when it has none.
+func parseLabels(description string) map[string]string {
+   block, ok := strings.CutSuffix(description, "}")
+   if !ok {
+      return nil
+   }
+
+   idx := strings.LastIndex(block, " {")
+   if idx < 0 {
+      return nil
+   }
+
+   labels := map[string]string{}
+   for _, pair := range strings.Split(block[idx+2:], ",") {
+      key, val, ok := strings.Cut(pair, "=")
+      if !ok {
+         return nil
+      }
+      labels[key] = val
+   }
+
+   if validateLabels(labels) != nil {
+      return nil
+   }
+
+   return labels
+}
+
+// hasLabels reports whether got carries every label of want.
+func hasLabels(got map[string]string, want map[string]string) bool {
+   for key, val := range want {
+      if gotVal, ok := got[key]; !ok || gotVal != val {
+         return false
+      }
+   }
+
+   return true
+}
@@ -0,0 +1,190 @@
+package gcputils
+
+import (
+   "context"
+   "strings"
+   "testing"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+func TestNewM2MServiceAccount_Labels_ShouldPatchDescription(t *testing.T) {
+   var patch *iamadminpb.PatchServiceAccountRequest
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      patchServiceAccount: func(
+         r *iamadminpb.PatchServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         patch = r
+         return r.ServiceAccount, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   labels := map[string]string{"team": "core", "env": "prd"}
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithLabels(labels),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, labels, sa.Labels)
+   assert.Equal(t,
+      "M2M client SA for acme-client", req.ServiceAccount.Description,
+   )
+   if assert.NotNil(t, patch) {
+      assert.Equal(t,
+         "M2M client SA for acme-client {env=prd,team=core}",
+         patch.ServiceAccount.Description,
+      )
+      assert.Equal(t, []string{"description"}, patch.UpdateMask.Paths)
+   }
+}
+
+func TestNewM2MServiceAccount_LabelPatchFails_ShouldRollBack(t *testing.T) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   var deleted string
+   keyCreated := false
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      patchServiceAccount: func(
+         *iamadminpb.PatchServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         return nil, status.Error(codes.PermissionDenied, "denied")
+      },
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         keyCreated = true
+         return &iamadminpb.ServiceAccountKey{}, nil
+      },
+      deleteServiceAccount: func(
+         r *iamadminpb.DeleteServiceAccountRequest,
+      ) error {
+         deleted = r.Name
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithLabels(map[string]string{"team": "core"}),
+   )
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   assert.Nil(t, sa)
+   assert.False(t, keyCreated)
+   assert.Equal(t, "projects/my-project/serviceAccounts/"+testEmail, deleted)
+}
+
+func TestNewM2MServiceAccount_InvalidLabels_ShouldNotCreate(t *testing.T) {
+   tests := []struct {
+      name   string
+      labels map[string]string
+   }{
+      {name: "uppercase key", labels: map[string]string{"Team": "core"}},
+      {name: "digit first", labels: map[string]string{"1team": "core"}},
+      {name: "comma in value", labels: map[string]string{"team": "a,b"}},
+      {
+         name: "description too long",
+         labels: map[string]string{
+            "a": longLabelValue,
+            "b": longLabelValue,
+            "c": longLabelValue,
+            "d": longLabelValue,
+         },
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         created := false
+         admin := &fakeAdminClient{
+            createServiceAccount: func(
+               *iamadminpb.CreateServiceAccountRequest,
+            ) (*iamadminpb.ServiceAccount, error) {
+               created = true
+               return &iamadminpb.ServiceAccount{}, nil
+            },
+         }
+         p := newProvisioner(admin, &fakePolicyClient{})
+
+         _, err := p.NewM2MServiceAccount(
+            context.Background(),
+            "my-project",
+            "acme-client",
+            "Acme Client",
+            WithLabels(tt.labels),
+         )
+         assert.ErrorIs(t, err, ErrInvalidLabels)
+         assert.False(t, created)
+      })
+   }
+}
+
+// longLabelValue is a label value of the maximum length.
+var longLabelValue = strings.Repeat("a", 63)
+
+func TestListM2MServiceAccounts_Labels_ShouldFilter(t *testing.T) {
+   admin := &fakeAdminClient{
+      listAllServiceAccounts: func(
+         string,
+      ) ([]*iamadminpb.ServiceAccount, error) {
+         return []*iamadminpb.ServiceAccount{
+            {
+               Email:       "core@my-project.iam.gserviceaccount.com",
+               Description: "M2M client SA for core {env=prd,team=core}",
+            },
+            {
+               Email:       "web@my-project.iam.gserviceaccount.com",
+               Description: "M2M client SA for web {env=prd,team=web}",
+            },
+            {
+               Email:       "plain@my-project.iam.gserviceaccount.com",
+               Description: "M2M client SA for plain",
+            },
+            {
+               Email:       "other@my-project.iam.gserviceaccount.com",
+               Description: "Hand made {team=core}",
+            },
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   all, err := p.ListM2MServiceAccounts(context.Background(), "my-project")
+   assert.NoError(t, err)
+   assert.Len(t, all, 3)
+   assert.Nil(t, all[2].Labels)
+
+   core, err := p.ListM2MServiceAccounts(
+      context.Background(),
+      "my-project",
+      WithLabels(map[string]string{"team": "core"}),
+   )
+   assert.NoError(t, err)
+   if assert.Len(t, core, 1) {
+      assert.Equal(t, "core@my-project.iam.gserviceaccount.com", core[0].Email)
+      assert.Equal(t,
+         map[string]string{"env": "prd", "team": "core"}, core[0].Labels,
+      )
+   }
+}
+
+func TestParseLabels_Description_ShouldRoundTrip(t *testing.T) {
+   labels := map[string]string{"team": "core", "client": "", "env": "prd"}
+
+   desc := withLabels("M2M client SA for acme [expires x]", labels)
+   assert.Equal(t, labels, parseLabels(desc))
+   assert.Nil(t, parseLabels("M2M client SA for acme [expires x]"))
+   assert.Nil(t, parseLabels("M2M client SA for acme {not labels}"))
+}
@@ -0,0 +1,296 @@
+package gcputils
+
+import (
+   "context"
+   "fmt"
+   "maps"
+   "strings"
+   "text/template"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/clintrovert/gobackend/environ"
+)
+
+// m2mDescriptionPrefix is the default start of the description of every
+// account created by NewM2MServiceAccount, identifying the accounts managed by
+// this package.
+const m2mDescriptionPrefix = "M2M client SA for "
+
+// The descriptions of accounts continue the description prefix template with
+// one of these.
+const (
+   descriptionSuffix    = "{{.ClientID}}"
+   envDescriptionSuffix = "{{.ClientID}} [{{.Environment}}]"
+)
+
+// accountMarker stands in for the values that differ between accounts when
+// the description prefix is rendered to match managed accounts.
+const accountMarker = "\x00"
+
+var (
+   defaultDisplayNameTemplate = template.Must(
+      template.New("displayName").Parse("{{.DisplayName}}"),
+   )
+   envDisplayNameTemplate = template.Must(
+      template.New("displayName").Parse(
+         "{{.DisplayName}} [{{.Environment}}]",
+      ),
+   )
+)
+
+// M2MOption configures the behavior of NewM2MServiceAccount.
+type M2MOption func(*m2mOptions)
+
+type m2mOptions struct {
+   environment       environ.Environment
+   skipKey           bool
+   descriptionPrefix string
+   validateProject   bool
+   keyExpiresAt      time.Time
+   labels            map[string]string
+   keyEncrypter      KeyEncrypter
+   keyVerifier       KeyVerifier
+}
+
+// WithEnvironment interpolates the environment into the display name and
+// description of the created service account, e.g. "acme-client [prd]", so
+// accounts are distinguishable in the console.
+func WithEnvironment(env environ.Environment) M2MOption {
+   return func(o *m2mOptions) {
+      o.environment = env
+   }
+}
+
+// WithGenerateKey controls whether a downloadable key is created for the
+// account, which is the default. Disable it for accounts used through
+// Workload Identity Federation; the returned M2MServiceAccount then has empty
+// PrivateKey and KeyID fields.
+func WithGenerateKey(generate bool) M2MOption {
+   return func(o *m2mOptions) {
+      o.skipKey = !generate
+   }
+}
+
+// WithDescriptionPrefix replaces the "M2M client SA for " start of the
+// account description, e.g. with a format including tags that other tooling
+// keys off. The prefix is a text/template executed with the same data as the
+// display name, i.e. the ClientID, DisplayName and Environment, e.g.
+// "[team:payments env:{{.Environment}}] m2m "; text without actions is used
+// as is. The client ID follows the prefix.
+//
+// The same option, along with WithEnvironment if the prefix uses it, must be
+// passed to ListM2MServiceAccounts and PruneExpiredKeys, which render the
+// prefix up to the first client specific value to find the accounts managed
+// by this package. An empty prefix keeps the default.
+func WithDescriptionPrefix(tmpl string) M2MOption {
+   return func(o *m2mOptions) {
+      if tmpl != "" {
+         o.descriptionPrefix = tmpl
+      }
+   }
+}
+
+// WithProjectValidation checks that the project exists and is ACTIVE before
+// creating the account, returning ErrProjectNotFound early instead of a
+// confusing IAM error. It is off by default as it requires the
+// resourcemanager.projects.get permission.
+func WithProjectValidation() M2MOption {
+   return func(o *m2mOptions) {
+      o.validateProject = true
+   }
+}
+
+// WithKeyExpiry records when the generated key is intended to expire, e.g.
+// a rotation deadline, as M2MServiceAccount.ExpiresAt and in the account
+// description, e.g. "M2M client SA for acme-client [expires
+// 2026-01-02T15:04:05Z]". GCP keys do not expire, so nothing enforces it. It
+// is ignored when no key is generated.
+func WithKeyExpiry(expiresAt time.Time) M2MOption {
+   return func(o *m2mOptions) {
+      o.keyExpiresAt = expiresAt.UTC().Truncate(time.Second)
+   }
+}
+
+// WithLabels labels the created account, e.g. with team, env and client for
+// cost attribution. IAM service accounts have no labels field, so the labels
+// are appended to the description, e.g. "M2M client SA for acme-client
+// {env=prd,team=core}", by a patch following the creation; the account is
+// deleted again if the patch fails. Keys and values follow the GCP label
+// rules. Replacing the description with UpdateM2MServiceAccount drops the
+// labels.
+//
+// Passed to ListM2MServiceAccounts or PruneExpiredKeys, only the accounts
+// carrying every one of the labels are considered.
+func WithLabels(labels map[string]string) M2MOption {
+   return func(o *m2mOptions) {
+      o.labels = maps.Clone(labels)
+   }
+}
+
+// WithKeyEncrypter encrypts the generated key with encrypt before it is
+// returned, so the plaintext credentials never leave gcputils. The returned
+// M2MServiceAccount then carries the ciphertext in EncryptedPrivateKey and
+// an empty PrivateKey, and the plaintext is zeroed. The account is deleted
+// again if the encryption fails.
+func WithKeyEncrypter(encrypt KeyEncrypter) M2MOption {
+   return func(o *m2mOptions) {
+      o.keyEncrypter = encrypt
+   }
+}
+
+// WithKeyVerification checks the generated key with verify before it is
+// returned, so a broken key fails provisioning rather than its first use. A
+// nil verify uses VerifyKey, which mints a token with the key. The account is
+// deleted again if the verification fails. It is off by default as it adds
+// a round trip; new keys can take a few seconds to be accepted, so a custom
+// verify may need to retry. It is ignored when no key is generated.
+func WithKeyVerification(verify KeyVerifier) M2MOption {
+   return func(o *m2mOptions) {
+      if verify == nil {
+         verify = VerifyKey
+      }
+      o.keyVerifier = verify
+   }
+}
+
+// verifyKey checks the private key data of key when a KeyVerifier is
+// configured.
+func (o m2mOptions) verifyKey(
+   ctx context.Context,
+   key *iamadminpb.ServiceAccountKey,
+) error {
+   if o.keyVerifier == nil {
+      return nil
+   }
+
+   if err := o.keyVerifier(ctx, key.PrivateKeyData); err != nil {
+      return fmt.Errorf("%w: %w", ErrKeyVerification, err)
+   }
+
+   return nil
+}
+
+// encryptKey replaces the private key data of key with its ciphertext when
+// a KeyEncrypter is configured, zeroing the plaintext.
+func (o m2mOptions) encryptKey(
+   ctx context.Context,
+   key *iamadminpb.ServiceAccountKey,
+) error {
+   if o.keyEncrypter == nil {
+      return nil
+   }
+
+   plaintext := key.PrivateKeyData
+   ciphertext, err := o.keyEncrypter(ctx, plaintext)
+   clear(plaintext)
+   key.PrivateKeyData = nil
+   if err != nil {
+      return fmt.Errorf("%w: %w", ErrKeyEncryption, err)
+   }
+
+   key.PrivateKeyData = ciphertext
+
+   return nil
+}
+
+// manages reports whether sa was created by NewM2MServiceAccount, as
+// identified by prefix, the result of descriptionMatchPrefix, and carries the
+// labels of o.
+func (o m2mOptions) manages(sa *iamadminpb.ServiceAccount, prefix string) bool {
+   return strings.HasPrefix(sa.Description, prefix) &&
+      hasLabels(parseLabels(sa.Description), o.labels)
+}
+
+// accountTemplateData is the data available to service account display name
+// and description templates.
+type accountTemplateData struct {
+   ClientID    string
+   DisplayName string
+   Environment environ.Environment
+}
+
+// descriptionTemplate parses the description prefix template continued by
+// the client ID and, when set, the environment.
+func (o m2mOptions) descriptionTemplate() (*template.Template, error) {
+   suffix := descriptionSuffix
+   if o.environment != environ.Unknown {
+      suffix = envDescriptionSuffix
+   }
+
+   return template.New("description").Parse(o.descriptionPrefix + suffix)
+}
+
+// descriptionMatchPrefix renders the description template up to the first
+// value that differs between accounts, giving the start shared by the
+// descriptions of every account created with the options of o.
+func (o m2mOptions) descriptionMatchPrefix() (string, error) {
+   tmpl, err := o.descriptionTemplate()
+   if err != nil {
+      return "", fmt.Errorf("render description prefix: %w", err)
+   }
+
+   data := accountTemplateData{
+      ClientID:    accountMarker,
+      DisplayName: accountMarker,
+      Environment: o.environment,
+   }
+
+   var desc strings.Builder
+   if err := tmpl.Execute(&desc, data); err != nil {
+      return "", fmt.Errorf("render description prefix: %w", err)
+   }
+
+   prefix, _, _ := strings.Cut(desc.String(), accountMarker)
+
+   return prefix, nil
+}
+
+func newM2MOptions(opts []M2MOption) m2mOptions {
+   o := m2mOptions{descriptionPrefix: m2mDescriptionPrefix}
+   for _, opt := range opts {
+      opt(&o)
+   }
+
+   return o
+}
+
+// accountNames renders the display name and description for a new service
+// account.
+func (o m2mOptions) accountNames(
+   clientID string,
+   displayName string,
+) (string, string, error) {
+   nameTmpl := defaultDisplayNameTemplate
+   if o.environment != environ.Unknown {
+      nameTmpl = envDisplayNameTemplate
+   }
+
+   descTmpl, err := o.descriptionTemplate()
+   if err != nil {
+      return "", "", err
+   }
+
+   data := accountTemplateData{
+      ClientID:    clientID,
+      DisplayName: displayName,
+      Environment: o.environment,
+   }
+
+   var name, desc strings.Builder
+   if err := nameTmpl.Execute(&name, data); err != nil {
+      return "", "", err
+   }
+
+   if err := descTmpl.Execute(&desc, data); err != nil {
+      return "", "", err
+   }
+
+   if !o.keyExpiresAt.IsZero() && !o.skipKey {
+      desc.WriteString(" [expires ")
+      desc.WriteString(o.keyExpiresAt.Format(time.RFC3339))
+      desc.WriteString("]")
+   }
+
+   return name.String(), desc.String(), nil
+}
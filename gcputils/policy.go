@@ -0,0 +1,188 @@
+package gcputils
+
+import (
+   "context"
+   "fmt"
+   "log/slog"
+   "slices"
+   "strings"
+
+   "cloud.google.com/go/iam/apiv1/iampb"
+   "github.com/clintrovert/gobackend/internal/retry"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// conditionalPolicyVersion is the IAM policy version supporting conditional
+// bindings. Policies are read and written at this version so conditions are
+// preserved.
+const conditionalPolicyVersion = 3
+
+// PolicyDelta describes the bindings added to a resource's IAM policy by a
+// single grant.
+type PolicyDelta struct {
+   // Resource is the resource whose policy was modified, e.g.
+   // projects/my-project.
+   Resource string `json:"resource"`
+   // Added lists the members added per role.
+   Added []BindingDelta `json:"added"`
+}
+
+// BindingDelta describes the members added to the binding of one role.
+type BindingDelta struct {
+   Role    string   `json:"role"`
+   Members []string `json:"members"`
+   // NewBinding is true when the binding for Role did not previously exist.
+   NewBinding bool `json:"new_binding"`
+}
+
+// PolicyDiff is a JSON-serializable record of one IAM policy change, e.g.
+// for an audit log. Before and After hold the bindings of the affected roles,
+// sorted by role, as read before the write and as written.
+type PolicyDiff struct {
+   Resource string          `json:"resource"`
+   Before   []PolicyBinding `json:"before"`
+   After    []PolicyBinding `json:"after"`
+   // Added lists the members added per role, as in PolicyDelta.
+   Added []BindingDelta `json:"added"`
+}
+
+// PolicyBinding is the members bound to one role of a policy.
+type PolicyBinding struct {
+   Role    string   `json:"role"`
+   Members []string `json:"members"`
+}
+
+// snapshotBindings copies the bindings of policy for roles, sorted by role.
+// Roles without a binding are omitted.
+func snapshotBindings(policy *iampb.Policy, roles []string) []PolicyBinding {
+   bindings := []PolicyBinding{}
+   for _, binding := range policy.Bindings {
+      if slices.Contains(roles, binding.Role) {
+         bindings = append(bindings, PolicyBinding{
+            Role:    binding.Role,
+            Members: slices.Clone(binding.Members),
+         })
+      }
+   }
+
+   slices.SortFunc(bindings, func(a, b PolicyBinding) int {
+      return strings.Compare(a.Role, b.Role)
+   })
+
+   return bindings
+}
+
+// IsEmpty reports whether the delta contains no changes.
+func (d *PolicyDelta) IsEmpty() bool {
+   return d == nil || len(d.Added) == 0
+}
+
+func (d *PolicyDelta) add(role string, member string, newBinding bool) {
+   for i := range d.Added {
+      if d.Added[i].Role == role {
+         d.Added[i].Members = append(d.Added[i].Members, member)
+         return
+      }
+   }
+
+   d.Added = append(d.Added, BindingDelta{
+      Role:       role,
+      Members:    []string{member},
+      NewBinding: newBinding,
+   })
+}
+
+// RevokePolicyDelta removes exactly the members recorded in delta from the
+// unconditional bindings of the resource's IAM policy, dropping bindings that
+// become empty. Members granted by other means since the delta was produced,
+// and conditional bindings of the same roles, are left untouched. A write
+// lost to a concurrent policy change is retried per WithPolicyConflictRetry,
+// returning ErrPolicyConflict once exhausted.
+func (p *Provisioner) RevokePolicyDelta(
+   ctx context.Context,
+   delta *PolicyDelta,
+) error {
+   if delta.IsEmpty() {
+      return nil
+   }
+
+   // Each attempt refetches the policy, so a conflicting write made by
+   // another client since the last read is preserved.
+   err := retry.DoWhen(ctx, p.conflictRetry, isPolicyConflict, func() error {
+      return p.revokeDelta(ctx, delta)
+   })
+   if err != nil {
+      return err
+   }
+
+   slog.Info("Revoked policy delta", "resource", delta.Resource)
+
+   return nil
+}
+
+// revokeDelta performs one read-modify-write cycle of the IAM policy of the
+// resource of delta, removing its members from the unconditional bindings of
+// their roles. A write rejected because the policy changed since it was read
+// returns ErrPolicyConflict.
+func (p *Provisioner) revokeDelta(
+   ctx context.Context,
+   delta *PolicyDelta,
+) error {
+   getPolicyReq := &iampb.GetIamPolicyRequest{
+      Resource: delta.Resource,
+      Options: &iampb.GetPolicyOptions{
+         RequestedPolicyVersion: conditionalPolicyVersion,
+      },
+   }
+   var policy *iampb.Policy
+   err := retry.Do(ctx, p.callRetry, func() error {
+      var err error
+      policy, err = p.policy.GetIamPolicy(ctx, getPolicyReq)
+      return err
+   })
+   if err != nil {
+      return wrapError("GetIamPolicy", err)
+   }
+
+   bindings := policy.Bindings[:0]
+   for _, binding := range policy.Bindings {
+      if binding.Condition != nil {
+         bindings = append(bindings, binding)
+         continue
+      }
+
+      for _, added := range delta.Added {
+         if binding.Role != added.Role {
+            continue
+         }
+
+         binding.Members = slices.DeleteFunc(
+            binding.Members, func(m string) bool {
+               return slices.Contains(added.Members, m)
+            },
+         )
+      }
+
+      if len(binding.Members) > 0 {
+         bindings = append(bindings, binding)
+      }
+   }
+   policy.Bindings = bindings
+   policy.Version = conditionalPolicyVersion
+
+   _, err = p.policy.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{
+      Resource: delta.Resource,
+      Policy:   policy,
+   })
+   if status.Code(err) == codes.Aborted {
+      return fmt.Errorf(
+         "%w: %w", ErrPolicyConflict, wrapError("SetIamPolicy", err),
+      )
+   }
+   if err != nil {
+      return wrapError("SetIamPolicy", err)
+   }
+
+   return nil
+}
@@ -0,0 +1,272 @@
+package gcputils
+
+import (
+   "context"
+   "encoding/json"
+   "testing"
+
+   "cloud.google.com/go/iam/apiv1/iampb"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/genproto/googleapis/type/expr"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+   "google.golang.org/protobuf/proto"
+)
+
+const testMember = "serviceAccount:" + testEmail
+
+func TestGrantRoles_NewAndMergedBindings_ShouldReturnMatchingDelta(
+   t *testing.T,
+) {
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{
+         Bindings: []*iampb.Binding{
+            {Role: "roles/viewer", Members: []string{"user:a@acme.com"}},
+            {Role: "roles/editor", Members: []string{testMember}},
+         },
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   delta, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/viewer", "roles/editor", "roles/logging.logWriter"},
+   )
+   require.NoError(t, err)
+   assert.Equal(t, &PolicyDelta{
+      Resource: "projects/my-project",
+      Added: []BindingDelta{
+         {Role: "roles/viewer", Members: []string{testMember}},
+         {
+            Role:       "roles/logging.logWriter",
+            Members:    []string{testMember},
+            NewBinding: true,
+         },
+      },
+   }, delta)
+}
+
+func TestGrantRoles_PolicyDiff_ShouldMatchAppliedChange(t *testing.T) {
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{
+         Bindings: []*iampb.Binding{
+            {Role: "roles/owner", Members: []string{"user:root@acme.com"}},
+            {Role: "roles/viewer", Members: []string{"user:a@acme.com"}},
+         },
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   var diff *PolicyDiff
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/viewer", "roles/logging.logWriter"},
+      WithPolicyDiff(func(d *PolicyDiff) { diff = d }),
+   )
+   require.NoError(t, err)
+   require.NotNil(t, diff)
+
+   got, err := json.Marshal(diff)
+   require.NoError(t, err)
+   assert.JSONEq(t, `{
+      "resource": "projects/my-project",
+      "before": [
+         {"role": "roles/viewer", "members": ["user:a@acme.com"]}
+      ],
+      "after": [
+         {"role": "roles/logging.logWriter", "members": ["`+testMember+`"]},
+         {
+            "role": "roles/viewer",
+            "members": ["user:a@acme.com", "`+testMember+`"]
+         }
+      ],
+      "added": [
+         {
+            "role": "roles/viewer",
+            "members": ["`+testMember+`"],
+            "new_binding": false
+         },
+         {
+            "role": "roles/logging.logWriter",
+            "members": ["`+testMember+`"],
+            "new_binding": true
+         }
+      ]
+   }`, string(got))
+}
+
+func TestGrantRoles_PolicyDiffWriteFails_ShouldNotEmit(t *testing.T) {
+   policy := &fakePolicyClient{
+      setPolicyErr: status.Error(codes.PermissionDenied, "denied"),
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   emitted := false
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/viewer"},
+      WithPolicyDiff(func(*PolicyDiff) { emitted = true }),
+   )
+   assert.Error(t, err)
+   assert.False(t, emitted)
+}
+
+func TestRevokePolicyDelta_AfterGrant_ShouldRestoreOriginalBindings(
+   t *testing.T,
+) {
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{
+         Bindings: []*iampb.Binding{
+            {Role: "roles/viewer", Members: []string{"user:a@acme.com"}},
+            {Role: "roles/editor", Members: []string{testMember}},
+         },
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   delta, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/viewer", "roles/editor", "roles/logging.logWriter"},
+   )
+   require.NoError(t, err)
+
+   err = p.RevokePolicyDelta(context.Background(), delta)
+   require.NoError(t, err)
+   assert.Equal(t, []*iampb.Binding{
+      {Role: "roles/viewer", Members: []string{"user:a@acme.com"}},
+      {Role: "roles/editor", Members: []string{testMember}},
+   }, policy.policy.Bindings)
+}
+
+func TestRevokePolicyDelta_ConditionalBinding_ShouldKeepIt(t *testing.T) {
+   condition := &expr.Expr{
+      Title:      "business-hours",
+      Expression: "request.time.getHours('UTC') < 18",
+   }
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{
+         Version: 3,
+         Bindings: []*iampb.Binding{
+            {
+               Role:      "roles/viewer",
+               Members:   []string{testMember},
+               Condition: condition,
+            },
+            {Role: "roles/viewer", Members: []string{testMember}},
+         },
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   err := p.RevokePolicyDelta(context.Background(), &PolicyDelta{
+      Resource: "projects/my-project",
+      Added: []BindingDelta{
+         {Role: "roles/viewer", Members: []string{testMember}},
+      },
+   })
+   require.NoError(t, err)
+   require.Len(t, policy.policy.Bindings, 1)
+   assert.Equal(t, []string{testMember}, policy.policy.Bindings[0].Members)
+   assert.True(t,
+      proto.Equal(condition, policy.policy.Bindings[0].Condition),
+   )
+}
+
+func TestRevokePolicyDelta_PolicyConflictOnce_ShouldRefetchAndSucceed(
+   t *testing.T,
+) {
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{Bindings: []*iampb.Binding{
+         {Role: "roles/viewer", Members: []string{testMember}},
+      }},
+      setPolicyErrs: []error{
+         status.Error(codes.Aborted, "concurrent policy changes"),
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+   WithPolicyConflictRetry(fastRetry)(p)
+
+   err := p.RevokePolicyDelta(context.Background(), &PolicyDelta{
+      Resource: "projects/my-project",
+      Added: []BindingDelta{
+         {Role: "roles/viewer", Members: []string{testMember}},
+      },
+   })
+   assert.NoError(t, err)
+   assert.Equal(t, 2, policy.getPolicyCalls)
+   assert.Equal(t, 2, policy.setPolicyCalls)
+   assert.Empty(t, policy.policy.Bindings)
+}
+
+func TestRevokePolicyDelta_PolicyConflictPersists_ShouldReturnErrPolicyConflict(
+   t *testing.T,
+) {
+   policy := &fakePolicyClient{
+      setPolicyErr: status.Error(codes.Aborted, "concurrent policy changes"),
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+   WithPolicyConflictRetry(fastRetry)(p)
+
+   err := p.RevokePolicyDelta(context.Background(), &PolicyDelta{
+      Resource: "projects/my-project",
+      Added: []BindingDelta{
+         {Role: "roles/viewer", Members: []string{testMember}},
+      },
+   })
+   assert.ErrorIs(t, err, ErrPolicyConflict)
+   assert.Equal(t, codes.Aborted, status.Code(err))
+   assert.Equal(t, fastRetry.MaxAttempts, policy.setPolicyCalls)
+}
+
+func TestGrantRoles_ConditionalBinding_ShouldAddUnconditionalBinding(
+   t *testing.T,
+) {
+   condition := &expr.Expr{
+      Title:      "business-hours",
+      Expression: "request.time.getHours('UTC') < 18",
+   }
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{
+         Version: 3,
+         Bindings: []*iampb.Binding{{
+            Role:      "roles/viewer",
+            Members:   []string{"user:a@acme.com"},
+            Condition: condition,
+         }},
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   delta, err := p.GrantRolesToServiceAccount(
+      context.Background(), "my-project", testEmail, []string{"roles/viewer"},
+   )
+   require.NoError(t, err)
+   assert.Equal(t, []BindingDelta{{
+      Role:       "roles/viewer",
+      Members:    []string{testMember},
+      NewBinding: true,
+   }}, delta.Added)
+
+   assert.Equal(t, int32(3),
+      policy.getPolicyReq.GetOptions().GetRequestedPolicyVersion(),
+   )
+   assert.Equal(t, int32(3), policy.policy.Version)
+   require.Len(t, policy.policy.Bindings, 2)
+   assert.Equal(t, []string{"user:a@acme.com"},
+      policy.policy.Bindings[0].Members,
+   )
+   assert.True(t,
+      proto.Equal(condition, policy.policy.Bindings[0].Condition),
+   )
+   assert.Equal(t, []string{testMember}, policy.policy.Bindings[1].Members)
+   assert.Nil(t, policy.policy.Bindings[1].Condition)
+}
@@ -0,0 +1,102 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "net/http"
+   "sync"
+
+   "google.golang.org/api/cloudresourcemanager/v3"
+   "google.golang.org/api/googleapi"
+)
+
+// ErrProjectNotFound indicates the project does not exist, is not visible to
+// the caller, or is not ACTIVE, e.g. because its deletion was requested.
+var ErrProjectNotFound = errors.New("gcputils, project not found")
+
+// projectActive is the Resource Manager lifecycle state of a usable project.
+const projectActive = "ACTIVE"
+
+// projectsClient is the subset of the Resource Manager API used by
+// Provisioner.
+type projectsClient interface {
+   GetProject(
+      ctx context.Context,
+      name string,
+   ) (*cloudresourcemanager.Project, error)
+}
+
+// resourceManagerClient adapts the Resource Manager service to
+// projectsClient. The service is created on the first call, so Provisioners
+// that never validate a project never create it; a failed creation is
+// attempted again on the next call.
+type resourceManagerClient struct {
+   mu  sync.Mutex
+   svc *cloudresourcemanager.Service
+}
+
+func (c *resourceManagerClient) GetProject(
+   ctx context.Context,
+   name string,
+) (*cloudresourcemanager.Project, error) {
+   svc, err := c.service(ctx)
+   if err != nil {
+      return nil, err
+   }
+
+   return svc.Projects.Get(name).Context(ctx).Do()
+}
+
+// service returns the Resource Manager service, creating it on first use.
+// The service outlives the call creating it, so it is not bound to the
+// cancellation of ctx.
+func (c *resourceManagerClient) service(
+   ctx context.Context,
+) (*cloudresourcemanager.Service, error) {
+   c.mu.Lock()
+   defer c.mu.Unlock()
+
+   if c.svc == nil {
+      svc, err := cloudresourcemanager.NewService(context.WithoutCancel(ctx))
+      if err != nil {
+         return nil, fmt.Errorf("cloudresourcemanager.NewService: %w", err)
+      }
+      c.svc = svc
+   }
+
+   return c.svc, nil
+}
+
+// validateProject confirms the project exists and is ACTIVE, returning
+// ErrProjectNotFound otherwise. Resource Manager reports projects the caller
+// cannot see as permission denied rather than not found, so both map to
+// ErrProjectNotFound.
+func (p *Provisioner) validateProject(
+   ctx context.Context,
+   projectID string,
+) error {
+   project, err := p.projects.GetProject(ctx, "projects/"+projectID)
+   if err != nil {
+      var apiErr *googleapi.Error
+      if errors.As(err, &apiErr) &&
+         (apiErr.Code == http.StatusNotFound ||
+            apiErr.Code == http.StatusForbidden) {
+         return fmt.Errorf(
+            "project '%s' does not exist or is not accessible; %w",
+            projectID, ErrProjectNotFound,
+         )
+      }
+
+      return fmt.Errorf("GetProject: %w", err)
+   }
+
+   if project.State != projectActive {
+      return fmt.Errorf(
+         "project '%s' is in state %s; %w",
+         projectID, project.State, ErrProjectNotFound,
+      )
+   }
+
+   return nil
+}
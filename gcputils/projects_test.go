@@ -0,0 +1,118 @@
+package gcputils
+
+import (
+   "context"
+   "net/http"
+   "testing"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/api/cloudresourcemanager/v3"
+   "google.golang.org/api/googleapi"
+)
+
+// newValidatingProvisioner returns a Provisioner whose projects client
+// answers GetProject with getProject and reports whether an account was
+// created.
+func newValidatingProvisioner(
+   getProject func(string) (*cloudresourcemanager.Project, error),
+   created *bool,
+) *Provisioner {
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         *created = true
+         return &iamadminpb.ServiceAccount{Email: testEmail}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   p.projects = &fakeProjectsClient{getProject: getProject}
+
+   return p
+}
+
+func TestNewM2MServiceAccount_ActiveProject_ShouldCreateAccount(
+   t *testing.T,
+) {
+   var name string
+   created := false
+   p := newValidatingProvisioner(
+      func(n string) (*cloudresourcemanager.Project, error) {
+         name = n
+         return &cloudresourcemanager.Project{State: "ACTIVE"}, nil
+      },
+      &created,
+   )
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+      WithGenerateKey(false), WithProjectValidation(),
+   )
+   assert.NoError(t, err)
+   assert.True(t, created)
+   assert.Equal(t, "projects/my-project", name)
+}
+
+func TestNewM2MServiceAccount_MissingProject_ShouldReturnErrProjectNotFound(
+   t *testing.T,
+) {
+   for _, code := range []int{http.StatusNotFound, http.StatusForbidden} {
+      created := false
+      p := newValidatingProvisioner(
+         func(string) (*cloudresourcemanager.Project, error) {
+            return nil, &googleapi.Error{Code: code}
+         },
+         &created,
+      )
+
+      _, err := p.NewM2MServiceAccount(
+         context.Background(), "my-project", "acme-client", "Acme Client",
+         WithProjectValidation(),
+      )
+      assert.ErrorIs(t, err, ErrProjectNotFound)
+      assert.False(t, created)
+   }
+}
+
+func TestNewM2MServiceAccount_DeleteRequested_ShouldReturnErrProjectNotFound(
+   t *testing.T,
+) {
+   created := false
+   p := newValidatingProvisioner(
+      func(string) (*cloudresourcemanager.Project, error) {
+         return &cloudresourcemanager.Project{
+            State: "DELETE_REQUESTED",
+         }, nil
+      },
+      &created,
+   )
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+      WithProjectValidation(),
+   )
+   assert.ErrorIs(t, err, ErrProjectNotFound)
+   assert.ErrorContains(t, err, "DELETE_REQUESTED")
+   assert.False(t, created)
+}
+
+func TestNewM2MServiceAccount_ValidationDisabled_ShouldNotGetProject(
+   t *testing.T,
+) {
+   created := false
+   p := newValidatingProvisioner(
+      func(string) (*cloudresourcemanager.Project, error) {
+         t.Fatal("GetProject called without WithProjectValidation")
+         return nil, nil
+      },
+      &created,
+   )
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+      WithGenerateKey(false),
+   )
+   assert.NoError(t, err)
+   assert.True(t, created)
+}
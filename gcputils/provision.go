@@ -0,0 +1,234 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+)
+
+// ErrInvalidRequest indicates a ProvisionRequest names a malformed project or
+// client ID.
+var ErrInvalidRequest = errors.New("gcputils, invalid provision request")
+
+// ProvisionStage names a step of ProvisionClient.
+type ProvisionStage string
+
+const (
+   // StageValidate checks the request and that every role exists.
+   StageValidate ProvisionStage = "validate"
+   // StageProject confirms the project exists and is ACTIVE, with
+   // WithProjectValidation.
+   StageProject ProvisionStage = "project"
+   // StageCreateAccount creates the service account.
+   StageCreateAccount ProvisionStage = "create_account"
+   // StageLabel writes the labels into the account description.
+   StageLabel ProvisionStage = "label"
+   // StageGenerateKey creates the account key.
+   StageGenerateKey ProvisionStage = "generate_key"
+   // StageWaitReady waits for the account to propagate.
+   StageWaitReady ProvisionStage = "wait_ready"
+   // StageGrantRoles grants the project-level roles.
+   StageGrantRoles ProvisionStage = "grant_roles"
+)
+
+// ProvisionRequest describes a client to onboard with ProvisionClient.
+type ProvisionRequest struct {
+   // ProjectID is the project hosting the service account.
+   ProjectID string
+   // ClientID is the service account ID.
+   ClientID string
+   // DisplayName is rendered into the account display name.
+   DisplayName string
+   // Roles are granted on the project; none skips the grant.
+   Roles []string
+   // Labels are recorded on the account, overriding any WithLabels option.
+   Labels map[string]string
+   // Options configure the account as for NewM2MServiceAccount.
+   Options []M2MOption
+}
+
+// ProvisionError is returned by ProvisionClient when a stage fails. It
+// records how far provisioning got and whether the account created along the
+// way was deleted again. errors.Is matches the error of the failed stage.
+type ProvisionError struct {
+   // Stage is the stage that failed.
+   Stage ProvisionStage
+   // Completed lists the stages that succeeded, in order.
+   Completed []ProvisionStage
+   // Email is the account created before the failure, empty if none was.
+   Email string
+   // RolledBack reports whether the created account was deleted.
+   RolledBack bool
+   // RollbackErr is the error deleting the account, leaving it behind.
+   RollbackErr error
+   // Err is the error of the failed stage.
+   Err error
+}
+
+// Error returns the failed stage and its error, along with any rollback
+// failure.
+func (e *ProvisionError) Error() string {
+   msg := fmt.Sprintf("provision stage %s: %s", e.Stage, e.Err.Error())
+   if e.RollbackErr != nil {
+      msg += fmt.Sprintf("; rollback of account '%s' failed: %s",
+         e.Email, e.RollbackErr.Error(),
+      )
+   }
+
+   return msg
+}
+
+// Unwrap returns the error of the failed stage.
+func (e *ProvisionError) Unwrap() error {
+   return e.Err
+}
+
+// ProvisionClient onboards a client using a short-lived Provisioner.
+func ProvisionClient(
+   ctx context.Context,
+   req ProvisionRequest,
+) (*M2MServiceAccount, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.ProvisionClient(ctx, req)
+}
+
+// ProvisionClient onboards a client end to end: it validates the request
+// and roles, confirms the project when the options include
+// WithProjectValidation, creates and labels the service account, generates
+// its key, waits for it to propagate and grants it the roles. The account is
+// created as by NewM2MServiceAccount with the same options.
+// Labels are applied before roles are granted so a failure never leaves
+// bindings behind. When a stage after creation fails, the account is deleted
+// again. Failures are returned as a *ProvisionError.
+func (p *Provisioner) ProvisionClient(
+   ctx context.Context,
+   req ProvisionRequest,
+) (*M2MServiceAccount, error) {
+   opts := req.Options
+   if req.Labels != nil {
+      opts = append(opts[:len(opts):len(opts)], WithLabels(req.Labels))
+   }
+   o := newM2MOptions(opts)
+
+   prog := &ProvisionError{}
+   fail := func(stage ProvisionStage, err error) error {
+      prog.Stage = stage
+      prog.Err = err
+      return prog
+   }
+   done := func(stage ProvisionStage) {
+      prog.Completed = append(prog.Completed, stage)
+   }
+
+   saRequest, labelledDescription, err := p.validateProvisionRequest(
+      ctx, req, o,
+   )
+   if err != nil {
+      return nil, fail(StageValidate, err)
+   }
+   done(StageValidate)
+
+   createdSA, generatedKey, stage, err := p.createM2MAccount(
+      ctx, req.ProjectID, saRequest, labelledDescription, o, done,
+   )
+   if createdSA == nil && err != nil {
+      return nil, fail(stage, err)
+   }
+   prog.Email = createdSA.Email
+
+   rollback := func(stage ProvisionStage, err error) error {
+      prog.RollbackErr = p.rollbackServiceAccount(ctx, createdSA)
+      prog.RolledBack = prog.RollbackErr == nil
+      return fail(stage, err)
+   }
+
+   if err != nil {
+      return nil, rollback(stage, err)
+   }
+
+   if len(req.Roles) > 0 {
+      err = p.WaitServiceAccountReady(
+         ctx, req.ProjectID, createdSA.Email, defaultReadyTimeout,
+      )
+      if err != nil {
+         return nil, rollback(StageWaitReady, err)
+      }
+      done(StageWaitReady)
+
+      _, err = p.GrantRolesToServiceAccount(
+         ctx, req.ProjectID, createdSA.Email, req.Roles,
+      )
+      if err != nil {
+         return nil, rollback(StageGrantRoles, err)
+      }
+      done(StageGrantRoles)
+   }
+
+   slog.Info("Client provisioned",
+      "email", createdSA.Email,
+      "roles", len(req.Roles),
+   )
+
+   return o.newM2MServiceAccount(createdSA, req.ClientID, generatedKey), nil
+}
+
+// validateProvisionRequest checks the project and client IDs follow the GCP
+// naming rules and that every role exists, then renders the account request
+// and its labelled description.
+func (p *Provisioner) validateProvisionRequest(
+   ctx context.Context,
+   req ProvisionRequest,
+   o m2mOptions,
+) (*iamadminpb.CreateServiceAccountRequest, string, error) {
+   if !projectIDPattern.MatchString(req.ProjectID) {
+      errMsg := fmt.Sprintf("project ID '%s' is malformed", req.ProjectID)
+      return nil, "", fmt.Errorf("%s; %w", errMsg, ErrInvalidRequest)
+   }
+
+   if !accountIDPattern.MatchString(req.ClientID) {
+      errMsg := fmt.Sprintf("client ID '%s' is malformed", req.ClientID)
+      return nil, "", fmt.Errorf("%s; %w", errMsg, ErrInvalidRequest)
+   }
+
+   saRequest, labelledDescription, err := o.accountRequest(
+      req.ProjectID, req.ClientID, req.DisplayName,
+   )
+   if err != nil {
+      return nil, "", err
+   }
+
+   if len(req.Roles) > 0 {
+      if err := p.validateRoles(ctx, req.Roles); err != nil {
+         return nil, "", err
+      }
+   }
+
+   return saRequest, labelledDescription, nil
+}
+
+// rollbackServiceAccount deletes an account created earlier in a failed
+// ProvisionClient, returning the error so it can be reported. Like
+// cleanupServiceAccount it ignores the cancellation of ctx.
+func (p *Provisioner) rollbackServiceAccount(
+   ctx context.Context,
+   sa *iamadminpb.ServiceAccount,
+) error {
+   slog.Warn("Rolling back service account", "account", sa.Email)
+   err := p.admin.DeleteServiceAccount(
+      context.WithoutCancel(ctx),
+      &iamadminpb.DeleteServiceAccountRequest{Name: sa.Name},
+   )
+   if err != nil {
+      return wrapError("DeleteServiceAccount", err)
+   }
+
+   return nil
+}
@@ -0,0 +1,308 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "testing"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/api/cloudresourcemanager/v3"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const testAccountName = "projects/my-project/serviceAccounts/" + testEmail
+
+// provisionFakes holds the fakes behind a ProvisionClient test along with
+// the account deletions they observed.
+type provisionFakes struct {
+   admin    *fakeAdminClient
+   policy   *fakePolicyClient
+   projects *fakeProjectsClient
+   deleted  []string
+}
+
+func newProvisionFakes() *provisionFakes {
+   f := &provisionFakes{
+      policy:   &fakePolicyClient{},
+      projects: &fakeProjectsClient{},
+   }
+
+   var req *iamadminpb.CreateServiceAccountRequest
+   f.admin = &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            Name:           testAccountName + "/keys/key-1",
+            PrivateKeyData: []byte("private-key"),
+         }, nil
+      },
+      deleteServiceAccount: func(
+         r *iamadminpb.DeleteServiceAccountRequest,
+      ) error {
+         f.deleted = append(f.deleted, r.Name)
+         return nil
+      },
+      getRole: knownRoles("roles/viewer"),
+   }
+
+   return f
+}
+
+func (f *provisionFakes) provisioner() *Provisioner {
+   p := newProvisioner(f.admin, f.policy)
+   p.projects = f.projects
+   WithRetryPolicy(fastRetry)(p)
+
+   return p
+}
+
+func testProvisionRequest() ProvisionRequest {
+   return ProvisionRequest{
+      ProjectID:   "my-project",
+      ClientID:    "acme-client",
+      DisplayName: "Acme Client",
+      Roles:       []string{"roles/viewer"},
+      Labels:      map[string]string{"team": "core"},
+      Options:     []M2MOption{WithProjectValidation()},
+   }
+}
+
+func TestProvisionClient_AllStagesSucceed_ShouldReturnAccount(t *testing.T) {
+   var patch *iamadminpb.PatchServiceAccountRequest
+   f := newProvisionFakes()
+   f.admin.patchServiceAccount = func(
+      r *iamadminpb.PatchServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error) {
+      patch = r
+      return r.ServiceAccount, nil
+   }
+
+   sa, err := f.provisioner().ProvisionClient(
+      context.Background(), testProvisionRequest(),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, testEmail, sa.Email)
+   assert.Equal(t, "private-key", sa.PrivateKey)
+   assert.Equal(t, testAccountName+"/keys/key-1", sa.KeyName)
+   assert.Equal(t, testAccountName, sa.ServiceAccountName)
+   assert.Equal(t, map[string]string{"team": "core"}, sa.Labels)
+   if assert.NotNil(t, patch) {
+      assert.Equal(t,
+         "M2M client SA for acme-client {team=core}",
+         patch.ServiceAccount.Description,
+      )
+   }
+   if assert.Len(t, f.policy.policy.Bindings, 1) {
+      assert.Equal(t, "roles/viewer", f.policy.policy.Bindings[0].Role)
+      assert.Equal(t,
+         []string{"serviceAccount:" + testEmail},
+         f.policy.policy.Bindings[0].Members,
+      )
+   }
+   assert.Empty(t, f.deleted)
+}
+
+func TestProvisionClient_WithoutProjectValidation_ShouldSkipProject(
+   t *testing.T,
+) {
+   looked := false
+   f := newProvisionFakes()
+   f.projects.getProject = func(
+      string,
+   ) (*cloudresourcemanager.Project, error) {
+      looked = true
+      return nil, errors.New("unexpected project lookup")
+   }
+   req := testProvisionRequest()
+   req.Options = nil
+
+   sa, err := f.provisioner().ProvisionClient(context.Background(), req)
+   assert.NoError(t, err)
+   assert.Equal(t, testEmail, sa.Email)
+   assert.False(t, looked)
+}
+
+func TestProvisionClient_StageFails_ShouldRollBack(t *testing.T) {
+   denied := status.Error(codes.PermissionDenied, "denied")
+   tests := []struct {
+      name       string
+      req        func(*ProvisionRequest)
+      setup      func(*provisionFakes)
+      stage      ProvisionStage
+      completed  []ProvisionStage
+      wantErr    error
+      rolledBack bool
+   }{
+      {
+         name:    "malformed client id",
+         req:     func(r *ProvisionRequest) { r.ClientID = "Acme" },
+         stage:   StageValidate,
+         wantErr: ErrInvalidRequest,
+      },
+      {
+         name: "invalid labels",
+         req: func(r *ProvisionRequest) {
+            r.Labels = map[string]string{"A": ""}
+         },
+         stage:   StageValidate,
+         wantErr: ErrInvalidLabels,
+      },
+      {
+         name: "unknown role",
+         req: func(r *ProvisionRequest) {
+            r.Roles = []string{"roles/nope"}
+         },
+         stage:   StageValidate,
+         wantErr: ErrUnknownRole,
+      },
+      {
+         name: "project not found",
+         setup: func(f *provisionFakes) {
+            f.projects.getProject = func(
+               string,
+            ) (*cloudresourcemanager.Project, error) {
+               return &cloudresourcemanager.Project{
+                  State: "DELETE_REQUESTED",
+               }, nil
+            }
+         },
+         stage:     StageProject,
+         completed: []ProvisionStage{StageValidate},
+         wantErr:   ErrProjectNotFound,
+      },
+      {
+         name: "create account",
+         setup: func(f *provisionFakes) {
+            f.admin.createServiceAccount = func(
+               *iamadminpb.CreateServiceAccountRequest,
+            ) (*iamadminpb.ServiceAccount, error) {
+               return nil, denied
+            }
+         },
+         stage:     StageCreateAccount,
+         completed: []ProvisionStage{StageValidate, StageProject},
+         wantErr:   ErrPermissionDenied,
+      },
+      {
+         name: "label",
+         setup: func(f *provisionFakes) {
+            f.admin.patchServiceAccount = func(
+               *iamadminpb.PatchServiceAccountRequest,
+            ) (*iamadminpb.ServiceAccount, error) {
+               return nil, denied
+            }
+         },
+         stage: StageLabel,
+         completed: []ProvisionStage{
+            StageValidate, StageProject, StageCreateAccount,
+         },
+         wantErr:    ErrPermissionDenied,
+         rolledBack: true,
+      },
+      {
+         name: "generate key",
+         setup: func(f *provisionFakes) {
+            f.admin.createServiceAccountKey = func(
+               *iamadminpb.CreateServiceAccountKeyRequest,
+            ) (*iamadminpb.ServiceAccountKey, error) {
+               return nil, status.Error(codes.ResourceExhausted, "quota")
+            }
+         },
+         stage: StageGenerateKey,
+         completed: []ProvisionStage{
+            StageValidate, StageProject, StageCreateAccount, StageLabel,
+         },
+         wantErr:    ErrQuotaExceeded,
+         rolledBack: true,
+      },
+      {
+         name: "wait ready",
+         setup: func(f *provisionFakes) {
+            f.admin.getServiceAccount = func(
+               *iamadminpb.GetServiceAccountRequest,
+            ) (*iamadminpb.ServiceAccount, error) {
+               return nil, denied
+            }
+         },
+         stage: StageWaitReady,
+         completed: []ProvisionStage{
+            StageValidate, StageProject, StageCreateAccount, StageLabel,
+            StageGenerateKey,
+         },
+         wantErr:    ErrPermissionDenied,
+         rolledBack: true,
+      },
+      {
+         name: "grant roles",
+         setup: func(f *provisionFakes) {
+            f.policy.setPolicyErr = denied
+         },
+         stage: StageGrantRoles,
+         completed: []ProvisionStage{
+            StageValidate, StageProject, StageCreateAccount, StageLabel,
+            StageGenerateKey, StageWaitReady,
+         },
+         wantErr:    ErrPermissionDenied,
+         rolledBack: true,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         f := newProvisionFakes()
+         if tt.setup != nil {
+            tt.setup(f)
+         }
+         req := testProvisionRequest()
+         if tt.req != nil {
+            tt.req(&req)
+         }
+
+         sa, err := f.provisioner().ProvisionClient(context.Background(), req)
+         assert.Nil(t, sa)
+         assert.ErrorIs(t, err, tt.wantErr)
+
+         var provErr *ProvisionError
+         if !assert.True(t, errors.As(err, &provErr)) {
+            return
+         }
+         assert.Equal(t, tt.stage, provErr.Stage)
+         assert.Equal(t, tt.completed, provErr.Completed)
+         assert.Equal(t, tt.rolledBack, provErr.RolledBack)
+         assert.NoError(t, provErr.RollbackErr)
+         if tt.rolledBack {
+            assert.Equal(t, testEmail, provErr.Email)
+            assert.Equal(t, []string{testAccountName}, f.deleted)
+         } else {
+            assert.Empty(t, f.deleted)
+         }
+      })
+   }
+}
+
+func TestProvisionClient_RollbackFails_ShouldReportAccount(t *testing.T) {
+   f := newProvisionFakes()
+   f.policy.setPolicyErr = status.Error(codes.PermissionDenied, "denied")
+   f.admin.deleteServiceAccount = func(
+      *iamadminpb.DeleteServiceAccountRequest,
+   ) error {
+      return status.Error(codes.Internal, "boom")
+   }
+
+   _, err := f.provisioner().ProvisionClient(
+      context.Background(), testProvisionRequest(),
+   )
+   var provErr *ProvisionError
+   if assert.True(t, errors.As(err, &provErr)) {
+      assert.Equal(t, StageGrantRoles, provErr.Stage)
+      assert.False(t, provErr.RolledBack)
+      assert.Error(t, provErr.RollbackErr)
+      assert.Equal(t, testEmail, provErr.Email)
+   }
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   assert.Contains(t, err.Error(), "rollback of account '"+testEmail+"'")
+}
@@ -0,0 +1,276 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "time"
+
+   iamadmin "cloud.google.com/go/iam/admin/apiv1"
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   iampolicy "cloud.google.com/go/iam/apiv1"
+   "cloud.google.com/go/iam/apiv1/iampb"
+   "github.com/clintrovert/gobackend/internal/retry"
+   "github.com/googleapis/gax-go/v2"
+   "golang.org/x/time/rate"
+   "google.golang.org/api/iterator"
+)
+
+// iamAdminClient is the subset of the IAM admin API used by Provisioner.
+type iamAdminClient interface {
+   CreateServiceAccount(
+      ctx context.Context,
+      req *iamadminpb.CreateServiceAccountRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.ServiceAccount, error)
+   GetServiceAccount(
+      ctx context.Context,
+      req *iamadminpb.GetServiceAccountRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.ServiceAccount, error)
+   // ListAllServiceAccounts drains the ListServiceAccounts iterator of the
+   // project resource name.
+   ListAllServiceAccounts(
+      ctx context.Context,
+      name string,
+   ) ([]*iamadminpb.ServiceAccount, error)
+   PatchServiceAccount(
+      ctx context.Context,
+      req *iamadminpb.PatchServiceAccountRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.ServiceAccount, error)
+   CreateServiceAccountKey(
+      ctx context.Context,
+      req *iamadminpb.CreateServiceAccountKeyRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.ServiceAccountKey, error)
+   DeleteServiceAccount(
+      ctx context.Context,
+      req *iamadminpb.DeleteServiceAccountRequest,
+      opts ...gax.CallOption,
+   ) error
+   ListServiceAccountKeys(
+      ctx context.Context,
+      req *iamadminpb.ListServiceAccountKeysRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.ListServiceAccountKeysResponse, error)
+   GetServiceAccountKey(
+      ctx context.Context,
+      req *iamadminpb.GetServiceAccountKeyRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.ServiceAccountKey, error)
+   DeleteServiceAccountKey(
+      ctx context.Context,
+      req *iamadminpb.DeleteServiceAccountKeyRequest,
+      opts ...gax.CallOption,
+   ) error
+   CreateRole(
+      ctx context.Context,
+      req *iamadminpb.CreateRoleRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.Role, error)
+   GetRole(
+      ctx context.Context,
+      req *iamadminpb.GetRoleRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.Role, error)
+   QueryGrantableRoles(
+      ctx context.Context,
+      req *iamadminpb.QueryGrantableRolesRequest,
+      opts ...gax.CallOption,
+   ) (*iamadminpb.QueryGrantableRolesResponse, error)
+   Close() error
+}
+
+// adminClient adapts the IAM admin client to iamAdminClient.
+type adminClient struct {
+   *iamadmin.IamClient
+}
+
+func (c adminClient) ListAllServiceAccounts(
+   ctx context.Context,
+   name string,
+) ([]*iamadminpb.ServiceAccount, error) {
+   it := c.ListServiceAccounts(ctx, &iamadminpb.ListServiceAccountsRequest{
+      Name:     name,
+      PageSize: 100,
+   })
+
+   var accounts []*iamadminpb.ServiceAccount
+   for {
+      sa, err := it.Next()
+      if errors.Is(err, iterator.Done) {
+         return accounts, nil
+      }
+      if err != nil {
+         return nil, err
+      }
+
+      accounts = append(accounts, sa)
+   }
+}
+
+// iamPolicyClient is the subset of the IAM policy API used by Provisioner.
+type iamPolicyClient interface {
+   GetIamPolicy(
+      ctx context.Context,
+      req *iampb.GetIamPolicyRequest,
+      opts ...gax.CallOption,
+   ) (*iampb.Policy, error)
+   SetIamPolicy(
+      ctx context.Context,
+      req *iampb.SetIamPolicyRequest,
+      opts ...gax.CallOption,
+   ) (*iampb.Policy, error)
+   Close() error
+}
+
+// Provisioner holds long-lived IAM clients so that repeated provisioning
+// calls share connections. A Provisioner must be closed once it is no longer
+// needed.
+type Provisioner struct {
+   admin    iamAdminClient
+   policy   iamPolicyClient
+   projects projectsClient
+
+   // readyInitialBackoff and readyMaxBackoff bound the polling interval of
+   // WaitServiceAccountReady.
+   readyInitialBackoff time.Duration
+   readyMaxBackoff     time.Duration
+
+   // keyRetry controls retries of key creation on quota exhaustion.
+   keyRetry RetryPolicy
+
+   // callRetry controls retries of calls failing with transient errors.
+   callRetry RetryPolicy
+   // conflictRetry controls retries of IAM policy updates lost to a
+   // concurrent modification.
+   conflictRetry RetryPolicy
+
+   // batchConcurrency and batchLimiter bound the items of batch operations
+   // in flight and started per second.
+   batchConcurrency int
+   batchLimiter     *rate.Limiter
+}
+
+// ProvisionerOption configures a Provisioner.
+type ProvisionerOption func(*Provisioner)
+
+// RetryPolicy controls how calls failing with a transient gRPC status, such
+// as Unavailable, are retried. Waits are jittered.
+type RetryPolicy = retry.Policy
+
+// WithRetryPolicy replaces the policy used to retry transient failures of
+// account creation and IAM policy reads. The default makes three attempts;
+// a MaxAttempts below 2 disables retries.
+func WithRetryPolicy(policy RetryPolicy) ProvisionerOption {
+   return func(p *Provisioner) {
+      p.callRetry = policy
+   }
+}
+
+// WithPolicyConflictRetry replaces the policy used to retry IAM policy
+// updates that lose to a concurrent modification. Each retry repeats the
+// whole read-modify-write cycle on a freshly read policy; once exhausted
+// ErrPolicyConflict is returned. The default makes three attempts; a
+// MaxAttempts below 2 disables retries.
+func WithPolicyConflictRetry(policy RetryPolicy) ProvisionerOption {
+   return func(p *Provisioner) {
+      p.conflictRetry = policy
+   }
+}
+
+// WithKeyQuotaRetry retries key creation per policy when GCP reports the key
+// quota as exhausted. Deleted keys can take a moment to stop counting
+// towards the quota, so a short wait is often enough. By default key
+// creation is not retried.
+func WithKeyQuotaRetry(policy RetryPolicy) ProvisionerOption {
+   return func(p *Provisioner) {
+      p.keyRetry = policy
+   }
+}
+
+// WithBatchConcurrency processes up to n items of NewM2MServiceAccounts and
+// PruneExpiredKeys concurrently. The default of 1 processes items one at a
+// time; values below 1 keep the default.
+func WithBatchConcurrency(n int) ProvisionerOption {
+   return func(p *Provisioner) {
+      if n > 0 {
+         p.batchConcurrency = n
+      }
+   }
+}
+
+// WithBatchRateLimit starts at most perSecond items of NewM2MServiceAccounts
+// and PruneExpiredKeys per second, allowing bursts of up to burst items, so
+// large batches stay within the IAM API quotas. An item is an account, which
+// may take several calls. The limit is shared by every batch operation of the
+// Provisioner. By default the rate is unlimited; a perSecond of 0 or less
+// keeps it so.
+func WithBatchRateLimit(perSecond float64, burst int) ProvisionerOption {
+   return func(p *Provisioner) {
+      if perSecond > 0 {
+         p.batchLimiter = rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+      }
+   }
+}
+
+// NewProvisioner creates a new instance of Provisioner with connected IAM
+// admin and IAM policy clients. The Resource Manager client behind
+// WithProjectValidation is only created on the first project lookup.
+func NewProvisioner(
+   ctx context.Context,
+   opts ...ProvisionerOption,
+) (*Provisioner, error) {
+   admin, err := iamadmin.NewIamClient(ctx)
+   if err != nil {
+      return nil, fmt.Errorf("iamadmin.NewIamClient: %w", err)
+   }
+
+   policyClient, err := iampolicy.NewIamPolicyClient(ctx)
+   if err != nil {
+      _ = admin.Close()
+      return nil, fmt.Errorf("iampolicy.NewIamPolicyClient: %w", err)
+   }
+
+   p := newProvisioner(adminClient{IamClient: admin}, policyClient)
+   p.projects = &resourceManagerClient{}
+   for _, opt := range opts {
+      opt(p)
+   }
+
+   return p, nil
+}
+
+func newProvisioner(
+   admin iamAdminClient,
+   policy iamPolicyClient,
+) *Provisioner {
+   return &Provisioner{
+      admin:               admin,
+      policy:              policy,
+      readyInitialBackoff: defaultReadyInitialBackoff,
+      readyMaxBackoff:     defaultReadyMaxBackoff,
+      callRetry:           retry.DefaultPolicy,
+      conflictRetry:       retry.DefaultPolicy,
+      batchConcurrency:    1,
+      batchLimiter:        rate.NewLimiter(rate.Inf, 0),
+   }
+}
+
+// Close releases the IAM admin and IAM policy clients. Both are closed even if
+// closing the first one fails. The Resource Manager client holds no
+// connection of its own and needs no release.
+func (p *Provisioner) Close() error {
+   var errs []error
+
+   if err := p.admin.Close(); err != nil {
+      errs = append(errs, fmt.Errorf("iamadmin.Close: %w", err))
+   }
+
+   if err := p.policy.Close(); err != nil {
+      errs = append(errs, fmt.Errorf("iampolicy.Close: %w", err))
+   }
+
+   return errors.Join(errs...)
+}
@@ -0,0 +1,29 @@
+package gcputils
+
+import (
+   "errors"
+   "testing"
+
+   "github.com/stretchr/testify/assert"
+)
+
+func TestProvisionerClose_BothClientsOpen_ShouldCloseBoth(t *testing.T) {
+   admin := &fakeAdminClient{}
+   policy := &fakePolicyClient{}
+
+   err := newProvisioner(admin, policy).Close()
+   assert.NoError(t, err)
+   assert.True(t, admin.closed)
+   assert.True(t, policy.closed)
+}
+
+func TestProvisionerClose_AdminCloseFails_ShouldStillClosePolicy(t *testing.T) {
+   closeErr := errors.New("admin close failed")
+   admin := &fakeAdminClient{closeErr: closeErr}
+   policy := &fakePolicyClient{}
+
+   err := newProvisioner(admin, policy).Close()
+   assert.ErrorIs(t, err, closeErr)
+   assert.True(t, admin.closed)
+   assert.True(t, policy.closed)
+}
@@ -0,0 +1,187 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+)
+
+// ErrInvalidPruneAge indicates PruneExpiredKeys was given an age that is not
+// positive, which would select every key.
+var ErrInvalidPruneAge = errors.New("gcputils, prune age must be positive")
+
+// PrunedKey identifies a key considered by PruneExpiredKeys.
+type PrunedKey struct {
+   Email string `json:"email"`
+   KeyID string `json:"key_id"`
+   // ValidAfter is when the key became valid, i.e. its creation time.
+   ValidAfter time.Time `json:"valid_after"`
+   // Err is the deletion failure, set only for keys in PruneReport.Failed.
+   Err error `json:"-"`
+}
+
+// PruneReport lists the keys removed by PruneExpiredKeys and those whose
+// deletion failed.
+type PruneReport struct {
+   Deleted []PrunedKey `json:"deleted"`
+   Failed  []PrunedKey `json:"failed,omitempty"`
+}
+
+// PruneExpiredKeys deletes old keys using a short-lived Provisioner.
+func PruneExpiredKeys(
+   ctx context.Context,
+   projectID string,
+   olderThan time.Duration,
+   opts ...M2MOption,
+) (PruneReport, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return PruneReport{}, err
+   }
+   defer p.Close()
+
+   return p.PruneExpiredKeys(ctx, projectID, olderThan, opts...)
+}
+
+// PruneExpiredKeys deletes the user-managed keys that became valid more than
+// olderThan ago from every account of the project created by
+// NewM2MServiceAccount, as identified by the description prefix, which can be
+// changed with WithDescriptionPrefix, and that carry the labels of
+// WithLabels. System-managed keys are never deleted. Accounts are processed
+// subject to the Provisioner's batch concurrency and rate limits. Deletion
+// failures are reported and do not stop the prune; the returned error joins
+// them.
+//
+// An olderThan that is not positive returns ErrInvalidPruneAge before any
+// call is made, and keys without a creation time are never deleted.
+func (p *Provisioner) PruneExpiredKeys(
+   ctx context.Context,
+   projectID string,
+   olderThan time.Duration,
+   opts ...M2MOption,
+) (PruneReport, error) {
+   if olderThan <= 0 {
+      errMsg := fmt.Sprintf("olderThan %s", olderThan)
+      return PruneReport{}, fmt.Errorf("%s; %w", errMsg, ErrInvalidPruneAge)
+   }
+
+   o := newM2MOptions(opts)
+   var report PruneReport
+
+   prefix, err := o.descriptionMatchPrefix()
+   if err != nil {
+      return report, err
+   }
+
+   accounts, err := p.admin.ListAllServiceAccounts(
+      ctx, fmt.Sprintf("projects/%s", projectID),
+   )
+   if err != nil {
+      return report, wrapError("ListServiceAccounts", err)
+   }
+
+   var managed []*iamadminpb.ServiceAccount
+   for _, sa := range accounts {
+      if o.manages(sa, prefix) {
+         managed = append(managed, sa)
+      }
+   }
+
+   // Each account reports into its own slot so the report keeps the listing
+   // order regardless of concurrency.
+   cutoff := time.Now().Add(-olderThan)
+   reports := make([]PruneReport, len(managed))
+   accountErrs := make([][]error, len(managed))
+   p.runBatch(ctx, len(managed), func(i int) {
+      reports[i], accountErrs[i] = p.pruneAccountKeys(ctx, managed[i], cutoff)
+   }, func(i int, err error) {
+      accountErrs[i] = []error{
+         fmt.Errorf("account '%s': %w", managed[i].Email, err),
+      }
+   })
+
+   var errs []error
+   for i := range managed {
+      report.Deleted = append(report.Deleted, reports[i].Deleted...)
+      report.Failed = append(report.Failed, reports[i].Failed...)
+      errs = append(errs, accountErrs[i]...)
+   }
+
+   return report, errors.Join(errs...)
+}
+
+// pruneAccountKeys deletes the user-managed keys of sa that became valid
+// before cutoff.
+func (p *Provisioner) pruneAccountKeys(
+   ctx context.Context,
+   sa *iamadminpb.ServiceAccount,
+   cutoff time.Time,
+) (PruneReport, []error) {
+   var report PruneReport
+
+   keys, err := p.admin.ListServiceAccountKeys(
+      ctx, &iamadminpb.ListServiceAccountKeysRequest{
+         Name: sa.Name,
+         KeyTypes: []iamadminpb.ListServiceAccountKeysRequest_KeyType{
+            iamadminpb.ListServiceAccountKeysRequest_USER_MANAGED,
+         },
+      },
+   )
+   if err != nil {
+      return report, []error{fmt.Errorf(
+         "account '%s': %w", sa.Email,
+         wrapError("ListServiceAccountKeys", err),
+      )}
+   }
+
+   var errs []error
+   for _, key := range keys.Keys {
+      if isSystemManaged(key) {
+         continue
+      }
+
+      // A key without a creation time cannot be aged; AsTime would report
+      // the Unix epoch and so always prune it.
+      if key.ValidAfterTime == nil {
+         slog.Warn("Skipping key without creation time",
+            "account", sa.Email, "key", key.Name,
+         )
+         continue
+      }
+
+      validAfter := key.ValidAfterTime.AsTime()
+      if !validAfter.Before(cutoff) {
+         continue
+      }
+
+      pruned := PrunedKey{
+         Email:      sa.Email,
+         KeyID:      key.Name,
+         ValidAfter: validAfter,
+      }
+
+      err := p.admin.DeleteServiceAccountKey(
+         ctx, &iamadminpb.DeleteServiceAccountKeyRequest{Name: key.Name},
+      )
+      if err != nil {
+         pruned.Err = wrapError("DeleteServiceAccountKey", err)
+         report.Failed = append(report.Failed, pruned)
+         errs = append(errs,
+            fmt.Errorf("key '%s': %w", key.Name, pruned.Err),
+         )
+
+         continue
+      }
+
+      slog.Info("Expired key deleted",
+         "account", sa.Email, "key ID", key.Name,
+      )
+      report.Deleted = append(report.Deleted, pruned)
+   }
+
+   return report, errs
+}
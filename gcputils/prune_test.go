@@ -0,0 +1,217 @@
+package gcputils
+
+import (
+   "context"
+   "fmt"
+   "testing"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+   "google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestPruneExpiredKeys_MixedAges_ShouldDeleteOnlyOldUserKeys(
+   t *testing.T,
+) {
+   saName := serviceAccountName("my-project", testEmail)
+   old := timestamppb.New(time.Now().Add(-100 * 24 * time.Hour))
+   recent := timestamppb.New(time.Now().Add(-time.Hour))
+
+   var deleted []string
+   admin := &fakeAdminClient{
+      listAllServiceAccounts: func(
+         string,
+      ) ([]*iamadminpb.ServiceAccount, error) {
+         return []*iamadminpb.ServiceAccount{
+            {
+               Name:        saName,
+               Email:       testEmail,
+               Description: "M2M client SA for client",
+            },
+            {
+               Name:        "projects/my-project/serviceAccounts/other",
+               Email:       "other@my-project.iam.gserviceaccount.com",
+               Description: "Deployed by terraform",
+            },
+         }, nil
+      },
+      listServiceAccountKeys: func(
+         req *iamadminpb.ListServiceAccountKeysRequest,
+      ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+         return &iamadminpb.ListServiceAccountKeysResponse{
+            Keys: []*iamadminpb.ServiceAccountKey{
+               {Name: req.Name + "/keys/old", ValidAfterTime: old},
+               {Name: req.Name + "/keys/new", ValidAfterTime: recent},
+               {Name: req.Name + "/keys/undated"},
+               {
+                  Name:           req.Name + "/keys/google",
+                  ValidAfterTime: old,
+                  KeyType: iamadminpb.
+                     ListServiceAccountKeysRequest_SYSTEM_MANAGED,
+               },
+            },
+         }, nil
+      },
+      deleteServiceAccountKey: func(
+         req *iamadminpb.DeleteServiceAccountKeyRequest,
+      ) error {
+         deleted = append(deleted, req.Name)
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   report, err := p.PruneExpiredKeys(
+      context.Background(), "my-project", 90*24*time.Hour,
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, []string{saName + "/keys/old"}, deleted)
+   require.Len(t, report.Deleted, 1)
+   assert.Equal(t, testEmail, report.Deleted[0].Email)
+   assert.Equal(t, saName+"/keys/old", report.Deleted[0].KeyID)
+   assert.True(t, old.AsTime().Equal(report.Deleted[0].ValidAfter))
+   assert.Empty(t, report.Failed)
+}
+
+func TestPruneExpiredKeys_DeleteFails_ShouldReportFailure(t *testing.T) {
+   admin := &fakeAdminClient{
+      listAllServiceAccounts: func(
+         string,
+      ) ([]*iamadminpb.ServiceAccount, error) {
+         return []*iamadminpb.ServiceAccount{{
+            Name:        serviceAccountName("my-project", testEmail),
+            Email:       testEmail,
+            Description: "M2M client SA for client",
+         }}, nil
+      },
+      listServiceAccountKeys: func(
+         req *iamadminpb.ListServiceAccountKeysRequest,
+      ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+         return &iamadminpb.ListServiceAccountKeysResponse{
+            Keys: []*iamadminpb.ServiceAccountKey{{
+               Name:           req.Name + "/keys/old",
+               ValidAfterTime: timestamppb.New(time.Unix(0, 0)),
+            }},
+         }, nil
+      },
+      deleteServiceAccountKey: func(
+         *iamadminpb.DeleteServiceAccountKeyRequest,
+      ) error {
+         return status.Error(codes.PermissionDenied, "denied")
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   report, err := p.PruneExpiredKeys(
+      context.Background(), "my-project", 24*time.Hour,
+   )
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   assert.Empty(t, report.Deleted)
+   require.Len(t, report.Failed, 1)
+   assert.ErrorIs(t, report.Failed[0].Err, ErrPermissionDenied)
+}
+
+func TestPruneExpiredKeys_DescriptionPrefix_ShouldMatchCustomAccounts(
+   t *testing.T,
+) {
+   var listed []string
+   admin := &fakeAdminClient{
+      listAllServiceAccounts: func(
+         string,
+      ) ([]*iamadminpb.ServiceAccount, error) {
+         return []*iamadminpb.ServiceAccount{
+            {Name: "custom", Description: "[team:payments] m2m acme-client"},
+            {Name: "default", Description: "M2M client SA for acme-client"},
+         }, nil
+      },
+      listServiceAccountKeys: func(
+         req *iamadminpb.ListServiceAccountKeysRequest,
+      ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+         listed = append(listed, req.Name)
+         return &iamadminpb.ListServiceAccountKeysResponse{}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.PruneExpiredKeys(
+      context.Background(),
+      "my-project",
+      24*time.Hour,
+      WithDescriptionPrefix("[team:payments] m2m "),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, []string{"custom"}, listed)
+}
+
+func TestPruneExpiredKeys_Concurrency_ShouldCapAndKeepOrder(t *testing.T) {
+   old := timestamppb.New(time.Now().Add(-100 * 24 * time.Hour))
+   probe := &concurrencyProbe{}
+
+   var accounts []*iamadminpb.ServiceAccount
+   for i := 0; i < 8; i++ {
+      email := fmt.Sprintf("sa-%d@my-project.iam.gserviceaccount.com", i)
+      accounts = append(accounts, &iamadminpb.ServiceAccount{
+         Name:        "projects/my-project/serviceAccounts/" + email,
+         Email:       email,
+         Description: "M2M client SA for client",
+      })
+   }
+
+   admin := &fakeAdminClient{
+      listAllServiceAccounts: func(
+         string,
+      ) ([]*iamadminpb.ServiceAccount, error) {
+         return accounts, nil
+      },
+      listServiceAccountKeys: func(
+         req *iamadminpb.ListServiceAccountKeysRequest,
+      ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+         probe.enter(10 * time.Millisecond)
+         return &iamadminpb.ListServiceAccountKeysResponse{
+            Keys: []*iamadminpb.ServiceAccountKey{
+               {Name: req.Name + "/keys/old", ValidAfterTime: old},
+            },
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithBatchConcurrency(2)(p)
+
+   report, err := p.PruneExpiredKeys(
+      context.Background(), "my-project", 90*24*time.Hour,
+   )
+   require.NoError(t, err)
+   assert.LessOrEqual(t, probe.peak, 2)
+   require.Len(t, report.Deleted, len(accounts))
+   for i, key := range report.Deleted {
+      assert.Equal(t, accounts[i].Email, key.Email)
+   }
+}
+
+func TestPruneExpiredKeys_NonPositiveAge_ShouldReturnErr(t *testing.T) {
+   for _, olderThan := range []time.Duration{0, -time.Hour} {
+      t.Run(olderThan.String(), func(t *testing.T) {
+         listed := false
+         admin := &fakeAdminClient{
+            listAllServiceAccounts: func(
+               string,
+            ) ([]*iamadminpb.ServiceAccount, error) {
+               listed = true
+               return nil, nil
+            },
+         }
+         p := newProvisioner(admin, &fakePolicyClient{})
+
+         report, err := p.PruneExpiredKeys(
+            context.Background(), "my-project", olderThan,
+         )
+         assert.ErrorIs(t, err, ErrInvalidPruneAge)
+         assert.Empty(t, report.Deleted)
+         assert.False(t, listed)
+      })
+   }
+}
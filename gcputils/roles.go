@@ -0,0 +1,277 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+   "path"
+   "slices"
+   "strings"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const grantableRolesPageSize = 1000
+
+var (
+   // ErrUnknownRole indicates that one or more requested roles do not exist.
+   ErrUnknownRole = errors.New("gcputils, unknown role")
+   // ErrRoleAlreadyExists indicates that a custom role with the requested ID
+   // already exists in the project.
+   ErrRoleAlreadyExists = errors.New("gcputils, role already exists")
+   // ErrRoleDeleted indicates that a custom role with the requested ID was
+   // previously deleted and must be undeleted rather than recreated.
+   ErrRoleDeleted = errors.New("gcputils, role deleted, undelete required")
+   // ErrNoMatchingRoles indicates that a role pattern expanded by
+   // WithRoleExpansion is malformed or matches no grantable role.
+   ErrNoMatchingRoles = errors.New("gcputils, no roles match pattern")
+)
+
+// RoleInfo holds the details of an IAM role.
+type RoleInfo struct {
+   // Name is the role resource name, e.g. roles/viewer.
+   Name  string `json:"name"`
+   Title string `json:"title"`
+   // Stage is the launch stage of the role, e.g. GA or BETA.
+   Stage string `json:"stage"`
+}
+
+// ListGrantableRoles lists the roles that can be granted on the project using
+// a short-lived Provisioner.
+func ListGrantableRoles(
+   ctx context.Context,
+   projectID string,
+   filter string,
+) ([]RoleInfo, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.ListGrantableRoles(ctx, projectID, filter)
+}
+
+// ListGrantableRoles pages through every role that can be granted on the
+// project. When filter is non-empty, only roles whose name or title contain
+// it (case-insensitive) are returned.
+func (p *Provisioner) ListGrantableRoles(
+   ctx context.Context,
+   projectID string,
+   filter string,
+) ([]RoleInfo, error) {
+   filter = strings.ToLower(filter)
+   req := &iamadminpb.QueryGrantableRolesRequest{
+      FullResourceName: fmt.Sprintf(
+         "//cloudresourcemanager.googleapis.com/projects/%s", projectID,
+      ),
+      PageSize: grantableRolesPageSize,
+   }
+
+   var roles []RoleInfo
+   for {
+      resp, err := p.admin.QueryGrantableRoles(ctx, req)
+      if err != nil {
+         return nil, wrapError("QueryGrantableRoles", err)
+      }
+
+      for _, role := range resp.Roles {
+         if filter != "" &&
+            !strings.Contains(strings.ToLower(role.Name), filter) &&
+            !strings.Contains(strings.ToLower(role.Title), filter) {
+            continue
+         }
+
+         roles = append(roles, RoleInfo{
+            Name:  role.Name,
+            Title: role.Title,
+            Stage: role.Stage.String(),
+         })
+      }
+
+      if resp.NextPageToken == "" {
+         return roles, nil
+      }
+      req.PageToken = resp.NextPageToken
+   }
+}
+
+// CustomRoleName returns the resource name of a project-level custom role,
+// suitable for use with GrantRolesToServiceAccount.
+func CustomRoleName(projectID string, roleID string) string {
+   return fmt.Sprintf("projects/%s/roles/%s", projectID, roleID)
+}
+
+// CreateCustomRole creates a project-level custom role using a short-lived
+// Provisioner.
+func CreateCustomRole(
+   ctx context.Context,
+   projectID string,
+   roleID string,
+   title string,
+   permissions []string,
+) (RoleInfo, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return RoleInfo{}, err
+   }
+   defer p.Close()
+
+   return p.CreateCustomRole(ctx, projectID, roleID, title, permissions)
+}
+
+// CreateCustomRole creates a project-level custom role with the supplied
+// permissions. The returned RoleInfo.Name can be passed directly to
+// GrantRolesToServiceAccount.
+//
+// If the role ID is already in use, ErrRoleAlreadyExists is returned; if the
+// ID belongs to a deleted role, ErrRoleDeleted is returned since GCP requires
+// the role to be undeleted instead.
+func (p *Provisioner) CreateCustomRole(
+   ctx context.Context,
+   projectID string,
+   roleID string,
+   title string,
+   permissions []string,
+) (RoleInfo, error) {
+   req := &iamadminpb.CreateRoleRequest{
+      Parent: fmt.Sprintf("projects/%s", projectID),
+      RoleId: roleID,
+      Role: &iamadminpb.Role{
+         Title:               title,
+         IncludedPermissions: permissions,
+         Stage:               iamadminpb.Role_GA,
+      },
+   }
+
+   role, err := p.admin.CreateRole(ctx, req)
+   if err != nil {
+      if status.Code(err) != codes.AlreadyExists {
+         return RoleInfo{}, wrapError("CreateRole", err)
+      }
+
+      roleName := CustomRoleName(projectID, roleID)
+      existing, getErr := p.admin.GetRole(
+         ctx, &iamadminpb.GetRoleRequest{Name: roleName},
+      )
+      if getErr == nil && existing.Deleted {
+         return RoleInfo{}, fmt.Errorf(
+            "role '%s' must be undeleted; %w", roleName, ErrRoleDeleted,
+         )
+      }
+
+      return RoleInfo{}, fmt.Errorf(
+         "role '%s' exists; %w; %w",
+         roleName, ErrRoleAlreadyExists, ErrAlreadyExists,
+      )
+   }
+
+   slog.Info("Custom role created", "role", role.Name, "project", projectID)
+
+   return RoleInfo{
+      Name:  role.Name,
+      Title: role.Title,
+      Stage: role.Stage.String(),
+   }, nil
+}
+
+// expandRoles replaces each role of roles containing a glob pattern with the
+// grantable roles of the project it matches, keeping the order of roles and
+// dropping duplicates. The grantable roles are only listed when a pattern is
+// present.
+func (p *Provisioner) expandRoles(
+   ctx context.Context,
+   projectID string,
+   roles []string,
+) ([]string, error) {
+   if !slices.ContainsFunc(roles, isRolePattern) {
+      return roles, nil
+   }
+
+   grantable, err := p.ListGrantableRoles(ctx, projectID, "")
+   if err != nil {
+      return nil, err
+   }
+
+   var expanded []string
+   seen := map[string]bool{}
+   add := func(role string) {
+      if !seen[role] {
+         seen[role] = true
+         expanded = append(expanded, role)
+      }
+   }
+
+   for _, role := range roles {
+      if !isRolePattern(role) {
+         add(role)
+         continue
+      }
+
+      matched := 0
+      for _, info := range grantable {
+         ok, err := path.Match(role, info.Name)
+         if err != nil {
+            return nil, fmt.Errorf(
+               "role pattern '%s': %w; %w", role, err, ErrNoMatchingRoles,
+            )
+         }
+
+         if ok {
+            add(info.Name)
+            matched++
+         }
+      }
+
+      if matched == 0 {
+         return nil, fmt.Errorf(
+            "role pattern '%s' matches no grantable role; %w",
+            role, ErrNoMatchingRoles,
+         )
+      }
+
+      slog.Info("Expanded role pattern",
+         "pattern", role, "matches", matched, "project", projectID,
+      )
+   }
+
+   return expanded, nil
+}
+
+// isRolePattern reports whether role contains glob metacharacters.
+func isRolePattern(role string) bool {
+   return strings.ContainsAny(role, `*?[\`)
+}
+
+// validateRoles confirms every role exists via GetRole, returning
+// ErrUnknownRole listing each role that could not be found.
+func (p *Provisioner) validateRoles(
+   ctx context.Context,
+   roles []string,
+) error {
+   var unknown []string
+   for _, roleName := range roles {
+      _, err := p.admin.GetRole(
+         ctx, &iamadminpb.GetRoleRequest{Name: roleName},
+      )
+      switch status.Code(err) {
+      case codes.OK:
+      case codes.NotFound, codes.InvalidArgument:
+         unknown = append(unknown, roleName)
+      default:
+         return wrapError("GetRole", err)
+      }
+   }
+
+   if len(unknown) > 0 {
+      return fmt.Errorf(
+         "roles [%s] not found; %w",
+         strings.Join(unknown, ", "), ErrUnknownRole,
+      )
+   }
+
+   return nil
+}
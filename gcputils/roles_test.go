@@ -0,0 +1,260 @@
+package gcputils
+
+import (
+   "context"
+   "fmt"
+   "testing"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// pagedRoles returns a queryGrantableRoles func serving each slice of roles
+// as a separate page.
+func pagedRoles(
+   pages ...[]*iamadminpb.Role,
+) func(
+   *iamadminpb.QueryGrantableRolesRequest,
+) (*iamadminpb.QueryGrantableRolesResponse, error) {
+   return func(
+      req *iamadminpb.QueryGrantableRolesRequest,
+   ) (*iamadminpb.QueryGrantableRolesResponse, error) {
+      page := 0
+      if req.PageToken != "" {
+         _, _ = fmt.Sscanf(req.PageToken, "page-%d", &page)
+      }
+
+      resp := &iamadminpb.QueryGrantableRolesResponse{Roles: pages[page]}
+      if page+1 < len(pages) {
+         resp.NextPageToken = fmt.Sprintf("page-%d", page+1)
+      }
+
+      return resp, nil
+   }
+}
+
+func TestListGrantableRoles_MultiplePages_ShouldReturnAllRoles(t *testing.T) {
+   var resources []string
+   query := pagedRoles(
+      []*iamadminpb.Role{
+         {Name: "roles/viewer", Title: "Viewer", Stage: iamadminpb.Role_GA},
+         {Name: "roles/editor", Title: "Editor", Stage: iamadminpb.Role_GA},
+      },
+      []*iamadminpb.Role{
+         {
+            Name:  "roles/cloudsql.client",
+            Title: "Cloud SQL Client",
+            Stage: iamadminpb.Role_BETA,
+         },
+      },
+   )
+   admin := &fakeAdminClient{
+      queryGrantableRoles: func(
+         req *iamadminpb.QueryGrantableRolesRequest,
+      ) (*iamadminpb.QueryGrantableRolesResponse, error) {
+         resources = append(resources, req.FullResourceName)
+         return query(req)
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   roles, err := p.ListGrantableRoles(context.Background(), "my-project", "")
+   assert.NoError(t, err)
+   assert.Equal(t, []RoleInfo{
+      {Name: "roles/viewer", Title: "Viewer", Stage: "GA"},
+      {Name: "roles/editor", Title: "Editor", Stage: "GA"},
+      {Name: "roles/cloudsql.client", Title: "Cloud SQL Client", Stage: "BETA"},
+   }, roles)
+   assert.Equal(t, []string{
+      "//cloudresourcemanager.googleapis.com/projects/my-project",
+      "//cloudresourcemanager.googleapis.com/projects/my-project",
+   }, resources)
+}
+
+func TestListGrantableRoles_WithFilter_ShouldReturnMatchingRoles(t *testing.T) {
+   admin := &fakeAdminClient{
+      queryGrantableRoles: pagedRoles(
+         []*iamadminpb.Role{
+            {Name: "roles/viewer", Title: "Viewer"},
+            {Name: "roles/cloudsql.client", Title: "Cloud SQL Client"},
+         },
+         []*iamadminpb.Role{
+            {Name: "roles/cloudsql.admin", Title: "Cloud SQL Admin"},
+         },
+      ),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   roles, err := p.ListGrantableRoles(context.Background(), "my-project", "SQL")
+   assert.NoError(t, err)
+   assert.Len(t, roles, 2)
+   assert.Equal(t, "roles/cloudsql.client", roles[0].Name)
+   assert.Equal(t, "roles/cloudsql.admin", roles[1].Name)
+}
+
+func TestCreateCustomRole_NewRole_ShouldReturnRoleInfo(t *testing.T) {
+   var created *iamadminpb.CreateRoleRequest
+   admin := &fakeAdminClient{
+      createRole: func(
+         req *iamadminpb.CreateRoleRequest,
+      ) (*iamadminpb.Role, error) {
+         created = req
+         return &iamadminpb.Role{
+            Name:  CustomRoleName("my-project", req.RoleId),
+            Title: req.Role.Title,
+            Stage: req.Role.Stage,
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   role, err := p.CreateCustomRole(
+      context.Background(),
+      "my-project",
+      "acmeReader",
+      "Acme Reader",
+      []string{"storage.objects.get"},
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, RoleInfo{
+      Name:  "projects/my-project/roles/acmeReader",
+      Title: "Acme Reader",
+      Stage: "GA",
+   }, role)
+   assert.Equal(t, "projects/my-project", created.Parent)
+   assert.Equal(t, []string{"storage.objects.get"},
+      created.Role.IncludedPermissions,
+   )
+}
+
+func TestCreateCustomRole_Duplicate_ShouldReturnErrRoleAlreadyExists(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      createRole: func(
+         *iamadminpb.CreateRoleRequest,
+      ) (*iamadminpb.Role, error) {
+         return nil, status.Error(codes.AlreadyExists, "exists")
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.CreateCustomRole(
+      context.Background(), "my-project", "acmeReader", "Acme Reader", nil,
+   )
+   assert.ErrorIs(t, err, ErrRoleAlreadyExists)
+   assert.ErrorIs(t, err, ErrAlreadyExists)
+}
+
+func TestCreateCustomRole_DeletedRole_ShouldReturnErrRoleDeleted(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      createRole: func(
+         *iamadminpb.CreateRoleRequest,
+      ) (*iamadminpb.Role, error) {
+         return nil, status.Error(codes.AlreadyExists, "exists")
+      },
+      getRole: func(
+         req *iamadminpb.GetRoleRequest,
+      ) (*iamadminpb.Role, error) {
+         return &iamadminpb.Role{Name: req.Name, Deleted: true}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.CreateCustomRole(
+      context.Background(), "my-project", "acmeReader", "Acme Reader", nil,
+   )
+   assert.ErrorIs(t, err, ErrRoleDeleted)
+}
+
+func TestGrantRoles_RoleExpansion_ShouldGrantEachMatch(t *testing.T) {
+   admin := &fakeAdminClient{
+      queryGrantableRoles: pagedRoles(
+         []*iamadminpb.Role{
+            {Name: "roles/viewer"},
+            {Name: "roles/cloudsql.client"},
+         },
+         []*iamadminpb.Role{
+            {Name: "roles/cloudsql.editor"},
+            {Name: "roles/cloudsqlx.admin"},
+         },
+      ),
+   }
+   policy := &fakePolicyClient{}
+   p := newProvisioner(admin, policy)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/cloudsql.*", "roles/viewer", "roles/cloudsql.client"},
+      WithRoleExpansion(),
+   )
+   assert.NoError(t, err)
+
+   var granted []string
+   for _, binding := range policy.policy.Bindings {
+      granted = append(granted, binding.Role)
+   }
+   assert.ElementsMatch(t, []string{
+      "roles/cloudsql.client", "roles/cloudsql.editor", "roles/viewer",
+   }, granted)
+}
+
+func TestGrantRoles_RoleExpansionNoMatch_ShouldReturnErr(t *testing.T) {
+   tests := []struct {
+      name    string
+      pattern string
+   }{
+      {name: "no match", pattern: "roles/spanner.*"},
+      {name: "malformed pattern", pattern: "roles/cloudsql.[*"},
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         admin := &fakeAdminClient{
+            queryGrantableRoles: pagedRoles([]*iamadminpb.Role{
+               {Name: "roles/cloudsql.client"},
+            }),
+         }
+         policy := &fakePolicyClient{}
+         p := newProvisioner(admin, policy)
+
+         _, err := p.GrantRolesToServiceAccount(
+            context.Background(),
+            "my-project",
+            testEmail,
+            []string{"roles/viewer", tt.pattern},
+            WithRoleExpansion(),
+         )
+         assert.ErrorIs(t, err, ErrNoMatchingRoles)
+         assert.ErrorContains(t, err, tt.pattern)
+         assert.Nil(t, policy.policy)
+      })
+   }
+}
+
+func TestGrantRoles_RoleExpansionWithoutPatterns_ShouldNotListRoles(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      queryGrantableRoles: func(
+         *iamadminpb.QueryGrantableRolesRequest,
+      ) (*iamadminpb.QueryGrantableRolesResponse, error) {
+         return nil, status.Error(codes.PermissionDenied, "denied")
+      },
+   }
+   policy := &fakePolicyClient{}
+   p := newProvisioner(admin, policy)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(), "my-project", testEmail,
+      []string{"roles/viewer"}, WithRoleExpansion(),
+   )
+   assert.NoError(t, err)
+   assert.Len(t, policy.policy.Bindings, 1)
+}
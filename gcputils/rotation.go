@@ -0,0 +1,163 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+)
+
+// AccountRotation is the outcome of rotating the keys of one service account.
+type AccountRotation struct {
+   Email string `json:"email"`
+   // NewKeyID is the resource name of the generated key, empty when key
+   // creation failed.
+   NewKeyID string `json:"new_key_id,omitempty"`
+   // PrivateKey is the credentials JSON of the new key. It is returned only
+   // once and is never serialized.
+   PrivateKey string `json:"-"`
+   // DeletedKeyIDs are the resource names of the previous keys that were
+   // deleted.
+   DeletedKeyIDs []string `json:"deleted_key_ids,omitempty"`
+   // Err is the failure, if any, encountered while rotating the account. A
+   // failed deletion leaves NewKeyID set since the new key remains valid.
+   Err error `json:"-"`
+   // Error is the message of Err, for serialized reports.
+   Error string `json:"error,omitempty"`
+}
+
+// RotationReport summarizes a batch key rotation, one entry per account in
+// the order requested.
+type RotationReport struct {
+   Accounts []AccountRotation `json:"accounts"`
+}
+
+// Failed returns the accounts whose rotation did not fully succeed.
+func (r *RotationReport) Failed() []AccountRotation {
+   var failed []AccountRotation
+   for _, a := range r.Accounts {
+      if a.Err != nil {
+         failed = append(failed, a)
+      }
+   }
+
+   return failed
+}
+
+// Err joins the failures of every account, or returns nil if all succeeded.
+func (r *RotationReport) Err() error {
+   var errs []error
+   for _, a := range r.Failed() {
+      errs = append(errs, fmt.Errorf("account '%s': %w", a.Email, a.Err))
+   }
+
+   return errors.Join(errs...)
+}
+
+// RotateServiceAccountKeys rotates the keys of the supplied accounts using a
+// short-lived Provisioner.
+func RotateServiceAccountKeys(
+   ctx context.Context,
+   projectID string,
+   emails []string,
+) (*RotationReport, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.RotateServiceAccountKeys(ctx, projectID, emails)
+}
+
+// RotateServiceAccountKeys generates a new key for each account and deletes
+// its previous user-managed keys, subject to the Provisioner's batch
+// concurrency and rate limits. Every account is attempted; the report
+// records the outcome of each, in the order requested, and the returned
+// error joins the failures. A malformed email fails its account with
+// ErrInvalidEmail without any call being made, and accounts not started
+// because ctx is done fail with the context error.
+func (p *Provisioner) RotateServiceAccountKeys(
+   ctx context.Context,
+   projectID string,
+   emails []string,
+) (*RotationReport, error) {
+   report := &RotationReport{
+      Accounts: make([]AccountRotation, len(emails)),
+   }
+
+   // Each account reports into its own slot so the report keeps the
+   // requested order regardless of concurrency.
+   p.runBatch(ctx, len(emails), func(i int) {
+      report.Accounts[i] = p.rotateServiceAccountKey(ctx, projectID, emails[i])
+   }, func(i int, err error) {
+      report.Accounts[i] = AccountRotation{Email: emails[i], Err: err}
+   })
+
+   for i := range report.Accounts {
+      rotation := &report.Accounts[i]
+      if rotation.Err != nil {
+         rotation.Error = rotation.Err.Error()
+         slog.Error("Failed to rotate service account key",
+            "account", rotation.Email, "error", rotation.Error,
+         )
+      }
+   }
+
+   return report, report.Err()
+}
+
+// rotateServiceAccountKey lists the existing user-managed keys of an
+// account, generates a new key and then deletes the previous keys.
+func (p *Provisioner) rotateServiceAccountKey(
+   ctx context.Context,
+   projectID string,
+   email string,
+) AccountRotation {
+   rotation := AccountRotation{Email: email}
+   if _, _, err := ParseServiceAccountEmail(email); err != nil {
+      rotation.Err = err
+      return rotation
+   }
+
+   name := serviceAccountName(projectID, email)
+
+   existing, err := p.admin.ListServiceAccountKeys(
+      ctx, &iamadminpb.ListServiceAccountKeysRequest{
+         Name: name,
+         KeyTypes: []iamadminpb.ListServiceAccountKeysRequest_KeyType{
+            iamadminpb.ListServiceAccountKeysRequest_USER_MANAGED,
+         },
+      },
+   )
+   if err != nil {
+      rotation.Err = wrapError("ListServiceAccountKeys", err)
+      return rotation
+   }
+
+   key, err := p.createServiceAccountKey(ctx, name, email)
+   if err != nil {
+      rotation.Err = err
+      return rotation
+   }
+   rotation.NewKeyID = key.Name
+   rotation.PrivateKey = string(key.PrivateKeyData)
+
+   var errs []error
+   for _, old := range existing.Keys {
+      if old.Name == key.Name {
+         continue
+      }
+
+      if err := p.DeleteServiceAccountKey(ctx, old.Name); err != nil {
+         errs = append(errs, err)
+         continue
+      }
+      rotation.DeletedKeyIDs = append(rotation.DeletedKeyIDs, old.Name)
+   }
+   rotation.Err = errors.Join(errs...)
+
+   return rotation
+}
@@ -0,0 +1,192 @@
+package gcputils
+
+import (
+   "context"
+   "fmt"
+   "strings"
+   "testing"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const (
+   healthyEmail = "healthy@my-project.iam.gserviceaccount.com"
+   brokenEmail  = "broken@my-project.iam.gserviceaccount.com"
+)
+
+// existingKeys returns a listServiceAccountKeys func reporting one old key
+// per account.
+func existingKeys() func(
+   *iamadminpb.ListServiceAccountKeysRequest,
+) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+   return func(
+      req *iamadminpb.ListServiceAccountKeysRequest,
+   ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+      return &iamadminpb.ListServiceAccountKeysResponse{
+         Keys: []*iamadminpb.ServiceAccountKey{{Name: req.Name + "/keys/old"}},
+      }, nil
+   }
+}
+
+func TestRotateServiceAccountKeys_MixedOutcomes_ShouldReportEachAccount(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      listServiceAccountKeys: existingKeys(),
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         if strings.Contains(req.Name, brokenEmail) {
+            return nil, status.Error(codes.PermissionDenied, "denied")
+         }
+
+         return &iamadminpb.ServiceAccountKey{
+            Name:           req.Name + "/keys/new",
+            PrivateKeyData: []byte(`{"type":"service_account"}`),
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   report, err := p.RotateServiceAccountKeys(
+      context.Background(),
+      "my-project",
+      []string{healthyEmail, brokenEmail},
+   )
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   require.Len(t, report.Accounts, 2)
+
+   healthyName := serviceAccountName("my-project", healthyEmail)
+   healthy := report.Accounts[0]
+   assert.Equal(t, healthyEmail, healthy.Email)
+   assert.Equal(t, healthyName+"/keys/new", healthy.NewKeyID)
+   assert.Equal(t, `{"type":"service_account"}`, healthy.PrivateKey)
+   assert.Equal(t, []string{healthyName + "/keys/old"}, healthy.DeletedKeyIDs)
+   assert.NoError(t, healthy.Err)
+
+   broken := report.Accounts[1]
+   assert.Equal(t, brokenEmail, broken.Email)
+   assert.Empty(t, broken.NewKeyID)
+   assert.Empty(t, broken.DeletedKeyIDs)
+   assert.ErrorIs(t, broken.Err, ErrPermissionDenied)
+   assert.NotEmpty(t, broken.Error)
+
+   assert.Equal(t, []AccountRotation{broken}, report.Failed())
+}
+
+func TestRotateServiceAccountKeys_DeleteFails_ShouldKeepNewKey(t *testing.T) {
+   admin := &fakeAdminClient{
+      listServiceAccountKeys: existingKeys(),
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{Name: req.Name + "/keys/new"}, nil
+      },
+      deleteServiceAccountKey: func(
+         *iamadminpb.DeleteServiceAccountKeyRequest,
+      ) error {
+         return status.Error(codes.Unavailable, "try again")
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   report, err := p.RotateServiceAccountKeys(
+      context.Background(), "my-project", []string{healthyEmail},
+   )
+   assert.Error(t, err)
+   require.Len(t, report.Accounts, 1)
+   assert.NotEmpty(t, report.Accounts[0].NewKeyID)
+   assert.Empty(t, report.Accounts[0].DeletedKeyIDs)
+   assert.Equal(t, codes.Unavailable, status.Code(report.Accounts[0].Err))
+}
+
+func TestRotateServiceAccountKeys_AllSucceed_ShouldReturnNoError(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{listServiceAccountKeys: existingKeys()}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   report, err := p.RotateServiceAccountKeys(
+      context.Background(), "my-project", []string{healthyEmail},
+   )
+   assert.NoError(t, err)
+   assert.Empty(t, report.Failed())
+}
+
+func TestRotateServiceAccountKeys_InvalidEmail_ShouldFailWithoutCalls(
+   t *testing.T,
+) {
+   var listed []string
+   admin := &fakeAdminClient{
+      listServiceAccountKeys: func(
+         req *iamadminpb.ListServiceAccountKeysRequest,
+      ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+         listed = append(listed, req.Name)
+         return &iamadminpb.ListServiceAccountKeysResponse{}, nil
+      },
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{Name: req.Name + "/keys/new"}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithBatchConcurrency(1)(p)
+
+   report, err := p.RotateServiceAccountKeys(
+      context.Background(),
+      "my-project",
+      []string{"not-an-email", healthyEmail},
+   )
+   assert.ErrorIs(t, err, ErrInvalidEmail)
+   require.Len(t, report.Accounts, 2)
+   assert.ErrorIs(t, report.Accounts[0].Err, ErrInvalidEmail)
+   assert.Empty(t, report.Accounts[0].NewKeyID)
+   assert.NoError(t, report.Accounts[1].Err)
+   assert.Equal(t, []string{serviceAccountName("my-project", healthyEmail)},
+      listed,
+   )
+}
+
+func TestRotateServiceAccountKeys_Concurrency_ShouldCapAndKeepOrder(
+   t *testing.T,
+) {
+   probe := &concurrencyProbe{}
+   admin := &fakeAdminClient{
+      listServiceAccountKeys: func(
+         *iamadminpb.ListServiceAccountKeysRequest,
+      ) (*iamadminpb.ListServiceAccountKeysResponse, error) {
+         probe.enter(10 * time.Millisecond)
+         return &iamadminpb.ListServiceAccountKeysResponse{}, nil
+      },
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{Name: req.Name + "/keys/new"}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithBatchConcurrency(2)(p)
+
+   var emails []string
+   for i := 0; i < 6; i++ {
+      emails = append(emails,
+         fmt.Sprintf("rotate-%d@my-project.iam.gserviceaccount.com", i),
+      )
+   }
+
+   report, err := p.RotateServiceAccountKeys(
+      context.Background(), "my-project", emails,
+   )
+   require.NoError(t, err)
+   assert.LessOrEqual(t, probe.peak, 2)
+   require.Len(t, report.Accounts, len(emails))
+   for i, rotation := range report.Accounts {
+      assert.Equal(t, emails[i], rotation.Email)
+   }
+}
@@ -1,132 +1,922 @@
-package main
+package gcputils
 
 import (
    "context"
+   "encoding/base64"
+   "errors"
    "fmt"
    "log/slog"
+   "strconv"
+   "strings"
+   "time"
 
-   iamadmin "cloud.google.com/go/iam/admin/apiv1"
    iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
-   iampolicy "cloud.google.com/go/iam/apiv1"
-
    "cloud.google.com/go/iam/apiv1/iampb"
+   "github.com/clintrovert/gobackend/internal/retry"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+   "google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 // M2MServiceAccount holds the details for a newly created M2M client
 type M2MServiceAccount struct {
    Email string `json:"client_id"`
-   // PrivateKey is Base64 encoded private key data
+   // PrivateKey is the Google credentials file generated for the key, i.e. a
+   // JSON document with "type": "service_account", "private_key_id",
+   // "private_key" (PEM), "client_email" and token URIs. It can be passed
+   // directly to google.CredentialsFromJSON.
    PrivateKey string `json:"private_key"`
-   // KeyID is the generated key
-   KeyID       string `json:"key_id"`
+   // EncryptedPrivateKey is the ciphertext of the credentials file returned
+   // by the KeyEncrypter set with WithKeyEncrypter, in which case PrivateKey
+   // is empty.
+   EncryptedPrivateKey []byte `json:"encrypted_private_key,omitempty"`
+   // KeyID is the full resource name of the generated key, i.e.
+   // projects/{project}/serviceAccounts/{email}/keys/{key}.
+   //
+   // Deprecated: KeyID is kept with its original meaning for compatibility.
+   // Use KeyName for the resource name and ShortKeyID for the key id alone.
+   KeyID string `json:"key_id"`
+   // KeyName is the full resource name of the generated key, as accepted by
+   // DeleteServiceAccountKey.
+   KeyName     string `json:"key_name"`
    DisplayName string `json:"display_name"`
    // ServiceAccountID is the unique ID.
    ServiceAccountID string `json:"service_account_id"`
+   // ServiceAccountName is the full resource name of the account, i.e.
+   // projects/{project}/serviceAccounts/{email}.
+   ServiceAccountName string `json:"service_account_name"`
+   // ExpiresAt is the intended expiry of the generated key set with
+   // WithKeyExpiry, or zero. GCP does not enforce it; it is a note for
+   // rotation jobs deciding when to replace the key.
+   ExpiresAt time.Time `json:"expires_at,omitzero"`
+   // Labels are the labels applied with WithLabels.
+   Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ShortKeyID returns the id of the generated key without the
+// projects/.../keys/ prefix, or an empty string when no key was generated.
+func (m *M2MServiceAccount) ShortKeyID() string {
+   return shortName(m.KeyName)
+}
+
+// shortName returns the last segment of the resource name.
+func shortName(name string) string {
+   return name[strings.LastIndex(name, "/")+1:]
+}
+
+// ToEnvFile renders the account as KEY="value" lines suitable for a .env file
+// or a secret manager payload. The credentials JSON in PrivateKey is emitted
+// base64 encoded as M2M_PRIVATE_KEY so it fits on a single line; decode it to
+// recover the credentials file. An encrypted key is emitted base64 encoded as
+// M2M_ENCRYPTED_PRIVATE_KEY instead.
+func (m *M2MServiceAccount) ToEnvFile() string {
+   keyVar, keyData := "M2M_PRIVATE_KEY", []byte(m.PrivateKey)
+   if m.EncryptedPrivateKey != nil {
+      keyVar, keyData = "M2M_ENCRYPTED_PRIVATE_KEY", m.EncryptedPrivateKey
+   }
+
+   vars := []struct {
+      key   string
+      value string
+   }{
+      {key: "M2M_CLIENT_ID", value: m.Email},
+      {key: "M2M_SERVICE_ACCOUNT_ID", value: m.ServiceAccountID},
+      {key: "M2M_DISPLAY_NAME", value: m.DisplayName},
+      {key: "M2M_KEY_ID", value: m.KeyID},
+      {key: keyVar, value: base64.StdEncoding.EncodeToString(keyData)},
+   }
+
+   if !m.ExpiresAt.IsZero() {
+      vars = append(vars, struct {
+         key   string
+         value string
+      }{key: "M2M_KEY_EXPIRES_AT", value: m.ExpiresAt.Format(time.RFC3339)})
+   }
+
+   var b strings.Builder
+   for _, v := range vars {
+      b.WriteString(v.key)
+      b.WriteString("=")
+      b.WriteString(strconv.Quote(v.value))
+      b.WriteString("\n")
+   }
+
+   return b.String()
 }
 
 // NewM2MServiceAccount creates a new GCP service account for M2M
-// authentication and generates a key for it.
+// authentication and generates a key for it. A short-lived Provisioner is
+// used; prefer Provisioner.NewM2MServiceAccount for repeated calls.
 func NewM2MServiceAccount(
    ctx context.Context,
    projectID string,
    clientID string,
    displayName string,
+   opts ...M2MOption,
 ) (*M2MServiceAccount, error) {
-   iamAdminClient, err := iamadmin.NewIamClient(ctx)
+   p, err := NewProvisioner(ctx)
    if err != nil {
-      return nil, fmt.Errorf("iamadmin.NewIAMClient: %w", err)
+      return nil, err
    }
-   defer iamAdminClient.Close()
+   defer p.Close()
 
-   saParent := fmt.Sprintf("projects/%s", projectID)
-   saRequest := &iamadminpb.CreateServiceAccountRequest{
-      Name: saParent,
-      ServiceAccount: &iamadminpb.ServiceAccount{
-         DisplayName: displayName,
-         Description: fmt.Sprintf("M2M client SA for %s", clientID),
-      },
-      AccountId: clientID,
+   return p.NewM2MServiceAccount(
+      ctx, projectID, clientID, displayName, opts...,
+   )
+}
+
+// NewM2MServiceAccount creates a new GCP service account for M2M
+// authentication and, unless disabled with WithGenerateKey(false), generates
+// a key for it.
+func (p *Provisioner) NewM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   clientID string,
+   displayName string,
+   opts ...M2MOption,
+) (*M2MServiceAccount, error) {
+   o := newM2MOptions(opts)
+
+   saRequest, labelledDescription, err := o.accountRequest(
+      projectID, clientID, displayName,
+   )
+   if err != nil {
+      return nil, err
    }
 
-   slog.Info("Creating SA named %s...", clientID)
-   createdSA, err := iamAdminClient.CreateServiceAccount(ctx, saRequest)
+   createdSA, generatedKey, _, err := p.createM2MAccount(
+      ctx, projectID, saRequest, labelledDescription, o, nil,
+   )
    if err != nil {
-      return nil, fmt.Errorf("CreateServiceAccount: %w", err)
+      if createdSA != nil {
+         p.cleanupServiceAccount(ctx, createdSA.Name, createdSA.Email)
+      }
+      return nil, err
+   }
+
+   return o.newM2MServiceAccount(createdSA, clientID, generatedKey), nil
+}
+
+// createM2MAccount runs the steps shared by NewM2MServiceAccount and
+// ProvisionClient: with WithProjectValidation it confirms the project, then
+// creates the account described by saRequest, replaces its description with
+// labelledDescription when o has labels and, unless disabled, generates,
+// verifies and encrypts its key. done, if not nil, is called after each
+// stage succeeds. A cancellation of ctx aborts before the next call.
+//
+// On failure the failed stage is returned along with the created account,
+// if any, which the caller must delete again.
+func (p *Provisioner) createM2MAccount(
+   ctx context.Context,
+   projectID string,
+   saRequest *iamadminpb.CreateServiceAccountRequest,
+   labelledDescription string,
+   o m2mOptions,
+   done func(ProvisionStage),
+) (
+   *iamadminpb.ServiceAccount,
+   *iamadminpb.ServiceAccountKey,
+   ProvisionStage,
+   error,
+) {
+   if done == nil {
+      done = func(ProvisionStage) {}
+   }
+
+   if o.validateProject {
+      err := ctx.Err()
+      if err == nil {
+         err = p.validateProject(ctx, projectID)
+      }
+      if err != nil {
+         return nil, nil, StageProject, err
+      }
+      done(StageProject)
+   }
+
+   if err := ctx.Err(); err != nil {
+      return nil, nil, StageCreateAccount, err
+   }
+
+   slog.Info("Creating service account", "id", saRequest.AccountId)
+   createdSA, err := p.createServiceAccount(ctx, saRequest)
+   if err != nil {
+      return nil, nil, StageCreateAccount,
+         wrapError("CreateServiceAccount", err)
    }
    slog.Info("Service Account created",
       "email", createdSA.Email,
       "name", createdSA.Name,
    )
+   done(StageCreateAccount)
+
+   if len(o.labels) > 0 {
+      err := ctx.Err()
+      if err == nil {
+         err = p.labelServiceAccount(ctx, createdSA, labelledDescription)
+      }
+      if err != nil {
+         return createdSA, nil, StageLabel, err
+      }
+      done(StageLabel)
+   }
+
+   if o.skipKey {
+      return createdSA, nil, "", nil
+   }
+
+   if err := ctx.Err(); err != nil {
+      return createdSA, nil, StageGenerateKey, err
+   }
 
+   generatedKey, err := p.createServiceAccountKey(
+      ctx, createdSA.Name, createdSA.Email,
+   )
+   if err == nil {
+      err = o.verifyKey(ctx, generatedKey)
+   }
+   if err == nil {
+      err = o.encryptKey(ctx, generatedKey)
+   }
+   if err != nil {
+      return createdSA, nil, StageGenerateKey, err
+   }
+   done(StageGenerateKey)
+
+   return createdSA, generatedKey, "", nil
+}
+
+// maxDescriptionLength is the IAM limit on service account descriptions,
+// including the labels they carry.
+const maxDescriptionLength = 256
+
+// accountRequest renders the CreateServiceAccountRequest for clientID along
+// with the labelled description applied once the account exists. Labels and
+// the description length are checked up front so an invalid request never
+// leaves an account to roll back. A description too long on its own returns
+// ErrInvalidArgument, one made too long by its labels ErrInvalidLabels.
+func (o m2mOptions) accountRequest(
+   projectID string,
+   clientID string,
+   displayName string,
+) (*iamadminpb.CreateServiceAccountRequest, string, error) {
+   saDisplayName, saDescription, err := o.accountNames(clientID, displayName)
+   if err != nil {
+      return nil, "", fmt.Errorf("render service account names: %w", err)
+   }
+
+   labelledDescription := saDescription
+   if len(o.labels) > 0 {
+      if err := validateLabels(o.labels); err != nil {
+         return nil, "", err
+      }
+
+      labelledDescription = withLabels(saDescription, o.labels)
+   }
+
+   if len(labelledDescription) > maxDescriptionLength {
+      errMsg := fmt.Sprintf("description exceeds %d characters",
+         maxDescriptionLength,
+      )
+      if len(saDescription) > maxDescriptionLength {
+         return nil, "", fmt.Errorf("%s; %w", errMsg, ErrInvalidArgument)
+      }
+      return nil, "", fmt.Errorf("%s; %w", errMsg, ErrInvalidLabels)
+   }
+
+   return &iamadminpb.CreateServiceAccountRequest{
+      Name: fmt.Sprintf("projects/%s", projectID),
+      ServiceAccount: &iamadminpb.ServiceAccount{
+         DisplayName: saDisplayName,
+         Description: saDescription,
+      },
+      AccountId: clientID,
+   }, labelledDescription, nil
+}
+
+// newM2MServiceAccount describes the created account sa and its key, which
+// is nil when no key was generated.
+func (o m2mOptions) newM2MServiceAccount(
+   sa *iamadminpb.ServiceAccount,
+   clientID string,
+   key *iamadminpb.ServiceAccountKey,
+) *M2MServiceAccount {
+   m2m := &M2MServiceAccount{
+      Email:              sa.Email,
+      DisplayName:        sa.DisplayName,
+      ServiceAccountID:   clientID,
+      ServiceAccountName: sa.Name,
+      Labels:             o.labels,
+   }
+   if key != nil {
+      if o.keyEncrypter != nil {
+         m2m.EncryptedPrivateKey = key.PrivateKeyData
+      } else {
+         m2m.PrivateKey = string(key.PrivateKeyData)
+      }
+      m2m.KeyID = key.Name
+      m2m.KeyName = key.Name
+      m2m.ExpiresAt = o.keyExpiresAt
+   }
+
+   return m2m
+}
+
+// labelServiceAccount replaces the description of sa with description, which
+// carries the labels, as CreateServiceAccount cannot set them.
+func (p *Provisioner) labelServiceAccount(
+   ctx context.Context,
+   sa *iamadminpb.ServiceAccount,
+   description string,
+) error {
+   _, err := p.admin.PatchServiceAccount(
+      ctx, &iamadminpb.PatchServiceAccountRequest{
+         ServiceAccount: &iamadminpb.ServiceAccount{
+            Name:        sa.Name,
+            Description: description,
+         },
+         UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"description"}},
+      },
+   )
+   if err != nil {
+      return wrapError("PatchServiceAccount", err)
+   }
+
+   return nil
+}
+
+// createServiceAccount creates the account, retrying transient failures per
+// the Provisioner's RetryPolicy. A transient failure may hide a successful
+// creation, so an AlreadyExists on a retry returns the existing account.
+func (p *Provisioner) createServiceAccount(
+   ctx context.Context,
+   req *iamadminpb.CreateServiceAccountRequest,
+) (*iamadminpb.ServiceAccount, error) {
+   projectID := strings.TrimPrefix(req.Name, "projects/")
+   email := req.AccountId + "@" + projectID + serviceAccountDomain
+   getReq := &iamadminpb.GetServiceAccountRequest{
+      Name: serviceAccountName(projectID, email),
+   }
+
+   retried := false
+   var createdSA *iamadminpb.ServiceAccount
+   err := retry.Do(ctx, p.callRetry, func() error {
+      var err error
+      createdSA, err = p.admin.CreateServiceAccount(ctx, req)
+      if retried && status.Code(err) == codes.AlreadyExists {
+         createdSA, err = p.admin.GetServiceAccount(ctx, getReq)
+      }
+      retried = true
+
+      return err
+   })
+
+   return createdSA, err
+}
+
+// msgKeyQuota explains the most common cause of quota exhaustion on key
+// creation.
+const msgKeyQuota = "key quota exhausted; GCP allows at most 10 user-managed " +
+   "keys per service account, delete unused keys"
+
+// createServiceAccountKey generates a Google credentials file key for the
+// service account identified by its resource name. Quota exhaustion returns
+// ErrQuotaExceeded, after retrying per the policy set with WithKeyQuotaRetry.
+func (p *Provisioner) createServiceAccountKey(
+   ctx context.Context,
+   name string,
+   email string,
+) (*iamadminpb.ServiceAccountKey, error) {
    // WARNING: private_key_data is returned ONLY ONCE.
    // Must be stored securely.
    keyRequest := &iamadminpb.CreateServiceAccountKeyRequest{
-      Name:         createdSA.Name,
+      Name:         name,
       KeyAlgorithm: iamadminpb.ServiceAccountKeyAlgorithm_KEY_ALG_RSA_2048,
       // nolint: lll
       PrivateKeyType: iamadminpb.ServiceAccountPrivateKeyType_TYPE_GOOGLE_CREDENTIALS_FILE,
    }
 
-   slog.Info("Generating key for service account", "account", createdSA.Email)
-   generatedKey, err := iamAdminClient.CreateServiceAccountKey(ctx, keyRequest)
-   if err != nil {
-      if delErr := iamAdminClient.DeleteServiceAccount(
-         ctx, &iamadminpb.DeleteServiceAccountRequest{
-            Name: createdSA.Name,
-         },
-      ); delErr != nil {
-         slog.Error("Failed to clean up service account",
-            "account", createdSA.Email, "error", delErr.Error(),
+   slog.Info("Generating key for service account", "account", email)
+   policy := p.keyRetry
+   isQuota := func(err error) bool {
+      return status.Code(err) == codes.ResourceExhausted
+   }
+
+   attempts := 0
+   var generatedKey *iamadminpb.ServiceAccountKey
+   err := retry.DoWhen(ctx, policy, isQuota, func() error {
+      attempts++
+
+      var err error
+      generatedKey, err = p.admin.CreateServiceAccountKey(ctx, keyRequest)
+      if isQuota(err) && attempts < policy.MaxAttempts {
+         slog.Warn("Key quota exhausted, retrying",
+            "account", email, "attempt", attempts,
          )
       }
 
-      return nil, fmt.Errorf("CreateServiceAccountKey: %w", err)
+      return err
+   })
+   if err != nil {
+      if !isQuota(err) {
+         return nil, wrapError("CreateServiceAccountKey", err)
+      }
+
+      return nil, fmt.Errorf(
+         "account '%s' after %d attempts, %s: %w",
+         email, attempts, msgKeyQuota,
+         wrapError("CreateServiceAccountKey", err),
+      )
    }
 
    // .g. projects/project-id/serviceAccounts/email/keys/key-id
-   slog.Info("Key created",
-      "account", createdSA.Email, "key ID", generatedKey.Name,
+   slog.Info("Key created", "account", email, "key ID", generatedKey.Name)
+
+   return generatedKey, nil
+}
+
+// NewM2MServiceAccountWithRoles creates a new M2M service account and grants
+// it roles using a short-lived Provisioner.
+func NewM2MServiceAccountWithRoles(
+   ctx context.Context,
+   projectID string,
+   clientID string,
+   displayName string,
+   roles []string,
+   opts ...M2MOption,
+) (*M2MServiceAccount, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.NewM2MServiceAccountWithRoles(
+      ctx, projectID, clientID, displayName, roles, opts...,
    )
+}
 
-   return &M2MServiceAccount{
-      Email:            createdSA.Email,
-      PrivateKey:       string(generatedKey.PrivateKeyData),
-      KeyID:            generatedKey.Name,
-      DisplayName:      createdSA.DisplayName,
-      ServiceAccountID: clientID,
-   }, nil
+// NewM2MServiceAccountWithRoles creates a new M2M service account, waits for
+// it to propagate, and grants it the supplied project-level roles. If any
+// step after creation fails, the service account is deleted.
+func (p *Provisioner) NewM2MServiceAccountWithRoles(
+   ctx context.Context,
+   projectID string,
+   clientID string,
+   displayName string,
+   roles []string,
+   opts ...M2MOption,
+) (*M2MServiceAccount, error) {
+   sa, err := p.NewM2MServiceAccount(
+      ctx, projectID, clientID, displayName, opts...,
+   )
+   if err != nil {
+      return nil, err
+   }
+
+   saName := serviceAccountName(projectID, sa.Email)
+   err = p.WaitServiceAccountReady(
+      ctx, projectID, sa.Email, defaultReadyTimeout,
+   )
+   if err != nil {
+      p.cleanupServiceAccount(ctx, saName, sa.Email)
+      return nil, err
+   }
+
+   _, err = p.GrantRolesToServiceAccount(ctx, projectID, sa.Email, roles)
+   if err != nil {
+      p.cleanupServiceAccount(ctx, saName, sa.Email)
+      return nil, err
+   }
+
+   return sa, nil
 }
 
-// grantRolesToServiceAccount grants specific IAM roles to a service account
-// at the project level.
-func grantRolesToServiceAccount(
+// DeleteM2MServiceAccount deletes a service account using a short-lived
+// Provisioner.
+func DeleteM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   email string,
+) error {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return err
+   }
+   defer p.Close()
+
+   return p.DeleteM2MServiceAccount(ctx, projectID, email)
+}
+
+// DeleteM2MServiceAccount deletes the service account identified by email,
+// returning ErrInvalidEmail if email is malformed and ErrNotFound if the
+// account does not exist.
+func (p *Provisioner) DeleteM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   email string,
+) error {
+   if _, _, err := ParseServiceAccountEmail(email); err != nil {
+      return err
+   }
+
+   err := p.admin.DeleteServiceAccount(
+      ctx, &iamadminpb.DeleteServiceAccountRequest{
+         Name: serviceAccountName(projectID, email),
+      },
+   )
+   if err != nil {
+      return wrapError("DeleteServiceAccount", err)
+   }
+
+   slog.Info("Service account deleted", "account", email)
+
+   return nil
+}
+
+// DeleteM2MServiceAccountIfExists deletes a service account, if it exists,
+// using a short-lived Provisioner.
+func DeleteM2MServiceAccountIfExists(
+   ctx context.Context,
+   projectID string,
+   email string,
+) (bool, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return false, err
+   }
+   defer p.Close()
+
+   return p.DeleteM2MServiceAccountIfExists(ctx, projectID, email)
+}
+
+// DeleteM2MServiceAccountIfExists is an idempotent DeleteM2MServiceAccount
+// for teardown jobs: it reports whether the account was deleted and treats
+// an account that no longer exists as success.
+func (p *Provisioner) DeleteM2MServiceAccountIfExists(
+   ctx context.Context,
+   projectID string,
+   email string,
+) (deleted bool, err error) {
+   err = p.DeleteM2MServiceAccount(ctx, projectID, email)
+   if errors.Is(err, ErrNotFound) {
+      slog.Info("Service account already deleted", "account", email)
+      return false, nil
+   }
+
+   if err != nil {
+      return false, err
+   }
+
+   return true, nil
+}
+
+// ServiceAccountInfo holds the metadata of an existing service account.
+type ServiceAccountInfo struct {
+   Email       string `json:"email"`
+   Name        string `json:"name"`
+   DisplayName string `json:"display_name"`
+   Description string `json:"description"`
+   // UniqueID is the stable numeric ID of the account.
+   UniqueID string `json:"unique_id"`
+   Disabled bool   `json:"disabled"`
+   // Labels are the labels carried by the description, see WithLabels.
+   Labels map[string]string `json:"labels,omitempty"`
+}
+
+// newServiceAccountInfo converts the IAM representation of an account.
+func newServiceAccountInfo(sa *iamadminpb.ServiceAccount) *ServiceAccountInfo {
+   return &ServiceAccountInfo{
+      Email:       sa.Email,
+      Name:        sa.Name,
+      DisplayName: sa.DisplayName,
+      Description: sa.Description,
+      UniqueID:    sa.UniqueId,
+      Disabled:    sa.Disabled,
+      Labels:      parseLabels(sa.Description),
+   }
+}
+
+// ListM2MServiceAccounts lists the accounts created by NewM2MServiceAccount
+// using a short-lived Provisioner.
+func ListM2MServiceAccounts(
+   ctx context.Context,
+   projectID string,
+   opts ...M2MOption,
+) ([]*ServiceAccountInfo, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.ListM2MServiceAccounts(ctx, projectID, opts...)
+}
+
+// ListM2MServiceAccounts lists the accounts of the project created by
+// NewM2MServiceAccount, as identified by the description prefix, which can
+// be changed with WithDescriptionPrefix. With WithLabels, only the accounts
+// carrying every one of the labels are listed.
+func (p *Provisioner) ListM2MServiceAccounts(
+   ctx context.Context,
+   projectID string,
+   opts ...M2MOption,
+) ([]*ServiceAccountInfo, error) {
+   o := newM2MOptions(opts)
+
+   prefix, err := o.descriptionMatchPrefix()
+   if err != nil {
+      return nil, err
+   }
+
+   accounts, err := p.admin.ListAllServiceAccounts(
+      ctx, fmt.Sprintf("projects/%s", projectID),
+   )
+   if err != nil {
+      return nil, wrapError("ListServiceAccounts", err)
+   }
+
+   var infos []*ServiceAccountInfo
+   for _, sa := range accounts {
+      if o.manages(sa, prefix) {
+         infos = append(infos, newServiceAccountInfo(sa))
+      }
+   }
+
+   return infos, nil
+}
+
+// GetM2MServiceAccount fetches the metadata of a service account using a
+// short-lived Provisioner.
+func GetM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   email string,
+) (*ServiceAccountInfo, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.GetM2MServiceAccount(ctx, projectID, email)
+}
+
+// GetM2MServiceAccount fetches the metadata of the service account identified
+// by email, returning ErrInvalidEmail if email is malformed and ErrNotFound if
+// the account does not exist.
+func (p *Provisioner) GetM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   email string,
+) (*ServiceAccountInfo, error) {
+   if _, _, err := ParseServiceAccountEmail(email); err != nil {
+      return nil, err
+   }
+
+   sa, err := p.admin.GetServiceAccount(
+      ctx, &iamadminpb.GetServiceAccountRequest{
+         Name: serviceAccountName(projectID, email),
+      },
+   )
+   if err != nil {
+      return nil, wrapError("GetServiceAccount", err)
+   }
+
+   return newServiceAccountInfo(sa), nil
+}
+
+// UpdateM2MServiceAccount changes the display name and description of a
+// service account using a short-lived Provisioner.
+func UpdateM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   email string,
+   displayName string,
+   description string,
+) (*ServiceAccountInfo, error) {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return nil, err
+   }
+   defer p.Close()
+
+   return p.UpdateM2MServiceAccount(
+      ctx, projectID, email, displayName, description,
+   )
+}
+
+// UpdateM2MServiceAccount changes the display name and description of the
+// service account identified by email without recreating it. Empty values
+// are left unchanged; when both are empty the current metadata is returned.
+// A malformed email returns ErrInvalidEmail without modifying the account.
+func (p *Provisioner) UpdateM2MServiceAccount(
+   ctx context.Context,
+   projectID string,
+   email string,
+   displayName string,
+   description string,
+) (*ServiceAccountInfo, error) {
+   if _, _, err := ParseServiceAccountEmail(email); err != nil {
+      return nil, err
+   }
+
+   sa := &iamadminpb.ServiceAccount{
+      Name:        serviceAccountName(projectID, email),
+      DisplayName: displayName,
+      Description: description,
+   }
+
+   var paths []string
+   if displayName != "" {
+      paths = append(paths, "display_name")
+   }
+   if description != "" {
+      paths = append(paths, "description")
+   }
+
+   if len(paths) == 0 {
+      return p.GetM2MServiceAccount(ctx, projectID, email)
+   }
+
+   updated, err := p.admin.PatchServiceAccount(
+      ctx, &iamadminpb.PatchServiceAccountRequest{
+         ServiceAccount: sa,
+         UpdateMask:     &fieldmaskpb.FieldMask{Paths: paths},
+      },
+   )
+   if err != nil {
+      return nil, wrapError("PatchServiceAccount", err)
+   }
+
+   slog.Info("Service account updated", "account", email, "fields", paths)
+
+   return newServiceAccountInfo(updated), nil
+}
+
+// serviceAccountName returns the resource name of a service account.
+func serviceAccountName(projectID string, email string) string {
+   return fmt.Sprintf("projects/%s/serviceAccounts/%s", projectID, email)
+}
+
+// cleanupServiceAccount deletes a service account created earlier in a
+// failed flow. Failures are logged rather than returned so the original error
+// is surfaced to the caller. The deletion ignores the cancellation of ctx, so
+// a cancelled flow still cleans up.
+func (p *Provisioner) cleanupServiceAccount(
+   ctx context.Context,
+   name string,
+   email string,
+) {
+   if err := p.admin.DeleteServiceAccount(
+      context.WithoutCancel(ctx),
+      &iamadminpb.DeleteServiceAccountRequest{Name: name},
+   ); err != nil {
+      slog.Error("Failed to clean up service account",
+         "account", email, "error", err.Error(),
+      )
+   }
+}
+
+// GrantOption configures the behavior of GrantRolesToServiceAccount.
+type GrantOption func(*grantOptions)
+
+type grantOptions struct {
+   validateRoles bool
+   expandRoles   bool
+   diffSink      func(*PolicyDiff)
+}
+
+// WithRoleValidation checks that every requested role exists before the
+// policy is modified, returning ErrUnknownRole for any that do not. This
+// catches typos such as roles/viewr which would otherwise grant nothing.
+func WithRoleValidation() GrantOption {
+   return func(o *grantOptions) {
+      o.validateRoles = true
+   }
+}
+
+// WithRoleExpansion expands roles containing glob patterns, as understood by
+// path.Match, against the roles grantable on the project before the policy
+// is modified, e.g. roles/cloudsql.* to roles/cloudsql.client,
+// roles/cloudsql.editor and so on. A pattern matching no grantable role
+// returns ErrNoMatchingRoles. Roles without a pattern are granted as given.
+func WithRoleExpansion() GrantOption {
+   return func(o *grantOptions) {
+      o.expandRoles = true
+   }
+}
+
+// WithPolicyDiff passes a PolicyDiff of the bindings before and after the
+// grant to sink once the policy is written, e.g. to persist a JSON audit
+// record of every IAM change. sink is not called when the grant fails.
+func WithPolicyDiff(sink func(*PolicyDiff)) GrantOption {
+   return func(o *grantOptions) {
+      o.diffSink = sink
+   }
+}
+
+// GrantRolesToServiceAccount grants specific IAM roles to a service account
+// at the project level. The returned PolicyDelta describes exactly which
+// bindings were added so callers can revoke them with RevokePolicyDelta. A
+// malformed email returns ErrInvalidEmail without modifying the policy. A
+// write lost to a concurrent policy change is retried per
+// WithPolicyConflictRetry, returning ErrPolicyConflict once exhausted.
+func (p *Provisioner) GrantRolesToServiceAccount(
    ctx context.Context,
    projectID string,
    serviceAccountEmail string,
    roles []string,
-) error {
-   // Initialize the IAM Policy client
-   iamPolicyClient, err := iampolicy.NewIamPolicyClient(ctx)
+   opts ...GrantOption,
+) (*PolicyDelta, error) {
+   _, _, err := ParseServiceAccountEmail(serviceAccountEmail)
    if err != nil {
-      return fmt.Errorf("iampolicy.NewIamPolicyClient: %w", err)
+      return nil, err
+   }
+
+   var o grantOptions
+   for _, opt := range opts {
+      opt(&o)
+   }
+
+   if o.expandRoles {
+      roles, err = p.expandRoles(ctx, projectID, roles)
+      if err != nil {
+         return nil, err
+      }
+   }
+
+   if o.validateRoles {
+      if err := p.validateRoles(ctx, roles); err != nil {
+         return nil, err
+      }
    }
-   defer iamPolicyClient.Close()
 
    resource := fmt.Sprintf("projects/%s", projectID)
+   member := fmt.Sprintf("serviceAccount:%s", serviceAccountEmail)
+
+   // Each attempt refetches the policy, so a conflicting write made by
+   // another client since the last read is preserved.
+   var delta *PolicyDelta
+   var diff *PolicyDiff
+   err = retry.DoWhen(ctx, p.conflictRetry, isPolicyConflict, func() error {
+      delta, diff, err = p.grantRoles(ctx, resource, member, roles)
+      return err
+   })
+   if err != nil {
+      return nil, err
+   }
+
+   if o.diffSink != nil {
+      o.diffSink(diff)
+   }
 
+   slog.Info("Granted roles to service account",
+      "roles", roles, "account", serviceAccountEmail, "project", projectID,
+   )
+
+   return delta, nil
+}
+
+// isPolicyConflict reports whether err is a policy write lost to a
+// concurrent modification.
+func isPolicyConflict(err error) bool {
+   return errors.Is(err, ErrPolicyConflict)
+}
+
+// grantRoles performs one read-modify-write cycle of the IAM policy of
+// resource, adding member to the unconditional binding of each of roles,
+// and returns the delta and diff of the change. Conditional bindings of the
+// same roles are left untouched. A write rejected because the policy changed
+// since it was read returns ErrPolicyConflict.
+func (p *Provisioner) grantRoles(
+   ctx context.Context,
+   resource string,
+   member string,
+   roles []string,
+) (*PolicyDelta, *PolicyDiff, error) {
    getPolicyReq := &iampb.GetIamPolicyRequest{
       Resource: resource,
+      Options: &iampb.GetPolicyOptions{
+         RequestedPolicyVersion: conditionalPolicyVersion,
+      },
    }
-   policy, err := iamPolicyClient.GetIamPolicy(ctx, getPolicyReq)
+   var policy *iampb.Policy
+   err := retry.Do(ctx, p.callRetry, func() error {
+      var err error
+      policy, err = p.policy.GetIamPolicy(ctx, getPolicyReq)
+      return err
+   })
    if err != nil {
-      return fmt.Errorf("GetIamPolicy: %w", err)
+      return nil, nil, wrapError("GetIamPolicy", err)
    }
 
-   member := fmt.Sprintf("serviceAccount:%s", serviceAccountEmail)
+   before := snapshotBindings(policy, roles)
+   delta := &PolicyDelta{Resource: resource}
    for _, roleName := range roles {
       foundRole := false
       for _, binding := range policy.Bindings {
-         if binding.Role == roleName {
+         if binding.Role == roleName && binding.Condition == nil {
             // Add member if not already present
             foundMember := false
             for _, m := range binding.Members {
@@ -137,6 +927,7 @@ func grantRolesToServiceAccount(
             }
             if !foundMember {
                binding.Members = append(binding.Members, member)
+               delta.add(roleName, member, false)
             }
             foundRole = true
             break
@@ -147,21 +938,32 @@ func grantRolesToServiceAccount(
             Role:    roleName,
             Members: []string{member},
          })
+         delta.add(roleName, member, true)
       }
    }
 
+   // Writing a lower version would drop the conditions of other bindings.
+   policy.Version = conditionalPolicyVersion
    setPolicyReq := &iampb.SetIamPolicyRequest{
       Resource: resource,
       Policy:   policy,
    }
-   _, err = iamPolicyClient.SetIamPolicy(ctx, setPolicyReq)
+   _, err = p.policy.SetIamPolicy(ctx, setPolicyReq)
+   if status.Code(err) == codes.Aborted {
+      return nil, nil, fmt.Errorf(
+         "%w: %w", ErrPolicyConflict, wrapError("SetIamPolicy", err),
+      )
+   }
    if err != nil {
-      return fmt.Errorf("SetIamPolicy: %w", err)
+      return nil, nil, wrapError("SetIamPolicy", err)
    }
 
-   slog.Info("Granted roles to service account",
-      "roles", roles, "account", serviceAccountEmail, "project", projectID,
-   )
+   diff := &PolicyDiff{
+      Resource: resource,
+      Before:   before,
+      After:    snapshotBindings(policy, roles),
+      Added:    delta.Added,
+   }
 
-   return nil
+   return delta, diff, nil
 }
@@ -0,0 +1,1125 @@
+package gcputils
+
+import (
+   "context"
+   "encoding/base64"
+   "errors"
+   "strings"
+   "testing"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "cloud.google.com/go/iam/apiv1/iampb"
+   "github.com/clintrovert/gobackend/environ"
+   "github.com/stretchr/testify/assert"
+   "github.com/stretchr/testify/require"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const testEmail = "client@my-project.iam.gserviceaccount.com"
+
+// knownRoles returns a getRole func that only resolves the supplied roles.
+func knownRoles(
+   names ...string,
+) func(*iamadminpb.GetRoleRequest) (*iamadminpb.Role, error) {
+   return func(req *iamadminpb.GetRoleRequest) (*iamadminpb.Role, error) {
+      for _, name := range names {
+         if req.Name == name {
+            return &iamadminpb.Role{Name: name}, nil
+         }
+      }
+
+      return nil, status.Error(codes.NotFound, "role not found")
+   }
+}
+
+func TestGrantRoles_ValidationAllValid_ShouldApplyPolicy(t *testing.T) {
+   admin := &fakeAdminClient{
+      getRole: knownRoles("roles/viewer", "roles/editor"),
+   }
+   policy := &fakePolicyClient{}
+   p := newProvisioner(admin, policy)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/viewer", "roles/editor"},
+      WithRoleValidation(),
+   )
+   assert.NoError(t, err)
+   assert.Len(t, policy.policy.Bindings, 2)
+}
+
+func TestGrantRoles_ValidationSomeInvalid_ShouldReturnErrUnknownRole(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{getRole: knownRoles("roles/viewer")}
+   policy := &fakePolicyClient{}
+   p := newProvisioner(admin, policy)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      testEmail,
+      []string{"roles/viewr", "roles/viewer", "roles/edtor"},
+      WithRoleValidation(),
+   )
+   assert.ErrorIs(t, err, ErrUnknownRole)
+   assert.ErrorContains(t, err, "roles/viewr, roles/edtor")
+   assert.Nil(t, policy.policy)
+}
+
+// recordCreate returns a createServiceAccount func that records the request
+// and echoes the requested account back.
+func recordCreate(
+   dest **iamadminpb.CreateServiceAccountRequest,
+) func(
+   *iamadminpb.CreateServiceAccountRequest,
+) (*iamadminpb.ServiceAccount, error) {
+   return func(
+      req *iamadminpb.CreateServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error) {
+      *dest = req
+      return &iamadminpb.ServiceAccount{
+         Name:        "projects/my-project/serviceAccounts/" + testEmail,
+         Email:       testEmail,
+         DisplayName: req.ServiceAccount.DisplayName,
+         Description: req.ServiceAccount.Description,
+      }, nil
+   }
+}
+
+func TestNewM2MServiceAccount_NoEnvironment_ShouldUseDefaultNames(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{createServiceAccount: recordCreate(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, "Acme Client", req.ServiceAccount.DisplayName)
+   assert.Equal(t, "M2M client SA for acme-client",
+      req.ServiceAccount.Description,
+   )
+   assert.Equal(t, "Acme Client", sa.DisplayName)
+}
+
+func TestNewM2MServiceAccount_WithEnvironment_ShouldInterpolateNames(
+   t *testing.T,
+) {
+   tests := []struct {
+      env             environ.Environment
+      wantDisplayName string
+      wantDescription string
+   }{
+      {
+         env:             environ.Development,
+         wantDisplayName: "Acme Client [dev]",
+         wantDescription: "M2M client SA for acme-client [dev]",
+      },
+      {
+         env:             environ.Staging,
+         wantDisplayName: "Acme Client [stg]",
+         wantDescription: "M2M client SA for acme-client [stg]",
+      },
+      {
+         env:             environ.Production,
+         wantDisplayName: "Acme Client [prd]",
+         wantDescription: "M2M client SA for acme-client [prd]",
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.env.String(), func(t *testing.T) {
+         var req *iamadminpb.CreateServiceAccountRequest
+         admin := &fakeAdminClient{createServiceAccount: recordCreate(&req)}
+         p := newProvisioner(admin, &fakePolicyClient{})
+
+         _, err := p.NewM2MServiceAccount(
+            context.Background(),
+            "my-project",
+            "acme-client",
+            "Acme Client",
+            WithEnvironment(tt.env),
+         )
+         assert.NoError(t, err)
+         assert.Equal(t, tt.wantDisplayName, req.ServiceAccount.DisplayName)
+         assert.Equal(t, tt.wantDescription, req.ServiceAccount.Description)
+      })
+   }
+}
+
+func TestToEnvFile_GeneratedAccount_ShouldContainClientIDAndKey(t *testing.T) {
+   credentials := `{"type":"service_account","client_email":"` +
+      testEmail + `"}`
+   sa := &M2MServiceAccount{
+      Email:            testEmail,
+      PrivateKey:       credentials,
+      KeyID:            "projects/my-project/serviceAccounts/x/keys/abc",
+      DisplayName:      "Acme Client",
+      ServiceAccountID: "acme-client",
+   }
+
+   env := sa.ToEnvFile()
+   assert.Contains(t, env, `M2M_CLIENT_ID="`+testEmail+`"`+"\n")
+   assert.Contains(t, env, `M2M_SERVICE_ACCOUNT_ID="acme-client"`+"\n")
+   assert.Contains(t, env, `M2M_DISPLAY_NAME="Acme Client"`+"\n")
+   assert.Contains(t, env,
+      `M2M_KEY_ID="projects/my-project/serviceAccounts/x/keys/abc"`+"\n",
+   )
+
+   encoded := base64.StdEncoding.EncodeToString([]byte(credentials))
+   assert.Contains(t, env, `M2M_PRIVATE_KEY="`+encoded+`"`+"\n")
+}
+
+func TestNewM2MServiceAccount_GenerateKey_ShouldReturnKey(t *testing.T) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            Name:           req.Name + "/keys/abc",
+            PrivateKeyData: []byte(`{"type":"service_account"}`),
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithGenerateKey(true),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, `{"type":"service_account"}`, sa.PrivateKey)
+   assert.Equal(t,
+      "projects/my-project/serviceAccounts/"+testEmail+"/keys/abc", sa.KeyID,
+   )
+}
+
+func TestNewM2MServiceAccount_GenerateKey_ShouldReturnFullAndShortNames(
+   t *testing.T,
+) {
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         req *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         return &iamadminpb.ServiceAccount{
+            Name:  "projects/my-project/serviceAccounts/" + testEmail,
+            Email: testEmail,
+         }, nil
+      },
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{Name: req.Name + "/keys/abc"}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+   )
+   assert.NoError(t, err)
+   saName := "projects/my-project/serviceAccounts/" + testEmail
+   assert.Equal(t, saName, sa.ServiceAccountName)
+   assert.Equal(t, "acme-client", sa.ServiceAccountID)
+   assert.Equal(t, saName+"/keys/abc", sa.KeyName)
+   assert.Equal(t, sa.KeyName, sa.KeyID)
+   assert.Equal(t, "abc", sa.ShortKeyID())
+}
+
+func TestNewM2MServiceAccount_KeyExpiry_ShouldCarryExpiry(t *testing.T) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         req *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{Name: req.Name + "/keys/abc"}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   expiresAt := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithKeyExpiry(expiresAt),
+   )
+   assert.NoError(t, err)
+   assert.True(t, expiresAt.Equal(sa.ExpiresAt))
+   assert.Equal(t,
+      "M2M client SA for acme-client [expires 2026-01-02T15:04:05Z]",
+      req.ServiceAccount.Description,
+   )
+   assert.Contains(t, sa.ToEnvFile(),
+      `M2M_KEY_EXPIRES_AT="2026-01-02T15:04:05Z"`+"\n",
+   )
+}
+
+func TestNewM2MServiceAccount_KeyExpiryWithoutKey_ShouldIgnoreExpiry(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{createServiceAccount: recordCreate(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithGenerateKey(false),
+      WithKeyExpiry(time.Now().Add(90*24*time.Hour)),
+   )
+   assert.NoError(t, err)
+   assert.True(t, sa.ExpiresAt.IsZero())
+   assert.Equal(t,
+      "M2M client SA for acme-client", req.ServiceAccount.Description,
+   )
+   assert.NotContains(t, sa.ToEnvFile(), "M2M_KEY_EXPIRES_AT")
+}
+
+func TestNewM2MServiceAccount_WithoutKey_ShouldNotCreateKey(t *testing.T) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   keyCreated := false
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         keyCreated = true
+         return &iamadminpb.ServiceAccountKey{}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithGenerateKey(false),
+   )
+   assert.NoError(t, err)
+   assert.False(t, keyCreated)
+   assert.Equal(t, testEmail, sa.Email)
+   assert.Empty(t, sa.PrivateKey)
+   assert.Empty(t, sa.KeyID)
+   assert.Empty(t, sa.KeyName)
+   assert.Empty(t, sa.ShortKeyID())
+}
+
+func TestGetM2MServiceAccount_Found_ShouldReturnInfo(t *testing.T) {
+   var req *iamadminpb.GetServiceAccountRequest
+   admin := &fakeAdminClient{
+      getServiceAccount: func(
+         r *iamadminpb.GetServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         req = r
+         return &iamadminpb.ServiceAccount{
+            Name:        r.Name,
+            Email:       testEmail,
+            DisplayName: "Acme Client",
+            Description: "M2M client SA for acme-client",
+            UniqueId:    "1234567890",
+            Disabled:    true,
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   info, err := p.GetM2MServiceAccount(
+      context.Background(), "my-project", testEmail,
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, "projects/my-project/serviceAccounts/"+testEmail, req.Name)
+   assert.Equal(t, &ServiceAccountInfo{
+      Email:       testEmail,
+      Name:        req.Name,
+      DisplayName: "Acme Client",
+      Description: "M2M client SA for acme-client",
+      UniqueID:    "1234567890",
+      Disabled:    true,
+   }, info)
+}
+
+func TestGetM2MServiceAccount_NotFound_ShouldReturnErrNotFound(t *testing.T) {
+   admin := &fakeAdminClient{
+      getServiceAccount: func(
+         *iamadminpb.GetServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         return nil, status.Error(codes.NotFound, "account not found")
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   info, err := p.GetM2MServiceAccount(
+      context.Background(), "my-project", testEmail,
+   )
+   assert.ErrorIs(t, err, ErrNotFound)
+   assert.Nil(t, info)
+}
+
+func TestGetM2MServiceAccount_MalformedEmail_ShouldReturnErrInvalidEmail(
+   t *testing.T,
+) {
+   called := false
+   admin := &fakeAdminClient{
+      getServiceAccount: func(
+         *iamadminpb.GetServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         called = true
+         return &iamadminpb.ServiceAccount{}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   info, err := p.GetM2MServiceAccount(
+      context.Background(), "my-project", "acme-client",
+   )
+   assert.ErrorIs(t, err, ErrInvalidEmail)
+   assert.Nil(t, info)
+   assert.False(t, called)
+}
+
+// recordPatch returns a patchServiceAccount func that records the request
+// and echoes the patched account back.
+func recordPatch(
+   dest **iamadminpb.PatchServiceAccountRequest,
+) func(
+   *iamadminpb.PatchServiceAccountRequest,
+) (*iamadminpb.ServiceAccount, error) {
+   return func(
+      req *iamadminpb.PatchServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error) {
+      *dest = req
+      return req.ServiceAccount, nil
+   }
+}
+
+func TestUpdateM2MServiceAccount_DisplayNameOnly_ShouldMaskDisplayName(
+   t *testing.T,
+) {
+   var req *iamadminpb.PatchServiceAccountRequest
+   admin := &fakeAdminClient{patchServiceAccount: recordPatch(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   info, err := p.UpdateM2MServiceAccount(
+      context.Background(), "my-project", testEmail, "Acme Corp", "",
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, []string{"display_name"}, req.UpdateMask.Paths)
+   assert.Equal(t,
+      "projects/my-project/serviceAccounts/"+testEmail,
+      req.ServiceAccount.Name,
+   )
+   assert.Equal(t, "Acme Corp", info.DisplayName)
+}
+
+func TestUpdateM2MServiceAccount_DescriptionOnly_ShouldMaskDescription(
+   t *testing.T,
+) {
+   var req *iamadminpb.PatchServiceAccountRequest
+   admin := &fakeAdminClient{patchServiceAccount: recordPatch(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   info, err := p.UpdateM2MServiceAccount(
+      context.Background(), "my-project", testEmail, "", "Renamed client",
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, []string{"description"}, req.UpdateMask.Paths)
+   assert.Equal(t, "Renamed client", info.Description)
+}
+
+func TestUpdateM2MServiceAccount_NoFields_ShouldNotPatch(t *testing.T) {
+   var req *iamadminpb.PatchServiceAccountRequest
+   admin := &fakeAdminClient{patchServiceAccount: recordPatch(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.UpdateM2MServiceAccount(
+      context.Background(), "my-project", testEmail, "", "",
+   )
+   assert.NoError(t, err)
+   assert.Nil(t, req)
+}
+
+func TestUpdateM2MServiceAccount_MalformedEmail_ShouldNotPatch(
+   t *testing.T,
+) {
+   var req *iamadminpb.PatchServiceAccountRequest
+   admin := &fakeAdminClient{patchServiceAccount: recordPatch(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   info, err := p.UpdateM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "client@my-project.iam.gserviceacount.com",
+      "Acme Corp",
+      "",
+   )
+   assert.ErrorIs(t, err, ErrInvalidEmail)
+   assert.Nil(t, info)
+   assert.Nil(t, req)
+}
+
+// exhaustedKeys returns a createServiceAccountKey func failing with
+// ResourceExhausted for the first failures calls, counting every call.
+func exhaustedKeys(
+   failures int,
+   calls *int,
+) func(
+   *iamadminpb.CreateServiceAccountKeyRequest,
+) (*iamadminpb.ServiceAccountKey, error) {
+   return func(
+      req *iamadminpb.CreateServiceAccountKeyRequest,
+   ) (*iamadminpb.ServiceAccountKey, error) {
+      *calls++
+      if *calls <= failures {
+         return nil, status.Error(codes.ResourceExhausted, "key quota")
+      }
+
+      return &iamadminpb.ServiceAccountKey{Name: req.Name + "/keys/abc"}, nil
+   }
+}
+
+func TestNewM2MServiceAccount_KeyQuotaExhausted_ShouldReturnErrQuotaExceeded(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   calls := 0
+   deleted := false
+   admin := &fakeAdminClient{
+      createServiceAccount:    recordCreate(&req),
+      createServiceAccountKey: exhaustedKeys(1, &calls),
+      deleteServiceAccount: func(
+         *iamadminpb.DeleteServiceAccountRequest,
+      ) error {
+         deleted = true
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+   )
+   assert.ErrorIs(t, err, ErrQuotaExceeded)
+   assert.ErrorContains(t, err, "at most 10 user-managed keys")
+   assert.Equal(t, 1, calls)
+   assert.True(t, deleted)
+}
+
+func TestNewM2MServiceAccount_KeyQuotaRetry_ShouldSucceedAfterDelay(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   calls := 0
+   admin := &fakeAdminClient{
+      createServiceAccount:    recordCreate(&req),
+      createServiceAccountKey: exhaustedKeys(2, &calls),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithKeyQuotaRetry(RetryPolicy{
+      MaxAttempts: 3,
+      BaseDelay:   time.Millisecond,
+      MaxDelay:    2 * time.Millisecond,
+   })(p)
+
+   start := time.Now()
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, 3, calls)
+   assert.NotEmpty(t, sa.KeyID)
+   // The 1ms and 2ms waits are jittered down to at most half.
+   assert.GreaterOrEqual(t, time.Since(start), 1500*time.Microsecond)
+}
+
+func TestNewM2MServiceAccount_KeyQuotaRetriesExhausted_ShouldReturnErr(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   calls := 0
+   admin := &fakeAdminClient{
+      createServiceAccount:    recordCreate(&req),
+      createServiceAccountKey: exhaustedKeys(5, &calls),
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithKeyQuotaRetry(RetryPolicy{
+      MaxAttempts: 2,
+      BaseDelay:   time.Millisecond,
+      MaxDelay:    time.Millisecond,
+   })(p)
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+   )
+   assert.ErrorIs(t, err, ErrQuotaExceeded)
+   assert.ErrorContains(t, err, "after 2 attempts")
+   assert.Equal(t, 2, calls)
+}
+
+func TestGrantRoles_MalformedEmail_ShouldNotTouchPolicy(t *testing.T) {
+   policy := &fakePolicyClient{}
+   p := newProvisioner(&fakeAdminClient{}, policy)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(),
+      "my-project",
+      "client@my-project.iam.gserviceacount.com",
+      []string{"roles/viewer"},
+   )
+   assert.ErrorIs(t, err, ErrInvalidEmail)
+   assert.Nil(t, policy.policy)
+}
+
+func TestDeleteM2MServiceAccountIfExists_Exists_ShouldReportDeleted(
+   t *testing.T,
+) {
+   p := newProvisioner(&fakeAdminClient{}, &fakePolicyClient{})
+
+   deleted, err := p.DeleteM2MServiceAccountIfExists(
+      context.Background(), "my-project", testEmail,
+   )
+   assert.NoError(t, err)
+   assert.True(t, deleted)
+}
+
+func TestDeleteM2MServiceAccountIfExists_Errors_ShouldSurfaceOnlyRealErrors(
+   t *testing.T,
+) {
+   tests := []struct {
+      name    string
+      err     error
+      wantErr bool
+   }{
+      {name: "not found", err: status.Error(codes.NotFound, "gone")},
+      {
+         name:    "permission denied",
+         err:     status.Error(codes.PermissionDenied, "denied"),
+         wantErr: true,
+      },
+   }
+
+   for _, tt := range tests {
+      t.Run(tt.name, func(t *testing.T) {
+         admin := &fakeAdminClient{
+            deleteServiceAccount: func(
+               *iamadminpb.DeleteServiceAccountRequest,
+            ) error {
+               return tt.err
+            },
+         }
+         p := newProvisioner(admin, &fakePolicyClient{})
+
+         deleted, err := p.DeleteM2MServiceAccountIfExists(
+            context.Background(), "my-project", testEmail,
+         )
+         assert.Equal(t, tt.wantErr, err != nil)
+         assert.False(t, deleted)
+      })
+   }
+}
+
+func TestNewM2MServiceAccount_DescriptionPrefix_ShouldApplyCustomPrefix(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{createServiceAccount: recordCreate(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithDescriptionPrefix("[team:payments] m2m "),
+      WithEnvironment(environ.Production),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, "[team:payments] m2m acme-client [prd]",
+      req.ServiceAccount.Description,
+   )
+}
+
+func TestListM2MServiceAccounts_DescriptionTemplate_ShouldMatchCreated(
+   t *testing.T,
+) {
+   opts := []M2MOption{
+      WithDescriptionPrefix("[team:payments env:{{.Environment}}] m2m "),
+      WithEnvironment(environ.Production),
+   }
+
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{createServiceAccount: recordCreate(&req)}
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "acme-client", "Acme Client",
+      opts...,
+   )
+   require.NoError(t, err)
+   created := req.ServiceAccount.Description
+   assert.Equal(t, "[team:payments env:prd] m2m acme-client [prd]", created)
+
+   admin.listAllServiceAccounts = func(
+      string,
+   ) ([]*iamadminpb.ServiceAccount, error) {
+      return []*iamadminpb.ServiceAccount{
+         {Name: "created", Description: created},
+         {Name: "staging", Description: "[team:payments env:stg] m2m other"},
+         {Name: "default", Description: "M2M client SA for acme-client"},
+      }, nil
+   }
+
+   infos, err := p.ListM2MServiceAccounts(
+      context.Background(), "my-project", opts...,
+   )
+   require.NoError(t, err)
+   require.Len(t, infos, 1)
+   assert.Equal(t, created, infos[0].Description)
+}
+
+func TestListM2MServiceAccounts_MalformedDescriptionPrefix_ShouldReturnErr(
+   t *testing.T,
+) {
+   listed := false
+   admin := &fakeAdminClient{
+      listAllServiceAccounts: func(
+         string,
+      ) ([]*iamadminpb.ServiceAccount, error) {
+         listed = true
+         return nil, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.ListM2MServiceAccounts(
+      context.Background(),
+      "my-project",
+      WithDescriptionPrefix("[team:{{.Team] m2m "),
+   )
+   assert.ErrorContains(t, err, "render description prefix")
+   assert.False(t, listed)
+}
+
+func TestNewM2MServiceAccount_DescriptionTooLong_ShouldNotCreate(
+   t *testing.T,
+) {
+   created := false
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         created = true
+         return &iamadminpb.ServiceAccount{}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      WithDescriptionPrefix(strings.Repeat("m2m ", 64)),
+   )
+   assert.ErrorIs(t, err, ErrInvalidArgument)
+   assert.ErrorContains(t, err, "description exceeds 256 characters")
+   assert.False(t, created)
+}
+
+// fastRetry retries transient failures without noticeable delay.
+var fastRetry = RetryPolicy{
+   MaxAttempts: 3,
+   BaseDelay:   time.Millisecond,
+   MaxDelay:    time.Millisecond,
+}
+
+func TestNewM2MServiceAccount_TransientCreateFailure_ShouldRetry(
+   t *testing.T,
+) {
+   calls := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         calls++
+         if calls < 3 {
+            return nil, status.Error(codes.Unavailable, "try again")
+         }
+         return &iamadminpb.ServiceAccount{Email: testEmail}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithRetryPolicy(fastRetry)(p)
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+      WithGenerateKey(false),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, 3, calls)
+   assert.Equal(t, testEmail, sa.Email)
+}
+
+func TestNewM2MServiceAccount_CreateRetriesExhausted_ShouldReturnLastError(
+   t *testing.T,
+) {
+   calls := 0
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         calls++
+         return nil, status.Error(codes.Unavailable, "try again")
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithRetryPolicy(fastRetry)(p)
+
+   _, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+   )
+   assert.Equal(t, codes.Unavailable, status.Code(err))
+   assert.Equal(t, 3, calls)
+}
+
+func TestNewM2MServiceAccount_AlreadyExistsAfterRetry_ShouldGetAccount(
+   t *testing.T,
+) {
+   calls := 0
+   var getName string
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         calls++
+         if calls == 1 {
+            return nil, status.Error(codes.Unavailable, "response lost")
+         }
+         return nil, status.Error(codes.AlreadyExists, "exists")
+      },
+      getServiceAccount: func(
+         req *iamadminpb.GetServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         getName = req.Name
+         return &iamadminpb.ServiceAccount{Email: testEmail}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+   WithRetryPolicy(fastRetry)(p)
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+      WithGenerateKey(false),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, testEmail, sa.Email)
+   assert.Equal(t, "projects/my-project/serviceAccounts/"+testEmail, getName)
+}
+
+func TestGrantRoles_TransientGetPolicyFailure_ShouldRetryThenGiveUp(
+   t *testing.T,
+) {
+   policy := &fakePolicyClient{
+      getPolicyErr: status.Error(codes.Unavailable, "try again"),
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+   WithRetryPolicy(fastRetry)(p)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(), "my-project", testEmail, []string{"roles/viewer"},
+   )
+   assert.Equal(t, codes.Unavailable, status.Code(err))
+   assert.Equal(t, 3, policy.getPolicyCalls)
+   assert.Nil(t, policy.policy)
+}
+
+func TestGrantRoles_PolicyConflictOnce_ShouldRefetchAndSucceed(t *testing.T) {
+   policy := &fakePolicyClient{
+      policy: &iampb.Policy{Bindings: []*iampb.Binding{
+         {Role: "roles/viewer", Members: []string{"user:a@example.com"}},
+      }},
+      setPolicyErrs: []error{
+         status.Error(codes.Aborted, "concurrent policy changes"),
+      },
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+   WithPolicyConflictRetry(fastRetry)(p)
+
+   delta, err := p.GrantRolesToServiceAccount(
+      context.Background(), "my-project", testEmail, []string{"roles/viewer"},
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, 2, policy.getPolicyCalls)
+   assert.Equal(t, 2, policy.setPolicyCalls)
+   assert.Equal(t, []BindingDelta{{
+      Role:    "roles/viewer",
+      Members: []string{"serviceAccount:" + testEmail},
+   }}, delta.Added)
+   assert.Equal(t,
+      []string{"user:a@example.com", "serviceAccount:" + testEmail},
+      policy.policy.Bindings[0].Members,
+   )
+}
+
+func TestGrantRoles_PolicyConflictPersists_ShouldReturnErrPolicyConflict(
+   t *testing.T,
+) {
+   policy := &fakePolicyClient{
+      setPolicyErr: status.Error(codes.Aborted, "concurrent policy changes"),
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+   WithPolicyConflictRetry(fastRetry)(p)
+
+   delta, err := p.GrantRolesToServiceAccount(
+      context.Background(), "my-project", testEmail, []string{"roles/viewer"},
+   )
+   assert.ErrorIs(t, err, ErrPolicyConflict)
+   assert.Equal(t, codes.Aborted, status.Code(err))
+   assert.Nil(t, delta)
+   assert.Equal(t, fastRetry.MaxAttempts, policy.getPolicyCalls)
+   assert.Equal(t, fastRetry.MaxAttempts, policy.setPolicyCalls)
+}
+
+func TestGrantRoles_SetPolicyDenied_ShouldNotRetry(t *testing.T) {
+   policy := &fakePolicyClient{
+      setPolicyErr: status.Error(codes.PermissionDenied, "denied"),
+   }
+   p := newProvisioner(&fakeAdminClient{}, policy)
+   WithPolicyConflictRetry(fastRetry)(p)
+
+   _, err := p.GrantRolesToServiceAccount(
+      context.Background(), "my-project", testEmail, []string{"roles/viewer"},
+   )
+   assert.ErrorIs(t, err, ErrPermissionDenied)
+   assert.NotErrorIs(t, err, ErrPolicyConflict)
+   assert.Equal(t, 1, policy.setPolicyCalls)
+}
+
+func TestNewM2MServiceAccount_CancelledBeforeKey_ShouldCleanUp(
+   t *testing.T,
+) {
+   ctx, cancel := context.WithCancel(context.Background())
+   defer cancel()
+
+   var deleted string
+   keyCreated := false
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         // The caller gives up while the account is being created.
+         cancel()
+         return &iamadminpb.ServiceAccount{
+            Name:  "projects/my-project/serviceAccounts/" + testEmail,
+            Email: testEmail,
+         }, nil
+      },
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         keyCreated = true
+         return &iamadminpb.ServiceAccountKey{}, nil
+      },
+      deleteServiceAccount: func(
+         r *iamadminpb.DeleteServiceAccountRequest,
+      ) error {
+         deleted = r.Name
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(ctx, "my-project", "client", "Client")
+   assert.ErrorIs(t, err, context.Canceled)
+   assert.Nil(t, sa)
+   assert.False(t, keyCreated)
+   assert.Equal(t, "projects/my-project/serviceAccounts/"+testEmail, deleted)
+}
+
+func TestNewM2MServiceAccount_CancelledContext_ShouldNotCreate(
+   t *testing.T,
+) {
+   ctx, cancel := context.WithCancel(context.Background())
+   cancel()
+
+   created := false
+   admin := &fakeAdminClient{
+      createServiceAccount: func(
+         *iamadminpb.CreateServiceAccountRequest,
+      ) (*iamadminpb.ServiceAccount, error) {
+         created = true
+         return &iamadminpb.ServiceAccount{}, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   _, err := p.NewM2MServiceAccount(ctx, "my-project", "client", "Client")
+   assert.ErrorIs(t, err, context.Canceled)
+   assert.False(t, created)
+}
+
+func TestNewM2MServiceAccount_KeyEncrypter_ShouldReturnCiphertext(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            Name:           "key-name",
+            PrivateKeyData: []byte(`{"type":"service_account"}`),
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   var plaintext []byte
+   encrypt := func(_ context.Context, data []byte) ([]byte, error) {
+      plaintext = data
+      return append([]byte("sealed:"), data...), nil
+   }
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+      WithKeyEncrypter(encrypt),
+   )
+   assert.NoError(t, err)
+   assert.Empty(t, sa.PrivateKey)
+   assert.Equal(t,
+      []byte(`sealed:{"type":"service_account"}`), sa.EncryptedPrivateKey,
+   )
+   assert.Equal(t, make([]byte, len(plaintext)), plaintext)
+
+   env := sa.ToEnvFile()
+   assert.Contains(t, env, "M2M_ENCRYPTED_PRIVATE_KEY=\"")
+   assert.NotContains(t, env, "M2M_PRIVATE_KEY=")
+}
+
+func TestNewM2MServiceAccount_KeyEncrypterFails_ShouldCleanUp(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   var deleted string
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            PrivateKeyData: []byte("plaintext"),
+         }, nil
+      },
+      deleteServiceAccount: func(
+         r *iamadminpb.DeleteServiceAccountRequest,
+      ) error {
+         deleted = r.Name
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+      WithKeyEncrypter(func(context.Context, []byte) ([]byte, error) {
+         return nil, errors.New("kms unavailable")
+      }),
+   )
+   assert.ErrorIs(t, err, ErrKeyEncryption)
+   assert.ErrorContains(t, err, "kms unavailable")
+   assert.Nil(t, sa)
+   assert.Equal(t, "projects/my-project/serviceAccounts/"+testEmail, deleted)
+}
+
+func TestNewM2MServiceAccount_KeyVerification_ShouldVerifyPlaintext(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            Name:           "key-name",
+            PrivateKeyData: []byte(`{"type":"service_account"}`),
+         }, nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   var verified string
+   verify := func(_ context.Context, credentialsJSON []byte) error {
+      verified = string(credentialsJSON)
+      return nil
+   }
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+      WithKeyVerification(verify),
+      WithKeyEncrypter(func(context.Context, []byte) ([]byte, error) {
+         return []byte("sealed"), nil
+      }),
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, `{"type":"service_account"}`, verified)
+   assert.Equal(t, []byte("sealed"), sa.EncryptedPrivateKey)
+}
+
+func TestNewM2MServiceAccount_KeyVerificationFails_ShouldCleanUp(
+   t *testing.T,
+) {
+   var req *iamadminpb.CreateServiceAccountRequest
+   var deleted string
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      createServiceAccountKey: func(
+         *iamadminpb.CreateServiceAccountKeyRequest,
+      ) (*iamadminpb.ServiceAccountKey, error) {
+         return &iamadminpb.ServiceAccountKey{
+            PrivateKeyData: []byte("not credentials"),
+         }, nil
+      },
+      deleteServiceAccount: func(
+         r *iamadminpb.DeleteServiceAccountRequest,
+      ) error {
+         deleted = r.Name
+         return nil
+      },
+   }
+   p := newProvisioner(admin, &fakePolicyClient{})
+
+   sa, err := p.NewM2MServiceAccount(
+      context.Background(), "my-project", "client", "Client",
+      WithKeyVerification(func(context.Context, []byte) error {
+         return errors.New("invalid_grant")
+      }),
+   )
+   assert.ErrorIs(t, err, ErrKeyVerification)
+   assert.ErrorContains(t, err, "invalid_grant")
+   assert.Nil(t, sa)
+   assert.Equal(t, "projects/my-project/serviceAccounts/"+testEmail, deleted)
+}
+
+func TestVerifyKey_MalformedCredentials_ShouldReturnErr(t *testing.T) {
+   err := VerifyKey(context.Background(), []byte("not credentials"))
+   assert.ErrorContains(t, err, "build credentials")
+}
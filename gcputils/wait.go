@@ -0,0 +1,106 @@
+package gcputils
+
+import (
+   "context"
+   "errors"
+   "fmt"
+   "log/slog"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+const (
+   defaultReadyInitialBackoff = 250 * time.Millisecond
+   defaultReadyMaxBackoff     = 5 * time.Second
+   // defaultReadyTimeout is used by the combined create-and-grant flow.
+   defaultReadyTimeout = time.Minute
+)
+
+// ErrServiceAccountNotReady indicates that a service account did not become
+// resolvable before the wait timeout elapsed.
+var ErrServiceAccountNotReady = errors.New(
+   "gcputils, service account not ready",
+)
+
+// WaitServiceAccountReady polls until the service account resolves using a
+// short-lived Provisioner.
+func WaitServiceAccountReady(
+   ctx context.Context,
+   projectID string,
+   email string,
+   timeout time.Duration,
+) error {
+   p, err := NewProvisioner(ctx)
+   if err != nil {
+      return err
+   }
+   defer p.Close()
+
+   return p.WaitServiceAccountReady(ctx, projectID, email, timeout)
+}
+
+// WaitServiceAccountReady polls GetServiceAccount with exponential backoff
+// until the account resolves or the timeout elapses. Newly created accounts
+// can take a few seconds to propagate before they may be used in IAM
+// bindings. ErrServiceAccountNotReady is returned once the timeout elapses or
+// ctx is done, including during a poll; a timeout that is not positive
+// returns ErrInvalidArgument before the first poll.
+func (p *Provisioner) WaitServiceAccountReady(
+   ctx context.Context,
+   projectID string,
+   email string,
+   timeout time.Duration,
+) error {
+   if timeout <= 0 {
+      errMsg := fmt.Sprintf("wait timeout %s is not positive", timeout)
+      return fmt.Errorf("%s; %w", errMsg, ErrInvalidArgument)
+   }
+
+   ctx, cancel := context.WithTimeout(ctx, timeout)
+   defer cancel()
+
+   req := &iamadminpb.GetServiceAccountRequest{
+      Name: serviceAccountName(projectID, email),
+   }
+
+   backoff := p.readyInitialBackoff
+   for attempt := 1; ; attempt++ {
+      _, err := p.admin.GetServiceAccount(ctx, req)
+      if err == nil {
+         return nil
+      }
+
+      // A poll cut short by the wait ending is a timeout, not an API
+      // failure.
+      if ctx.Err() != nil {
+         return notReady(email, attempt)
+      }
+
+      if status.Code(err) != codes.NotFound {
+         return wrapError("GetServiceAccount", err)
+      }
+
+      slog.Debug("Service account not yet available",
+         "account", email, "attempt", attempt, "backoff", backoff,
+      )
+
+      select {
+      case <-ctx.Done():
+         return notReady(email, attempt)
+      case <-time.After(backoff):
+      }
+
+      backoff = min(backoff*2, p.readyMaxBackoff)
+   }
+}
+
+// notReady returns ErrServiceAccountNotReady for email after attempt polls.
+func notReady(email string, attempt int) error {
+   return fmt.Errorf(
+      "account '%s' after %d attempts; %w",
+      email, attempt, ErrServiceAccountNotReady,
+   )
+}
@@ -0,0 +1,145 @@
+package gcputils
+
+import (
+   "context"
+   "testing"
+   "time"
+
+   iamadminpb "cloud.google.com/go/iam/admin/apiv1/adminpb"
+   "github.com/googleapis/gax-go/v2"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// appearsAfter returns a getServiceAccount func that reports NotFound for the
+// first n calls and resolves afterwards.
+func appearsAfter(
+   n int,
+   calls *int,
+) func(
+   *iamadminpb.GetServiceAccountRequest,
+) (*iamadminpb.ServiceAccount, error) {
+   return func(
+      req *iamadminpb.GetServiceAccountRequest,
+   ) (*iamadminpb.ServiceAccount, error) {
+      *calls++
+      if *calls <= n {
+         return nil, status.Error(codes.NotFound, "not found")
+      }
+
+      return &iamadminpb.ServiceAccount{Name: req.Name}, nil
+   }
+}
+
+func newFastProvisioner(
+   admin iamAdminClient,
+   policy iamPolicyClient,
+) *Provisioner {
+   p := newProvisioner(admin, policy)
+   p.readyInitialBackoff = time.Millisecond
+   p.readyMaxBackoff = 2 * time.Millisecond
+
+   return p
+}
+
+func TestWaitServiceAccountReady_AppearsAfterPolls_ShouldSucceed(
+   t *testing.T,
+) {
+   var calls int
+   admin := &fakeAdminClient{getServiceAccount: appearsAfter(2, &calls)}
+   p := newFastProvisioner(admin, &fakePolicyClient{})
+
+   err := p.WaitServiceAccountReady(
+      context.Background(), "my-project", testEmail, time.Second,
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, 3, calls)
+}
+
+func TestWaitServiceAccountReady_NeverAppears_ShouldReturnNotReady(
+   t *testing.T,
+) {
+   var calls int
+   admin := &fakeAdminClient{getServiceAccount: appearsAfter(1000, &calls)}
+   p := newFastProvisioner(admin, &fakePolicyClient{})
+
+   err := p.WaitServiceAccountReady(
+      context.Background(), "my-project", testEmail, 20*time.Millisecond,
+   )
+   assert.ErrorIs(t, err, ErrServiceAccountNotReady)
+}
+
+// blockingAdminClient is a fakeAdminClient whose GetServiceAccount blocks
+// until its context is done, as a hung call cut short by a deadline.
+type blockingAdminClient struct {
+   *fakeAdminClient
+}
+
+func (blockingAdminClient) GetServiceAccount(
+   ctx context.Context,
+   _ *iamadminpb.GetServiceAccountRequest,
+   _ ...gax.CallOption,
+) (*iamadminpb.ServiceAccount, error) {
+   <-ctx.Done()
+   return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func TestWaitServiceAccountReady_DeadlineDuringPoll_ShouldReturnNotReady(
+   t *testing.T,
+) {
+   admin := blockingAdminClient{fakeAdminClient: &fakeAdminClient{}}
+   p := newFastProvisioner(admin, &fakePolicyClient{})
+
+   err := p.WaitServiceAccountReady(
+      context.Background(), "my-project", testEmail, 10*time.Millisecond,
+   )
+   assert.ErrorIs(t, err, ErrServiceAccountNotReady)
+   assert.NotEqual(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func TestWaitServiceAccountReady_NonPositiveTimeout_ShouldReturnErr(
+   t *testing.T,
+) {
+   for _, timeout := range []time.Duration{0, -time.Second} {
+      t.Run(timeout.String(), func(t *testing.T) {
+         var calls int
+         admin := &fakeAdminClient{getServiceAccount: appearsAfter(0, &calls)}
+         p := newFastProvisioner(admin, &fakePolicyClient{})
+
+         err := p.WaitServiceAccountReady(
+            context.Background(), "my-project", testEmail, timeout,
+         )
+         assert.ErrorIs(t, err, ErrInvalidArgument)
+         assert.Zero(t, calls)
+      })
+   }
+}
+
+func TestNewM2MServiceAccountWithRoles_DelayedAccount_ShouldGrantRoles(
+   t *testing.T,
+) {
+   var calls int
+   var req *iamadminpb.CreateServiceAccountRequest
+   admin := &fakeAdminClient{
+      createServiceAccount: recordCreate(&req),
+      getServiceAccount:    appearsAfter(2, &calls),
+   }
+   policy := &fakePolicyClient{}
+   p := newFastProvisioner(admin, policy)
+
+   sa, err := p.NewM2MServiceAccountWithRoles(
+      context.Background(),
+      "my-project",
+      "acme-client",
+      "Acme Client",
+      []string{"roles/viewer"},
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, testEmail, sa.Email)
+   assert.Equal(t, 3, calls)
+   assert.Len(t, policy.policy.Bindings, 1)
+   assert.Equal(t, []string{"serviceAccount:" + testEmail},
+      policy.policy.Bindings[0].Members,
+   )
+}
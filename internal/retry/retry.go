@@ -0,0 +1,85 @@
+package retry
+
+import (
+   "context"
+   "fmt"
+   "math/rand/v2"
+   "time"
+
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+// Policy controls how Do retries a call.
+type Policy struct {
+   // MaxAttempts is the total number of attempts, including the first.
+   // Values below 2 disable retries.
+   MaxAttempts int
+   // BaseDelay is the wait before the first retry; it doubles on each
+   // subsequent retry up to MaxDelay. Each wait is jittered to between half
+   // and all of its nominal value.
+   BaseDelay time.Duration
+   MaxDelay  time.Duration
+}
+
+// DefaultPolicy makes three attempts over roughly half a second.
+var DefaultPolicy = Policy{
+   MaxAttempts: 3,
+   BaseDelay:   200 * time.Millisecond,
+   MaxDelay:    2 * time.Second,
+}
+
+// transientCodes are the gRPC status codes worth retrying.
+var transientCodes = map[codes.Code]bool{
+   codes.Unavailable:      true,
+   codes.Aborted:          true,
+   codes.DeadlineExceeded: true,
+}
+
+// IsTransient reports whether err carries a gRPC status code that usually
+// clears on its own, such as Unavailable.
+func IsTransient(err error) bool {
+   return transientCodes[status.Code(err)]
+}
+
+// Do calls fn until it succeeds, fails with an error that is not transient,
+// or policy is exhausted, returning the last error of fn.
+func Do(ctx context.Context, policy Policy, fn func() error) error {
+   return DoWhen(ctx, policy, IsTransient, fn)
+}
+
+// DoWhen is like Do but retries the errors for which retryable returns true.
+// When ctx is done while waiting, the last error of fn is returned joined
+// with the context error.
+func DoWhen(
+   ctx context.Context,
+   policy Policy,
+   retryable func(error) bool,
+   fn func() error,
+) error {
+   delay := policy.BaseDelay
+   for attempt := 1; ; attempt++ {
+      err := fn()
+      if err == nil || !retryable(err) || attempt >= policy.MaxAttempts {
+         return err
+      }
+
+      select {
+      case <-ctx.Done():
+         return fmt.Errorf("%w; %w", err, ctx.Err())
+      case <-time.After(jitter(delay)):
+      }
+
+      delay = min(delay*2, policy.MaxDelay)
+   }
+}
+
+// jitter returns a random duration between half and all of d.
+func jitter(d time.Duration) time.Duration {
+   if d <= 1 {
+      return d
+   }
+
+   half := d / 2
+   return half + rand.N(d-half+1)
+}
@@ -0,0 +1,89 @@
+package retry_test
+
+import (
+   "context"
+   "errors"
+   "testing"
+   "time"
+
+   "github.com/clintrovert/gobackend/internal/retry"
+   "github.com/stretchr/testify/assert"
+   "google.golang.org/grpc/codes"
+   "google.golang.org/grpc/status"
+)
+
+var testPolicy = retry.Policy{
+   MaxAttempts: 3,
+   BaseDelay:   time.Millisecond,
+   MaxDelay:    2 * time.Millisecond,
+}
+
+func TestDo_TransientThenSuccess_ShouldRetry(t *testing.T) {
+   calls := 0
+   err := retry.Do(context.Background(), testPolicy, func() error {
+      calls++
+      if calls < 3 {
+         return status.Error(codes.Unavailable, "try again")
+      }
+      return nil
+   })
+   assert.NoError(t, err)
+   assert.Equal(t, 3, calls)
+}
+
+func TestDo_AlwaysTransient_ShouldGiveUpAfterMaxAttempts(t *testing.T) {
+   calls := 0
+   err := retry.Do(context.Background(), testPolicy, func() error {
+      calls++
+      return status.Error(codes.Unavailable, "try again")
+   })
+   assert.Equal(t, codes.Unavailable, status.Code(err))
+   assert.Equal(t, 3, calls)
+}
+
+func TestDo_PermanentError_ShouldNotRetry(t *testing.T) {
+   calls := 0
+   err := retry.Do(context.Background(), testPolicy, func() error {
+      calls++
+      return status.Error(codes.PermissionDenied, "denied")
+   })
+   assert.Equal(t, codes.PermissionDenied, status.Code(err))
+   assert.Equal(t, 1, calls)
+}
+
+func TestDo_ContextCanceled_ShouldStopWaiting(t *testing.T) {
+   ctx, cancel := context.WithCancel(context.Background())
+   cancel()
+
+   calls := 0
+   err := retry.Do(ctx, retry.Policy{
+      MaxAttempts: 3,
+      BaseDelay:   time.Hour,
+      MaxDelay:    time.Hour,
+   }, func() error {
+      calls++
+      return status.Error(codes.Unavailable, "try again")
+   })
+   assert.ErrorIs(t, err, context.Canceled)
+   assert.Equal(t, codes.Unavailable, status.Code(err))
+   assert.Equal(t, 1, calls)
+}
+
+func TestDoWhen_CustomPredicate_ShouldRetryMatchingErrors(t *testing.T) {
+   errBusy := errors.New("busy")
+   calls := 0
+   err := retry.DoWhen(
+      context.Background(),
+      testPolicy,
+      func(err error) bool { return errors.Is(err, errBusy) },
+      func() error {
+         calls++
+         if calls == 1 {
+            return errBusy
+         }
+         return nil
+      },
+   )
+   assert.NoError(t, err)
+   assert.Equal(t, 2, calls)
+}